@@ -0,0 +1,9 @@
+-- migrate:up
+
+ALTER TABLE action
+ADD source_revision text;
+
+-- migrate:down
+
+ALTER TABLE action
+DROP source_revision;
@@ -0,0 +1,15 @@
+-- migrate:up
+
+CREATE TABLE run_job (
+	run_id uuid PRIMARY KEY,
+	evaluator text NOT NULL,
+	source_revision text NOT NULL,
+	evaluated jsonb NOT NULL,
+	transformed jsonb NOT NULL,
+	job jsonb,
+	FOREIGN KEY (run_id) REFERENCES run (nomad_job_id)
+);
+
+-- migrate:down
+
+DROP TABLE run_job;
@@ -0,0 +1,12 @@
+-- migrate:up
+
+ALTER TABLE run_output
+ADD published text CHECK (published IN ('success', 'failure', 'none')),
+ADD fact_id uuid REFERENCES fact (id),
+ADD CHECK ((fact_id IS NULL) = (published IS NULL OR published = 'none'));
+
+-- migrate:down
+
+ALTER TABLE run_output
+DROP published,
+DROP fact_id;
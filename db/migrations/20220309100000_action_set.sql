@@ -0,0 +1,27 @@
+-- migrate:up
+
+CREATE TABLE action_set (
+	id uuid PRIMARY KEY DEFAULT public.gen_random_uuid(),
+	source text NOT NULL UNIQUE,
+	match text,
+	active boolean NOT NULL DEFAULT true,
+	created_at timestamp NOT NULL DEFAULT NOW(),
+	synced_at timestamp,
+	source_revision text
+);
+
+CREATE TABLE action_set_sync (
+	id uuid PRIMARY KEY DEFAULT public.gen_random_uuid(),
+	action_set_id uuid NOT NULL,
+	created_at timestamp NOT NULL DEFAULT NOW(),
+	source_revision text,
+	fact_id uuid,
+	changes jsonb NOT NULL,
+	error text,
+	FOREIGN KEY (action_set_id) REFERENCES action_set (id),
+	FOREIGN KEY (fact_id) REFERENCES fact (id)
+);
+
+-- migrate:down
+
+DROP TABLE action_set_sync, action_set;
@@ -0,0 +1,7 @@
+-- migrate:up
+
+ALTER TABLE action ADD archived_at timestamp;
+
+-- migrate:down
+
+ALTER TABLE action DROP archived_at;
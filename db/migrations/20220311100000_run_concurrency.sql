@@ -0,0 +1,13 @@
+-- migrate:up
+
+ALTER TABLE run
+ADD started_at timestamp,
+ADD end_reason text CHECK (end_reason IN ('canceled', 'skipped'));
+
+UPDATE run SET started_at = created_at;
+
+-- migrate:down
+
+ALTER TABLE run
+DROP started_at,
+DROP end_reason;
@@ -0,0 +1,13 @@
+-- migrate:up
+
+ALTER TABLE run
+DROP CONSTRAINT run_end_reason_check,
+ADD CHECK (end_reason IN ('canceled', 'skipped', 'timed_out'));
+
+-- migrate:down
+
+UPDATE run SET end_reason = 'canceled' WHERE end_reason = 'timed_out';
+
+ALTER TABLE run
+DROP CONSTRAINT run_end_reason_check,
+ADD CHECK (end_reason IN ('canceled', 'skipped'));
@@ -0,0 +1,13 @@
+-- migrate:up
+
+ALTER TABLE run
+ADD retry_of uuid REFERENCES run (nomad_job_id),
+ADD attempt int NOT NULL DEFAULT 1,
+ADD start_after timestamp;
+
+-- migrate:down
+
+ALTER TABLE run
+DROP retry_of,
+DROP attempt,
+DROP start_after;
@@ -0,0 +1,19 @@
+-- migrate:up
+
+ALTER TABLE run
+ADD nomad_cluster text NOT NULL DEFAULT 'default',
+ADD nomad_namespace text,
+ADD nomad_region text;
+
+ALTER TABLE nomad_event
+ADD cluster text NOT NULL DEFAULT 'default';
+
+-- migrate:down
+
+ALTER TABLE nomad_event
+DROP cluster;
+
+ALTER TABLE run
+DROP nomad_cluster,
+DROP nomad_namespace,
+DROP nomad_region;
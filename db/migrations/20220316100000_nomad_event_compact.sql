@@ -0,0 +1,44 @@
+-- migrate:up
+
+ALTER TABLE nomad_event
+ADD job_id uuid,
+ADD created_at timestamp NOT NULL DEFAULT STATEMENT_TIMESTAMP(),
+ALTER "index" TYPE bigint;
+
+UPDATE nomad_event
+SET job_id = (payload#>>'{Allocation,JobID}')::uuid
+WHERE topic = 'Allocation'
+	AND payload#>>'{Allocation,JobID}' ~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$';
+
+-- Only allocation updates of runs are relevant
+-- but the latest event of each cluster is needed to resume the stream.
+DELETE FROM nomad_event
+WHERE (
+		type <> 'AllocationUpdated'
+		OR NOT EXISTS (SELECT FROM run WHERE nomad_job_id = nomad_event.job_id)
+	)
+	AND (cluster, "index") NOT IN (
+		SELECT cluster, MAX("index") FROM nomad_event GROUP BY cluster
+	);
+
+-- The allocation's job is already stored with the run.
+UPDATE nomad_event
+SET payload = payload #- '{Allocation,Job}'
+WHERE payload ? 'Allocation';
+
+CREATE INDEX nomad_event_job_id_idx ON nomad_event (job_id, "index");
+CREATE INDEX nomad_event_cluster_idx ON nomad_event (cluster, "index");
+CREATE INDEX nomad_event_created_at_idx ON nomad_event (created_at);
+
+-- migrate:down
+
+-- Deleted events are not restored.
+
+DROP INDEX nomad_event_job_id_idx;
+DROP INDEX nomad_event_cluster_idx;
+DROP INDEX nomad_event_created_at_idx;
+
+ALTER TABLE nomad_event
+DROP job_id,
+DROP created_at,
+ALTER "index" TYPE integer;
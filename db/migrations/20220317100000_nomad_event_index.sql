@@ -0,0 +1,15 @@
+-- migrate:up
+
+-- The index up to which the event stream of each cluster was processed,
+-- independent of which events were stored.
+CREATE TABLE nomad_event_index (
+	cluster text PRIMARY KEY,
+	"index" bigint NOT NULL
+);
+
+INSERT INTO nomad_event_index (cluster, "index")
+SELECT cluster, MAX("index") FROM nomad_event GROUP BY cluster;
+
+-- migrate:down
+
+DROP TABLE nomad_event_index;
@@ -0,0 +1,13 @@
+-- migrate:up
+
+-- A branch is also published without a fact if it has no output.
+ALTER TABLE run_output
+DROP CONSTRAINT run_output_check,
+ADD CONSTRAINT run_output_fact_id_check CHECK (fact_id IS NULL OR published IN ('success', 'failure'));
+
+-- migrate:down
+
+-- Outputs published without a fact would violate the old constraint.
+ALTER TABLE run_output
+DROP CONSTRAINT run_output_fact_id_check,
+ADD CONSTRAINT run_output_check CHECK ((fact_id IS NULL) = (published IS NULL OR published = 'none')) NOT VALID;
@@ -46,8 +46,9 @@ job: cicero: group: cicero: {
 
 			command: [
 				"/bin/entrypoint",
-				"--prometheus-addr", #lokiAddr,
+				"--loki-addr", #lokiAddr,
 				"--transform", for t in _transformers { t.destination },
+				"--transformer-env", "NOMAD_ADDR", "NOMAD_TOKEN",
 				"--web-listen", ":${NOMAD_PORT_http}",
 			]
 		}
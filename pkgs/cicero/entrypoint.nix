@@ -11,6 +11,8 @@
 , dbmate
 , vault-bin
 , netcat
+, bubblewrap
+, util-linux
 , ...
 }:
 
@@ -28,6 +30,8 @@ writeShellScriptBin "entrypoint" ''
       dbmate
       vault-bin
       netcat
+      bubblewrap # for --evaluator-sandbox
+      util-linux # for --evaluator-memory-limit
     ]
   }"
 
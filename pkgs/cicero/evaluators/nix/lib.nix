@@ -215,7 +215,8 @@ rec {
 
         Same for the failure case and `/local/cicero/post-fact/failure/{fact,artifact}`.
 
-        Assumes `CICERO_API_URL` is set pointing to Cicero accessible from inside the cluster.
+        Assumes `CICERO_API_URL` is set pointing to Cicero accessible from inside the cluster,
+        which Cicero does if started with `--api-url` or `--web-url`.
       */
       postFact = action: inner:
         data-merge.merge
@@ -0,0 +1,46 @@
+package component
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/input-output-hk/cicero/src/application/service"
+)
+
+// Periodically syncs action sets that are due.
+type ActionSetSyncer struct {
+	Logger           zerolog.Logger
+	ActionSetService service.ActionSetService
+	// How often sets without match are synced, 0 for never.
+	Interval time.Duration
+}
+
+// How often to look for sets that are due at most.
+const actionSetSyncerPollInterval = time.Minute
+
+func (self *ActionSetSyncer) Start(ctx context.Context) error {
+	self.Logger.Info().Msg("Starting")
+
+	poll := actionSetSyncerPollInterval
+	if self.Interval > 0 && self.Interval < poll {
+		poll = self.Interval
+	}
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		if err := self.ActionSetService.SyncDue(self.Interval); err != nil {
+			return errors.WithMessage(err, "Error syncing Action Sets")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
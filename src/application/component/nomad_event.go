@@ -2,7 +2,6 @@ package component
 
 import (
 	"context"
-	"time"
 
 	"github.com/georgysavva/scany/pgxscan"
 	"github.com/google/uuid"
@@ -17,30 +16,35 @@ import (
 	"github.com/input-output-hk/cicero/src/domain"
 )
 
+// Consumes the events of one Nomad cluster.
 type NomadEventConsumer struct {
 	Logger            zerolog.Logger
+	Cluster           string
+	Clusters          application.NomadClusters
 	FactService       service.FactService
 	NomadEventService service.NomadEventService
 	RunService        service.RunService
 	Db                config.PgxIface
-	NomadClient       application.NomadClient
+	Executor          application.Executor
 }
 
 func (self *NomadEventConsumer) WithQuerier(querier config.PgxIface) *NomadEventConsumer {
 	return &NomadEventConsumer{
 		Logger:            self.Logger,
+		Cluster:           self.Cluster,
+		Clusters:          self.Clusters,
 		FactService:       self.FactService.WithQuerier(querier),
 		NomadEventService: self.NomadEventService.WithQuerier(querier),
 		RunService:        self.RunService.WithQuerier(querier),
 		Db:                querier,
-		NomadClient:       self.NomadClient,
+		Executor:          self.Executor,
 	}
 }
 
 func (self *NomadEventConsumer) Start(ctx context.Context) error {
 	self.Logger.Info().Msg("Starting")
 
-	index, err := self.NomadEventService.GetLastNomadEvent()
+	index, err := self.NomadEventService.GetLastNomadEvent(self.Cluster)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		return errors.WithMessage(err, "Could not get last Nomad event index")
 	}
@@ -48,7 +52,7 @@ func (self *NomadEventConsumer) Start(ctx context.Context) error {
 
 	self.Logger.Debug().Uint64("index", index).Msg("Listening to Nomad events")
 
-	stream, err := self.NomadClient.EventStream(ctx, index)
+	stream, err := self.Executor.EventStream(ctx, index)
 	if err != nil {
 		return errors.WithMessage(err, "Could not listen to Nomad events")
 	}
@@ -75,84 +79,150 @@ func (self *NomadEventConsumer) Start(ctx context.Context) error {
 			}
 		}
 
+		// also for batches without events of our runs so that we do not resume from an index Nomad no longer has
+		if err := self.NomadEventService.SaveLastNomadEvent(self.Cluster, events.Index); err != nil {
+			return err
+		}
+
 		index = events.Index
 	}
 }
 
+// Only allocation updates of Cicero's own runs are handled and stored.
 func (self *NomadEventConsumer) processNomadEvent(event *nomad.Event) error {
-	if err := self.handleNomadEvent(event); err != nil {
+	if event.Topic != nomad.TopicAllocation || event.Type != "AllocationUpdated" {
+		return nil
+	}
+
+	allocation, err := event.Allocation()
+	if err != nil {
+		return errors.WithMessage(err, "Error getting Nomad event's allocation")
+	}
+
+	run, err := self.getRunOfJob(allocation.JobID)
+	if err != nil || run == nil {
+		return err
+	}
+
+	if err := self.handleNomadAllocationEvent(allocation, run); err != nil {
 		return errors.WithMessage(err, "Error handling Nomad event")
 	}
-	if err := self.NomadEventService.Save(event); err != nil {
+	if err := self.NomadEventService.Save(self.Cluster, run.NomadJobID, event); err != nil {
 		return errors.WithMessage(err, "Error to save Nomad event")
 	}
 	return nil
 }
 
-func (self *NomadEventConsumer) handleNomadEvent(event *nomad.Event) error {
-	if event.Topic == "Allocation" && event.Type == "AllocationUpdated" {
-		allocation, err := event.Allocation()
-		if err != nil {
-			return errors.WithMessage(err, "Error getting Nomad event's allocation")
+// Returns nil if the job does not belong to a Run on this cluster.
+func (self *NomadEventConsumer) getRunOfJob(jobId string) (*domain.Run, error) {
+	id, err := uuid.Parse(jobId)
+	if err != nil {
+		return nil, nil
+	}
+
+	run, err := self.RunService.GetByNomadJobId(id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			self.Logger.Trace().Str("nomad-job-id", jobId).Msg("Ignoring Nomad event for Job (no such Run)")
+			return nil, nil
 		}
-		return self.handleNomadAllocationEvent(allocation)
+		return nil, err
 	}
-	return nil
+
+	if self.Clusters.Resolve(run.NomadCluster) != self.Cluster {
+		self.Logger.Debug().Str("nomad-job-id", jobId).Msg("Ignoring Nomad event for Job (Run is on another cluster)")
+		return nil, nil
+	}
+
+	return &run, nil
 }
 
-func (self *NomadEventConsumer) handleNomadAllocationEvent(allocation *nomad.Allocation) error {
+func (self *NomadEventConsumer) handleNomadAllocationEvent(allocation *nomad.Allocation, run *domain.Run) error {
 	if !allocation.ClientTerminalStatus() {
 		self.Logger.Debug().Str("ClientStatus", allocation.ClientStatus).Msg("Ignoring allocation event with non-terminal client status")
 		return nil
 	}
 
-	id, err := uuid.Parse(allocation.JobID)
-	if err != nil {
+	if run.FinishedAt != nil {
+		self.Logger.Debug().Str("nomad-job-id", allocation.JobID).Msg("Ignoring Nomad event for Job (Run already ended)")
 		return nil
 	}
 
-	run, err := self.RunService.GetByNomadJobId(id)
+	// The Run ends only once all allocations of its job are done.
+	state, err := getNomadRunState(self.Executor, run)
 	if err != nil {
-		if pgxscan.NotFound(err) {
-			self.Logger.Debug().Str("nomad-job-id", allocation.JobID).Msg("Ignoring Nomad event for Job (no such Run)")
-			return nil
-		}
-		return err
+		return errors.WithMessagef(err, "Could not get state of Nomad job with ID %q", allocation.JobID)
+	} else if !state.ended {
+		self.Logger.Debug().Str("nomad-job-id", allocation.JobID).Msg("Waiting for other allocations of Job")
+		return nil
 	}
 
-	if output, err := self.RunService.GetOutputByNomadJobId(id); err != nil && !pgxscan.NotFound(err) {
+	return endRun(self.RunService, self.FactService, self.Executor, run, state.nomadJobOutcome)
+}
+
+// Publishes the output of the given outcome, ends the Run and deregisters its Nomad job.
+// Failed Runs that are retried publish nothing.
+func endRun(runService service.RunService, factService service.FactService, executor application.Executor, run *domain.Run, outcome nomadJobOutcome) error {
+	branch := outcome.outcome
+	var output *domain.RunOutput
+	if output_, err := runService.GetOutputByNomadJobId(run.NomadJobID); err != nil && !pgxscan.NotFound(err) {
 		return err
-	} else {
-		var factValue *interface{}
-		for _, state := range allocation.TaskStates {
-			if state.Failed {
-				factValue = output.Failure
-			} else {
-				factValue = output.Success
+	} else if err == nil {
+		output = &output_
+	}
+
+	var attempt *domain.Run
+
+	// The output was already published if the Run was canceled.
+	if output != nil && output.Published == nil {
+		if branch == domain.RunOutputPublishedFailure {
+			var err error
+			if attempt, err = runService.NextAttempt(run, outcome.exitCodes, outcome.lost); err != nil {
+				return errors.WithMessagef(err, "Could not get next attempt of Run with ID %q", run.NomadJobID)
+			} else if attempt != nil {
+				branch = domain.RunOutputPublishedNone
 			}
 		}
+
+		var factValue *interface{}
+		switch branch {
+		case domain.RunOutputPublishedSuccess:
+			factValue = output.Success
+		case domain.RunOutputPublishedFailure:
+			factValue = output.Failure
+		}
+
+		var fact *domain.Fact
 		if factValue != nil {
-			fact := domain.Fact{
+			fact = &domain.Fact{
 				RunId: &run.NomadJobID,
 				Value: factValue,
 			}
-			if err := self.FactService.Save(&fact, nil); err != nil {
+			if err := factService.Save(fact, nil); err != nil {
 				return errors.WithMessage(err, "Could not publish Fact")
 			}
 		}
+
+		output.Publish(branch, fact)
+	} else {
+		// nothing to update
+		output = nil
 	}
 
-	modifyTime := time.Unix(
-		allocation.ModifyTime/int64(time.Second),
-		allocation.ModifyTime%int64(time.Second),
-	).UTC()
-	run.FinishedAt = &modifyTime
+	run.FinishedAt = &outcome.finishedAt
 
-	if err := self.RunService.End(&run); err != nil {
+	if err := runService.End(run, output); err != nil {
 		return errors.WithMessagef(err, "Failed to end Run with ID %q", run.NomadJobID)
 	}
 
-	if _, _, err := self.NomadClient.JobsDeregister(run.NomadJobID.String(), false, &nomad.WriteOptions{}); err != nil {
+	// only now that the Run no longer counts as running
+	if attempt != nil {
+		if err := runService.Retry(run, attempt); err != nil {
+			return errors.WithMessagef(err, "Could not retry Run with ID %q", run.NomadJobID)
+		}
+	}
+
+	if _, _, err := executor.JobsDeregister(run.NomadJobID.String(), false, run.NomadWriteOptions()); err != nil {
 		return errors.WithMessagef(err, "Failed to deregister Nomad job with ID %q", run.NomadJobID)
 	}
 
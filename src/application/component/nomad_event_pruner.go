@@ -0,0 +1,39 @@
+package component
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/input-output-hk/cicero/src/application/service"
+)
+
+// Periodically deletes stored Nomad events that are older than the retention.
+type NomadEventPruner struct {
+	Logger            zerolog.Logger
+	NomadEventService service.NomadEventService
+	Retention         time.Duration
+}
+
+const nomadEventPrunerInterval = time.Hour
+
+func (self *NomadEventPruner) Start(ctx context.Context) error {
+	self.Logger.Info().Msg("Starting")
+
+	ticker := time.NewTicker(nomadEventPrunerInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := self.NomadEventService.DeleteOlderThan(time.Now().UTC().Add(-self.Retention)); err != nil {
+			return errors.WithMessage(err, "Error pruning Nomad events")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
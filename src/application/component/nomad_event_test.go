@@ -0,0 +1,104 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pashagolub/pgxmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/application/service"
+	"github.com/input-output-hk/cicero/src/config"
+)
+
+// Streams the given batches of events.
+type fakeStreamExecutor struct {
+	fakeExecutor
+
+	batches []*nomad.Events
+	index   uint64
+}
+
+func (self *fakeStreamExecutor) EventStream(_ context.Context, index uint64) (<-chan *nomad.Events, error) {
+	self.index = index
+	stream := make(chan *nomad.Events, len(self.batches))
+	for _, batch := range self.batches {
+		stream <- batch
+	}
+	return stream, nil
+}
+
+// Calling methods that are not overridden panics.
+type fakeNomadEventService struct {
+	service.NomadEventService
+
+	last  uint64
+	saved []uint64
+}
+
+func (self *fakeNomadEventService) WithQuerier(config.PgxIface) service.NomadEventService {
+	return self
+}
+
+func (self *fakeNomadEventService) GetLastNomadEvent(string) (uint64, error) {
+	return self.last, nil
+}
+
+func (self *fakeNomadEventService) SaveLastNomadEvent(_ string, index uint64) error {
+	self.saved = append(self.saved, index)
+	return nil
+}
+
+type fakeFactService struct{ service.FactService }
+
+func (self fakeFactService) WithQuerier(config.PgxIface) service.FactService {
+	return self
+}
+
+type fakeRunService struct{ service.RunService }
+
+func (self fakeRunService) WithQuerier(config.PgxIface) service.RunService {
+	return self
+}
+
+func TestShouldSaveLastNomadEventWithoutStoredEvents(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	streamErr := errors.New("stream closed")
+	executor := &fakeStreamExecutor{batches: []*nomad.Events{
+		{Index: 41, Events: []nomad.Event{{Topic: nomad.TopicAllocation, Index: 41}}},
+		{Index: 43, Events: []nomad.Event{{Topic: nomad.TopicNode, Type: "NodeRegistration", Index: 43}}},
+		{Err: streamErr},
+	}}
+	nomadEventService := &fakeNomadEventService{last: 41}
+
+	consumer := &NomadEventConsumer{
+		Logger:            zerolog.Nop(),
+		Cluster:           "ci",
+		FactService:       fakeFactService{},
+		NomadEventService: nomadEventService,
+		RunService:        fakeRunService{},
+		Db:                mock,
+		Executor:          executor,
+	}
+
+	// when
+	err = consumer.Start(context.Background())
+
+	// then
+	assert.True(t, errors.Is(err, streamErr))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, uint64(42), executor.index)
+	assert.Equal(t, []uint64{43}, nomadEventService.saved, "the repeated last event should be skipped")
+}
@@ -0,0 +1,153 @@
+package component
+
+import (
+	"time"
+
+	nomad "github.com/hashicorp/nomad/api"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// The outcome of a Nomad job as far as it is known.
+type nomadJobOutcome struct {
+	// All allocations the job needs are terminal.
+	ended bool
+	// Success if all main tasks of all allocations succeeded.
+	outcome    domain.RunOutputPublished
+	finishedAt time.Time
+	// The exit codes of main tasks that failed.
+	exitCodes []int
+	// Whether any allocation was lost.
+	lost bool
+}
+
+// Decides whether a job ended and whether it succeeded from its allocations.
+//
+// Allocations that were replaced by a rescheduled one are ignored.
+// A failed allocation is not final while it awaits rescheduling,
+// that is while it has a follow-up evaluation or is among the given ones
+// that are marked for rescheduling by their desired transition.
+// The job ended once every task group has as many terminal allocations as its count
+// or, if the job was stopped, once all its allocations are terminal.
+// It succeeded if no allocation was lost and all main tasks succeeded.
+// Lifecycle tasks like prestart tasks or sidecars do not count.
+func getNomadJobOutcome(job *nomad.Job, allocs []*nomad.AllocationListStub, rescheduling map[string]struct{}) (result nomadJobOutcome) {
+	replaced := map[string]struct{}{}
+	for _, alloc := range allocs {
+		if alloc.RescheduleTracker == nil {
+			continue
+		}
+		for _, event := range alloc.RescheduleTracker.Events {
+			replaced[event.PrevAllocID] = struct{}{}
+		}
+	}
+
+	groups := map[string]*nomad.TaskGroup{}
+	for _, group := range job.TaskGroups {
+		if group.Name != nil {
+			groups[*group.Name] = group
+		}
+	}
+
+	current := []*nomad.AllocationListStub{}
+	allocsPerGroup := map[string]int{}
+	for _, alloc := range allocs {
+		if _, isReplaced := replaced[alloc.ID]; isReplaced {
+			continue
+		}
+
+		switch alloc.ClientStatus {
+		case nomad.AllocClientStatusFailed:
+			if _, isRescheduling := rescheduling[alloc.ID]; isRescheduling || alloc.FollowupEvalID != "" {
+				return
+			}
+		case nomad.AllocClientStatusComplete, nomad.AllocClientStatusLost:
+		default:
+			return
+		}
+
+		current = append(current, alloc)
+		allocsPerGroup[alloc.TaskGroup]++
+	}
+
+	if job.Stop == nil || !*job.Stop {
+		for name, group := range groups {
+			count := 1
+			if group.Count != nil {
+				count = *group.Count
+			}
+			if allocsPerGroup[name] < count {
+				return
+			}
+		}
+	}
+
+	if len(current) == 0 {
+		if job.Stop == nil || !*job.Stop {
+			return
+		}
+		result.ended = true
+		result.outcome = domain.RunOutputPublishedNone
+		return
+	}
+
+	result.ended = true
+	result.outcome = domain.RunOutputPublishedSuccess
+
+	for _, alloc := range current {
+		if finishedAt := time.Unix(0, alloc.ModifyTime).UTC(); finishedAt.After(result.finishedAt) {
+			result.finishedAt = finishedAt
+		}
+
+		if alloc.ClientStatus == nomad.AllocClientStatusLost {
+			result.lost = true
+			result.outcome = domain.RunOutputPublishedFailure
+		}
+
+		for _, state := range mainTaskStates(alloc, groups[alloc.TaskGroup]) {
+			// a task that never ran did not succeed
+			if state == nil || state.Failed {
+				result.outcome = domain.RunOutputPublishedFailure
+			}
+			if state != nil && state.Failed {
+				if exitCode, exists := taskExitCode(state); exists {
+					result.exitCodes = append(result.exitCodes, exitCode)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// Returns the states of an allocation's main tasks, nil for those that never ran.
+func mainTaskStates(alloc *nomad.AllocationListStub, group *nomad.TaskGroup) []*nomad.TaskState {
+	states := []*nomad.TaskState{}
+
+	// Without the group's spec we cannot tell main tasks apart.
+	if group == nil {
+		for _, state := range alloc.TaskStates {
+			states = append(states, state)
+		}
+		return states
+	}
+
+	for _, task := range group.Tasks {
+		if task.Lifecycle != nil && task.Lifecycle.Hook != "" {
+			continue
+		}
+		states = append(states, alloc.TaskStates[task.Name])
+	}
+
+	return states
+}
+
+// Returns the exit code of the task's last termination.
+func taskExitCode(state *nomad.TaskState) (int, bool) {
+	for i := len(state.Events) - 1; i >= 0; i-- {
+		if event := state.Events[i]; event.Type == nomad.TaskTerminated {
+			return event.ExitCode, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,188 @@
+package component
+
+import (
+	"testing"
+	"time"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func testNomadJob(stop bool, groups ...*nomad.TaskGroup) *nomad.Job {
+	return &nomad.Job{Stop: &stop, TaskGroups: groups}
+}
+
+func testNomadTaskGroup(name string, count int, tasks ...*nomad.Task) *nomad.TaskGroup {
+	return &nomad.TaskGroup{Name: &name, Count: &count, Tasks: tasks}
+}
+
+func testNomadAlloc(id, group, status string, modifyTime time.Time, failed map[string]bool) *nomad.AllocationListStub {
+	alloc := &nomad.AllocationListStub{
+		ID:           id,
+		TaskGroup:    group,
+		ClientStatus: status,
+		ModifyTime:   modifyTime.UnixNano(),
+		TaskStates:   map[string]*nomad.TaskState{},
+	}
+	for task, failed := range failed {
+		alloc.TaskStates[task] = &nomad.TaskState{State: "dead", Failed: failed}
+	}
+	return alloc
+}
+
+func TestShouldGetNomadJobOutcome(t *testing.T) {
+	t.Parallel()
+
+	t1 := time.Date(2022, 3, 14, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+
+	const (
+		complete = nomad.AllocClientStatusComplete
+		failed   = nomad.AllocClientStatusFailed
+		lost     = nomad.AllocClientStatusLost
+		running  = nomad.AllocClientStatusRunning
+	)
+
+	main := &nomad.Task{Name: "main"}
+	prestart := &nomad.Task{Name: "prestart", Lifecycle: &nomad.TaskLifecycle{Hook: nomad.TaskLifecycleHookPrestart}}
+	sidecar := &nomad.Task{Name: "sidecar", Lifecycle: &nomad.TaskLifecycle{Hook: nomad.TaskLifecycleHookPrestart, Sidecar: true}}
+
+	ended := func(outcome domain.RunOutputPublished, finishedAt time.Time) nomadJobOutcome {
+		return nomadJobOutcome{ended: true, outcome: outcome, finishedAt: finishedAt}
+	}
+
+	for name, test := range map[string]struct {
+		job          *nomad.Job
+		allocs       []*nomad.AllocationListStub
+		rescheduling map[string]struct{}
+		expected     nomadJobOutcome
+	}{
+		"single task succeeded": {
+			job:      testNomadJob(false, testNomadTaskGroup("a", 1, main)),
+			allocs:   []*nomad.AllocationListStub{testNomadAlloc("1", "a", complete, t1, map[string]bool{"main": false})},
+			expected: ended(domain.RunOutputPublishedSuccess, t1),
+		},
+		"single task failed": {
+			job:      testNomadJob(false, testNomadTaskGroup("a", 1, main)),
+			allocs:   []*nomad.AllocationListStub{testNomadAlloc("1", "a", failed, t1, map[string]bool{"main": true})},
+			expected: ended(domain.RunOutputPublishedFailure, t1),
+		},
+		"failed sidecar is ignored": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 1, prestart, sidecar, main)),
+			allocs: []*nomad.AllocationListStub{testNomadAlloc("1", "a", complete, t1, map[string]bool{
+				"prestart": false, "sidecar": true, "main": false,
+			})},
+			expected: ended(domain.RunOutputPublishedSuccess, t1),
+		},
+		"main task never ran because prestart task failed": {
+			job:      testNomadJob(false, testNomadTaskGroup("a", 1, prestart, main)),
+			allocs:   []*nomad.AllocationListStub{testNomadAlloc("1", "a", failed, t1, map[string]bool{"prestart": true})},
+			expected: ended(domain.RunOutputPublishedFailure, t1),
+		},
+		"one of several allocations still running": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 2, main)),
+			allocs: []*nomad.AllocationListStub{
+				testNomadAlloc("1", "a", complete, t1, map[string]bool{"main": false}),
+				testNomadAlloc("2", "a", running, t1, nil),
+			},
+			expected: nomadJobOutcome{},
+		},
+		"not all allocations placed yet": {
+			job:      testNomadJob(false, testNomadTaskGroup("a", 2, main)),
+			allocs:   []*nomad.AllocationListStub{testNomadAlloc("1", "a", complete, t1, map[string]bool{"main": false})},
+			expected: nomadJobOutcome{},
+		},
+		"one of several groups failed": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 1, main), testNomadTaskGroup("b", 1, main)),
+			allocs: []*nomad.AllocationListStub{
+				testNomadAlloc("1", "a", complete, t2, map[string]bool{"main": false}),
+				testNomadAlloc("2", "b", failed, t1, map[string]bool{"main": true}),
+			},
+			expected: ended(domain.RunOutputPublishedFailure, t2),
+		},
+		"all of several allocations succeeded": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 2, main), testNomadTaskGroup("b", 1, main)),
+			allocs: []*nomad.AllocationListStub{
+				testNomadAlloc("1", "a", complete, t1, map[string]bool{"main": false}),
+				testNomadAlloc("2", "a", complete, t2, map[string]bool{"main": false}),
+				testNomadAlloc("3", "b", complete, t1, map[string]bool{"main": false}),
+			},
+			expected: ended(domain.RunOutputPublishedSuccess, t2),
+		},
+		"failed allocation was rescheduled and succeeded": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 1, main)),
+			allocs: []*nomad.AllocationListStub{
+				testNomadAlloc("1", "a", failed, t1, map[string]bool{"main": true}),
+				func() *nomad.AllocationListStub {
+					alloc := testNomadAlloc("2", "a", complete, t2, map[string]bool{"main": false})
+					alloc.RescheduleTracker = &nomad.RescheduleTracker{Events: []*nomad.RescheduleEvent{{PrevAllocID: "1"}}}
+					return alloc
+				}(),
+			},
+			expected: ended(domain.RunOutputPublishedSuccess, t2),
+		},
+		"failed allocation is being rescheduled": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 1, main)),
+			allocs: []*nomad.AllocationListStub{
+				testNomadAlloc("1", "a", failed, t1, map[string]bool{"main": true}),
+				func() *nomad.AllocationListStub {
+					alloc := testNomadAlloc("2", "a", running, t2, nil)
+					alloc.RescheduleTracker = &nomad.RescheduleTracker{Events: []*nomad.RescheduleEvent{{PrevAllocID: "1"}}}
+					return alloc
+				}(),
+			},
+			expected: nomadJobOutcome{},
+		},
+		"failed allocation awaits rescheduling by follow-up evaluation": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 1, main)),
+			allocs: []*nomad.AllocationListStub{func() *nomad.AllocationListStub {
+				alloc := testNomadAlloc("1", "a", failed, t1, map[string]bool{"main": true})
+				alloc.FollowupEvalID = "eval"
+				return alloc
+			}()},
+			expected: nomadJobOutcome{},
+		},
+		"failed allocation is marked for rescheduling": {
+			job:          testNomadJob(false, testNomadTaskGroup("a", 1, main)),
+			allocs:       []*nomad.AllocationListStub{testNomadAlloc("1", "a", failed, t1, map[string]bool{"main": true})},
+			rescheduling: map[string]struct{}{"1": {}},
+			expected:     nomadJobOutcome{},
+		},
+		"allocation was lost": {
+			job:      testNomadJob(false, testNomadTaskGroup("a", 1, main)),
+			allocs:   []*nomad.AllocationListStub{testNomadAlloc("1", "a", lost, t1, map[string]bool{"main": false})},
+			expected: nomadJobOutcome{ended: true, outcome: domain.RunOutputPublishedFailure, finishedAt: t1, lost: true},
+		},
+		"exit codes of failed main tasks": {
+			job: testNomadJob(false, testNomadTaskGroup("a", 1, sidecar, main)),
+			allocs: []*nomad.AllocationListStub{func() *nomad.AllocationListStub {
+				alloc := testNomadAlloc("1", "a", failed, t1, map[string]bool{"sidecar": true, "main": true})
+				alloc.TaskStates["sidecar"].Events = []*nomad.TaskEvent{{Type: nomad.TaskTerminated, ExitCode: 137}}
+				alloc.TaskStates["main"].Events = []*nomad.TaskEvent{
+					{Type: nomad.TaskTerminated, ExitCode: 1},
+					{Type: nomad.TaskRestarting},
+					{Type: nomad.TaskTerminated, ExitCode: 2},
+				}
+				return alloc
+			}()},
+			expected: nomadJobOutcome{ended: true, outcome: domain.RunOutputPublishedFailure, finishedAt: t1, exitCodes: []int{2}},
+		},
+		"stopped before any allocation was placed": {
+			job:      testNomadJob(true, testNomadTaskGroup("a", 1, main)),
+			expected: ended(domain.RunOutputPublishedNone, time.Time{}),
+		},
+		"stopped with fewer allocations than count": {
+			job:      testNomadJob(true, testNomadTaskGroup("a", 2, main)),
+			allocs:   []*nomad.AllocationListStub{testNomadAlloc("1", "a", complete, t1, map[string]bool{"main": false})},
+			expected: ended(domain.RunOutputPublishedSuccess, t1),
+		},
+	} {
+		// when
+		outcome := getNomadJobOutcome(test.job, test.allocs, test.rescheduling)
+
+		// then
+		assert.Equal(t, test.expected, outcome, name)
+	}
+}
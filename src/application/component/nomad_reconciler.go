@@ -0,0 +1,175 @@
+package component
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/pgxscan"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/input-output-hk/cicero/src/application"
+	"github.com/input-output-hk/cicero/src/application/service"
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// Ends runs whose terminal Nomad events were missed,
+// for example because Cicero was down longer than Nomad keeps events.
+// Only reconciles runs on its own cluster.
+type NomadReconciler struct {
+	Logger      zerolog.Logger
+	Cluster     string
+	Clusters    application.NomadClusters
+	RunService  service.RunService
+	FactService service.FactService
+	Executor    application.Executor
+	Db          config.PgxIface
+	// How often to reconcile after the initial reconciliation at startup.
+	Interval time.Duration
+}
+
+func (self *NomadReconciler) WithQuerier(querier config.PgxIface) *NomadReconciler {
+	return &NomadReconciler{
+		Logger:      self.Logger,
+		Cluster:     self.Cluster,
+		Clusters:    self.Clusters,
+		RunService:  self.RunService.WithQuerier(querier),
+		FactService: self.FactService.WithQuerier(querier),
+		Executor:    self.Executor,
+		Db:          querier,
+		Interval:    self.Interval,
+	}
+}
+
+func (self *NomadReconciler) Start(ctx context.Context) error {
+	self.Logger.Info().Msg("Starting")
+
+	var tick <-chan time.Time
+	if self.Interval > 0 {
+		ticker := time.NewTicker(self.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		if err := self.reconcile(ctx); err != nil {
+			return errors.WithMessage(err, "Error reconciling Runs with Nomad")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+		}
+	}
+}
+
+func (self *NomadReconciler) reconcile(ctx context.Context) error {
+	runs, err := self.RunService.GetRunning()
+	if err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		if self.Clusters.Resolve(run.NomadCluster) != self.Cluster {
+			continue
+		}
+
+		if err := self.Db.BeginFunc(ctx, func(tx pgx.Tx) error {
+			return self.WithQuerier(tx).reconcileRun(run)
+		}); err != nil {
+			return errors.WithMessagef(err, "Could not reconcile Run with ID %q", run.NomadJobID)
+		}
+	}
+
+	return nil
+}
+
+func (self *NomadReconciler) reconcileRun(run *domain.Run) error {
+	state, err := getNomadRunState(self.Executor, run)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case state.lost:
+		self.Logger.Info().Str("id", run.NomadJobID.String()).Msg("Run was lost")
+		return self.endLostRun(run)
+	case state.ended:
+		self.Logger.Info().Str("id", run.NomadJobID.String()).Msg("Ending Run whose events were missed")
+		return endRun(self.RunService, self.FactService, self.Executor, run, state.nomadJobOutcome)
+	}
+
+	return nil
+}
+
+// What Nomad knows about a run.
+type nomadRunState struct {
+	// Nomad does not know the job.
+	lost bool
+	nomadJobOutcome
+}
+
+func getNomadRunState(client application.Executor, run *domain.Run) (state nomadRunState, err error) {
+	jobId := run.NomadJobID.String()
+
+	job, _, err := client.JobsInfo(jobId, run.NomadQueryOptions())
+	if err != nil {
+		if application.IsNomadNotFound(err) {
+			state.lost = true
+			err = nil
+		}
+		return
+	}
+
+	allocs, _, err := client.JobsAllocations(jobId, true, run.NomadQueryOptions())
+	if err != nil {
+		return
+	}
+
+	// Stubs lack the desired transition so failed allocations are looked up.
+	rescheduling := map[string]struct{}{}
+	for _, alloc := range allocs {
+		if alloc.ClientStatus != nomad.AllocClientStatusFailed || alloc.FollowupEvalID != "" {
+			continue
+		}
+
+		var info *nomad.Allocation
+		if info, _, err = client.AllocationsInfo(alloc.ID, run.NomadQueryOptions()); err != nil {
+			if !application.IsNomadNotFound(err) {
+				return
+			}
+			// garbage collected so it will not be rescheduled
+			err = nil
+		} else if reschedule := info.DesiredTransition.Reschedule; reschedule != nil && *reschedule {
+			rescheduling[alloc.ID] = struct{}{}
+		}
+	}
+
+	state.nomadJobOutcome = getNomadJobOutcome(job, allocs, rescheduling)
+
+	return
+}
+
+func (self *NomadReconciler) endLostRun(run *domain.Run) error {
+	var output *domain.RunOutput
+	if output_, err := self.RunService.GetOutputByNomadJobId(run.NomadJobID); err != nil && !pgxscan.NotFound(err) {
+		return err
+	} else if err == nil && output_.Published == nil {
+		output_.Publish(domain.RunOutputPublishedNone, nil)
+		output = &output_
+	}
+
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+	// keep why a canceled Run ended
+	if run.EndReason == nil {
+		reason := domain.RunEndReasonLost
+		run.EndReason = &reason
+	}
+
+	return self.RunService.End(run, output)
+}
@@ -0,0 +1,130 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// An Executor that knows a fixed set of jobs and their allocations.
+type fakeExecutor struct {
+	jobs   map[string]*nomad.Job
+	allocs map[string][]*nomad.AllocationListStub
+	// whole allocations by ID
+	allocInfos map[string]*nomad.Allocation
+}
+
+func (self *fakeExecutor) EventStream(context.Context, uint64) (<-chan *nomad.Events, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (self *fakeExecutor) JobsRegister(*nomad.Job, *nomad.WriteOptions) (*nomad.JobRegisterResponse, *nomad.WriteMeta, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (self *fakeExecutor) JobsDeregister(string, bool, *nomad.WriteOptions) (string, *nomad.WriteMeta, error) {
+	return "", nil, nil
+}
+
+func (self *fakeExecutor) JobsInfo(jobID string, _ *nomad.QueryOptions) (*nomad.Job, *nomad.QueryMeta, error) {
+	if job, exists := self.jobs[jobID]; !exists {
+		return nil, nil, errors.New("Unexpected response code: 404 (job not found)")
+	} else {
+		return job, nil, nil
+	}
+}
+
+func (self *fakeExecutor) JobsAllocations(jobID string, _ bool, _ *nomad.QueryOptions) ([]*nomad.AllocationListStub, *nomad.QueryMeta, error) {
+	return self.allocs[jobID], nil, nil
+}
+
+func (self *fakeExecutor) AllocationsInfo(allocID string, _ *nomad.QueryOptions) (*nomad.Allocation, *nomad.QueryMeta, error) {
+	if alloc, exists := self.allocInfos[allocID]; exists {
+		return alloc, nil, nil
+	}
+	return nil, nil, errors.New("Unexpected response code: 404 (alloc not found)")
+}
+
+func (self *fakeExecutor) AllocLogs(string, string, string, bool, string, *nomad.QueryOptions) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestShouldGetRunStateFromNomad(t *testing.T) {
+	t.Parallel()
+
+	finished := time.Date(2022, 3, 13, 10, 0, 0, 0, time.UTC)
+
+	reschedule := true
+
+	for name, test := range map[string]struct {
+		allocs     []*nomad.AllocationListStub
+		allocInfos map[string]*nomad.Allocation
+		unknown    bool
+		expected   nomadRunState
+	}{
+		"lost": {
+			unknown:  true,
+			expected: nomadRunState{lost: true},
+		},
+		"not placed": {
+			allocs:   []*nomad.AllocationListStub{},
+			expected: nomadRunState{},
+		},
+		"running": {
+			allocs: []*nomad.AllocationListStub{
+				{ClientStatus: nomad.AllocClientStatusFailed, TaskStates: map[string]*nomad.TaskState{"a": {Failed: true}}},
+				{ClientStatus: nomad.AllocClientStatusRunning},
+			},
+			expected: nomadRunState{},
+		},
+		"complete": {
+			allocs: []*nomad.AllocationListStub{
+				{ClientStatus: nomad.AllocClientStatusComplete, ModifyTime: finished.UnixNano(), TaskStates: map[string]*nomad.TaskState{"a": {}}},
+			},
+			expected: nomadRunState{nomadJobOutcome: nomadJobOutcome{ended: true, outcome: domain.RunOutputPublishedSuccess, finishedAt: finished}},
+		},
+		"failed": {
+			allocs: []*nomad.AllocationListStub{
+				{ClientStatus: nomad.AllocClientStatusFailed, ModifyTime: finished.UnixNano(), TaskStates: map[string]*nomad.TaskState{"a": {Failed: true}}},
+			},
+			expected: nomadRunState{nomadJobOutcome: nomadJobOutcome{ended: true, outcome: domain.RunOutputPublishedFailure, finishedAt: finished}},
+		},
+		"failed and marked for rescheduling": {
+			allocs: []*nomad.AllocationListStub{
+				{ID: "a", ClientStatus: nomad.AllocClientStatusFailed, ModifyTime: finished.UnixNano(), TaskStates: map[string]*nomad.TaskState{"a": {Failed: true}}},
+			},
+			allocInfos: map[string]*nomad.Allocation{
+				"a": {ID: "a", DesiredTransition: nomad.DesiredTransition{Reschedule: &reschedule}},
+			},
+			expected: nomadRunState{},
+		},
+	} {
+		// given
+		run := domain.Run{NomadJobID: uuid.New()}
+		jobId := run.NomadJobID.String()
+		client := fakeExecutor{
+			jobs:       map[string]*nomad.Job{},
+			allocs:     map[string][]*nomad.AllocationListStub{},
+			allocInfos: test.allocInfos,
+		}
+		if !test.unknown {
+			client.jobs[jobId] = &nomad.Job{ID: &jobId}
+			client.allocs[jobId] = test.allocs
+		}
+
+		// when
+		state, err := getNomadRunState(&client, &run)
+
+		// then
+		assert.NoError(t, err, name)
+		assert.Equal(t, test.expected, state, name)
+	}
+}
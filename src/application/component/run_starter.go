@@ -0,0 +1,39 @@
+package component
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/input-output-hk/cicero/src/application/service"
+)
+
+// Periodically starts queued runs that may start now, like retries whose backoff is over.
+// Runs alongside the consumers of Nomad events as those create retries.
+type RunStarter struct {
+	Logger     zerolog.Logger
+	RunService service.RunService
+}
+
+const runStarterInterval = 10 * time.Second
+
+func (self *RunStarter) Start(ctx context.Context) error {
+	self.Logger.Info().Msg("Starting")
+
+	ticker := time.NewTicker(runStarterInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := self.RunService.StartDue(); err != nil {
+			return errors.WithMessage(err, "Error starting due Runs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package component
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/input-output-hk/cicero/src/application/service"
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// Periodically times out runs that take too long,
+// for example because their Nomad job hangs or an event was missed.
+type RunWatchdog struct {
+	Logger        zerolog.Logger
+	RunService    service.RunService
+	ActionService service.ActionService
+	FactService   service.FactService
+	Db            config.PgxIface
+	// Max duration of runs of actions without a timeout of their own, 0 for none.
+	Timeout time.Duration
+	// Whether to publish the failure output as a fact when a run exceeds Timeout.
+	PublishFailure bool
+}
+
+const runWatchdogInterval = time.Minute
+
+func (self *RunWatchdog) WithQuerier(querier config.PgxIface) *RunWatchdog {
+	return &RunWatchdog{
+		Logger:         self.Logger,
+		RunService:     self.RunService.WithQuerier(querier),
+		ActionService:  self.ActionService.WithQuerier(querier),
+		FactService:    self.FactService.WithQuerier(querier),
+		Db:             querier,
+		Timeout:        self.Timeout,
+		PublishFailure: self.PublishFailure,
+	}
+}
+
+func (self *RunWatchdog) Start(ctx context.Context) error {
+	self.Logger.Info().Msg("Starting")
+
+	ticker := time.NewTicker(runWatchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := self.timeOutOverdue(ctx); err != nil {
+			return errors.WithMessage(err, "Error timing out Runs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Failing to time out a run is logged so that the others are still timed out.
+func (self *RunWatchdog) timeOutOverdue(ctx context.Context) error {
+	runs, err := self.RunService.GetRunning()
+	if err != nil {
+		return err
+	}
+
+	timeouts := map[uuid.UUID]*domain.ActionTimeout{}
+
+	for _, run := range runs {
+		timeout, exists := timeouts[run.ActionId]
+		if !exists {
+			if timeout, err = self.getTimeout(run.ActionId); err != nil {
+				self.Logger.Err(err).Str("id", run.NomadJobID.String()).Msg("Could not get timeout of Run")
+				continue
+			}
+			timeouts[run.ActionId] = timeout
+		}
+
+		if timeout == nil || time.Since(*run.StartedAt) < timeout.After {
+			continue
+		}
+
+		if err := self.Db.BeginFunc(ctx, func(tx pgx.Tx) error {
+			return self.WithQuerier(tx).timeOut(run, timeout.PublishFailure)
+		}); err != nil {
+			self.Logger.Err(err).Str("id", run.NomadJobID.String()).Msg("Failed to time out Run")
+		}
+	}
+
+	return nil
+}
+
+// Returns the timeout of the action or the default one.
+func (self *RunWatchdog) getTimeout(actionId uuid.UUID) (*domain.ActionTimeout, error) {
+	action, err := self.ActionService.GetById(actionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout, err := action.Timeout(); err != nil {
+		self.Logger.Warn().Err(err).Str("action-id", actionId.String()).Msg("Falling back to default timeout")
+	} else if timeout != nil {
+		return timeout, nil
+	}
+
+	if self.Timeout == 0 {
+		return nil, nil
+	}
+	return &domain.ActionTimeout{After: self.Timeout, PublishFailure: self.PublishFailure}, nil
+}
+
+func (self *RunWatchdog) timeOut(run *domain.Run, publishFailure bool) error {
+	self.Logger.Info().Str("id", run.NomadJobID.String()).Msg("Run timed out")
+
+	var output *domain.RunOutput
+	if output_, err := self.RunService.GetOutputByNomadJobId(run.NomadJobID); err != nil && !pgxscan.NotFound(err) {
+		return err
+	} else if err == nil && output_.Published == nil {
+		output = &output_
+	}
+
+	// A canceled Run's output is published already.
+	if output != nil {
+		if publishFailure && output.Failure != nil {
+			fact := &domain.Fact{
+				RunId: &run.NomadJobID,
+				Value: output.Failure,
+			}
+			if err := self.FactService.Save(fact, nil); err != nil {
+				return errors.WithMessage(err, "Could not publish Fact")
+			}
+			output.Publish(domain.RunOutputPublishedFailure, fact)
+		} else {
+			output.Publish(domain.RunOutputPublishedNone, nil)
+		}
+	}
+
+	return self.RunService.TimeOut(run, output)
+}
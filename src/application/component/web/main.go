@@ -3,6 +3,7 @@ package web
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -17,6 +18,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/input-output-hk/cicero/src/application"
 	"github.com/input-output-hk/cicero/src/application/component/web/apidoc"
 	"github.com/input-output-hk/cicero/src/application/service"
 	"github.com/input-output-hk/cicero/src/config"
@@ -32,6 +34,7 @@ type Web struct {
 	FactService       service.FactService
 	NomadEventService service.NomadEventService
 	EvaluationService service.EvaluationService
+	ActionSetService  service.ActionSetService
 	Db                config.PgxIface
 }
 
@@ -131,6 +134,79 @@ func (self *Web) Start(ctx context.Context) error {
 	); err != nil {
 		return err
 	}
+	if _, err := r.AddRoute(http.MethodPost,
+		"/api/action/{id}/refresh",
+		self.ApiActionIdRefreshPost,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of the action", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.Action{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodPost,
+		"/api/action/{id}/promote",
+		self.ApiActionIdPromotePost,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of the action", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.Action{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodPost,
+		"/api/action/{id}/archive",
+		self.ApiActionIdArchivePost,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of any version of the action", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusNoContent, nil, "NoContent")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodDelete,
+		"/api/action/{id}/archive",
+		self.ApiActionIdArchiveDelete,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of any version of the action", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusNoContent, nil, "NoContent")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/action/{id}/deletion",
+		self.ApiActionIdDeletionGet,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of any version of the action", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.ActionDeletion{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodDelete,
+		"/api/action/{id}",
+		self.ApiActionIdDelete,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of any version of the action", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.ActionDeletion{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/action/{id}/diff/{otherId}",
+		self.ApiActionIdDiffOtherIdGet,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{
+				{Name: "id", Description: "id of the action to compare from", Value: "UUID"},
+				{Name: "otherId", Description: "id of the action to compare to", Value: "UUID"},
+			}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.ActionDiff{}, "Ok")),
+	); err != nil {
+		return err
+	}
 	if _, err := r.AddRoute(http.MethodGet,
 		"/api/action",
 		self.ApiActionGet,
@@ -151,6 +227,76 @@ func (self *Web) Start(ctx context.Context) error {
 	); err != nil {
 		return err
 	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/action-set/{id}/sync",
+		self.ApiActionSetIdSyncGet,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of the action set", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, []domain.ActionSetSync{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodPost,
+		"/api/action-set/{id}/sync",
+		self.ApiActionSetIdSyncPost,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of the action set", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.ActionSetSync{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/action-set/{id}",
+		self.ApiActionSetIdGet,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of the action set", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.ActionSet{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodPatch,
+		"/api/action-set/{id}",
+		self.ApiActionSetIdPatch,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of the action set", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusNoContent, nil, "NoContent")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/action-set",
+		self.ApiActionSetGet,
+		apidoc.BuildSwaggerDef(
+			nil,
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, []domain.ActionSet{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodPost,
+		"/api/action-set",
+		self.ApiActionSetPost,
+		apidoc.BuildSwaggerDef(
+			nil,
+			apidoc.BuildBodyRequest(apiActionSetPostBody{}),
+			apidoc.BuildResponseSuccessfully(http.StatusOK, apiActionSetPostResponse{}, "Ok")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodDelete,
+		"/api/evaluation/cache",
+		self.ApiEvaluationCacheDelete,
+		apidoc.BuildSwaggerDef(
+			nil,
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, apiEvaluationCacheDeleteResponse{}, "OK")),
+	); err != nil {
+		return err
+	}
 	var value interface{} //TODO: WIP
 	if _, err := r.AddRoute(http.MethodPost,
 		"/api/run/{id}/fact",
@@ -168,7 +314,17 @@ func (self *Web) Start(ctx context.Context) error {
 		apidoc.BuildSwaggerDef(
 			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of a run", Value: "UUID"}}),
 			nil,
-			apidoc.BuildResponseSuccessfully(http.StatusOK, map[string]*domain.LokiOutput{"logs": {}}, "OK")),
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.LogPage{}, "OK")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/run/{id}/logs/stream",
+		self.ApiRunIdLogsStreamGet,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of a run", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.LogLine{}, "OK")),
 	); err != nil {
 		return err
 	}
@@ -202,6 +358,16 @@ func (self *Web) Start(ctx context.Context) error {
 	); err != nil {
 		return err
 	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/run/{id}/job",
+		self.ApiRunIdJobGet,
+		apidoc.BuildSwaggerDef(
+			apidoc.BuildSwaggerPathParams([]apidoc.PathParams{{Name: "id", Description: "id of a run", Value: "UUID"}}),
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, domain.RunJob{}, "OK")),
+	); err != nil {
+		return err
+	}
 	if _, err := r.AddRoute(http.MethodDelete,
 		"/api/run/{id}",
 		self.ApiRunIdDelete,
@@ -277,6 +443,26 @@ func (self *Web) Start(ctx context.Context) error {
 	); err != nil {
 		return err
 	}
+	if _, err := r.AddRoute(http.MethodGet,
+		"/api/transformer",
+		self.ApiTransformerGet,
+		apidoc.BuildSwaggerDef(
+			nil,
+			nil,
+			apidoc.BuildResponseSuccessfully(http.StatusOK, []service.TransformerInfo{}, "OK")),
+	); err != nil {
+		return err
+	}
+	if _, err := r.AddRoute(http.MethodPost,
+		"/api/transformer/preview",
+		self.ApiTransformerPreviewPost,
+		apidoc.BuildSwaggerDef(
+			nil,
+			apidoc.BuildBodyRequest(domain.RunDefinition{}),
+			apidoc.BuildResponseSuccessfully(http.StatusOK, []service.TransformStep{}, "OK")),
+	); err != nil {
+		return err
+	}
 	muxRouter.HandleFunc("/", self.IndexGet).Methods(http.MethodGet)
 	muxRouter.HandleFunc("/run/{id}", self.RunIdDelete).Methods(http.MethodDelete)
 	muxRouter.HandleFunc("/run/{id}", self.RunIdGet).Methods(http.MethodGet)
@@ -285,8 +471,22 @@ func (self *Web) Start(ctx context.Context) error {
 	muxRouter.HandleFunc("/action/new", self.ActionNewGet).Methods(http.MethodGet)
 	muxRouter.HandleFunc("/action/{id}", self.ActionIdGet).Methods(http.MethodGet)
 	muxRouter.HandleFunc("/action/{id}", self.ActionIdPatch).Methods(http.MethodPatch)
+	muxRouter.HandleFunc("/action/{id}", self.ActionIdDelete).Methods(http.MethodDelete)
+	muxRouter.HandleFunc("/action/{id}/archive", self.ActionIdArchivePost).Methods(http.MethodPost)
+	muxRouter.HandleFunc("/action/{id}/archive", self.ActionIdArchiveDelete).Methods(http.MethodDelete)
+	muxRouter.HandleFunc("/action/{id}/deletion", self.ActionIdDeletionGet).Methods(http.MethodGet)
+	muxRouter.HandleFunc("/action/{id}/refresh", self.ActionIdRefreshPost).Methods(http.MethodPost)
+	muxRouter.HandleFunc("/action/{id}/promote", self.ActionIdPromotePost).Methods(http.MethodPost)
 	muxRouter.HandleFunc("/action/{id}/run", self.ActionIdRunGet).Methods(http.MethodGet)
 	muxRouter.HandleFunc("/action/{id}/version", self.ActionIdVersionGet).Methods(http.MethodGet)
+	muxRouter.HandleFunc("/action/{id}/diff/{otherId}", self.ActionIdDiffOtherIdGet).Methods(http.MethodGet)
+	muxRouter.HandleFunc("/action-set", self.ActionSetGet).Methods(http.MethodGet)
+	muxRouter.HandleFunc("/action-set", self.ActionSetPost).Methods(http.MethodPost)
+	muxRouter.HandleFunc("/action-set/{id}", self.ActionSetIdGet).Methods(http.MethodGet)
+	muxRouter.HandleFunc("/action-set/{id}", self.ActionSetIdPatch).Methods(http.MethodPatch)
+	muxRouter.HandleFunc("/action-set/{id}/sync", self.ActionSetIdSyncPost).Methods(http.MethodPost)
+	muxRouter.HandleFunc("/transformer", self.TransformerGet).Methods(http.MethodGet)
+	muxRouter.HandleFunc("/transformer", self.TransformerPost).Methods(http.MethodPost)
 	muxRouter.PathPrefix("/static/").Handler(http.StripPrefix("/", http.FileServer(http.FS(staticFs))))
 
 	muxRouter.PathPrefix("/_dispatch/method/{method}/").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -420,6 +620,103 @@ func (self *Web) ActionIdPatch(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func (self *Web) ActionIdRefreshPost(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+		return
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+		return
+	} else if refreshed, err := self.ActionService.Refresh(&action); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not refresh Action with ID %q", id))
+		return
+	} else {
+		http.Redirect(w, req, "/action/"+refreshed.ID.String(), http.StatusFound)
+	}
+}
+
+func (self *Web) ActionIdDiffOtherIdGet(w http.ResponseWriter, req *http.Request) {
+	if from, to, err := self.getActionVersions(req); err != nil {
+		self.ClientError(w, err)
+	} else if diff, err := self.ActionService.Diff(&from, &to); err != nil {
+		self.ServerError(w, err)
+	} else if err := render("action/diff.html", w, map[string]interface{}{
+		"From": from,
+		"To":   to,
+		"Diff": diff,
+	}); err != nil {
+		self.ServerError(w, err)
+	}
+}
+
+// Returns the actions given by the `id` and `otherId` path parameters.
+func (self *Web) getActionVersions(req *http.Request) (from, to domain.Action, err error) {
+	vars := mux.Vars(req)
+	for _, v := range []struct {
+		param  string
+		action *domain.Action
+	}{{"id", &from}, {"otherId", &to}} {
+		if id, err := uuid.Parse(vars[v.param]); err != nil {
+			return from, to, errors.WithMessagef(err, "Could not parse Action ID %q", vars[v.param])
+		} else if *v.action, err = self.ActionService.GetById(id); err != nil {
+			return from, to, errors.WithMessagef(err, "Could not get Action by ID: %q", id)
+		}
+	}
+	return
+}
+
+func (self *Web) ActionIdPromotePost(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+		return
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+		return
+	} else if promoted, err := self.ActionService.Promote(&action); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not promote Action with ID %q", id))
+		return
+	} else {
+		http.Redirect(w, req, "/action/"+promoted.ID.String(), http.StatusFound)
+	}
+}
+
+func (self *Web) ActionIdArchivePost(w http.ResponseWriter, req *http.Request) {
+	self.ApiActionIdArchivePost(NopResponseWriter{w}, req)
+	http.Redirect(w, req, "/action/"+mux.Vars(req)["id"], http.StatusFound)
+}
+
+func (self *Web) ActionIdArchiveDelete(w http.ResponseWriter, req *http.Request) {
+	self.ApiActionIdArchiveDelete(NopResponseWriter{w}, req)
+	http.Redirect(w, req, "/action/"+mux.Vars(req)["id"], http.StatusFound)
+}
+
+func (self *Web) ActionIdDeletionGet(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if deletion, err := self.ActionService.GetDeletionByName(action.Name); err != nil {
+		self.ServerError(w, err)
+	} else if err := render("action/deletion.html", w, map[string]interface{}{
+		"Action":   action,
+		"Deletion": deletion,
+	}); err != nil {
+		self.ServerError(w, err)
+	}
+}
+
+func (self *Web) ActionIdDelete(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if _, err := self.ActionService.DeleteByName(action.Name); err != nil {
+		self.ServerError(w, err)
+	} else {
+		http.Redirect(w, req, "/action/current", http.StatusFound)
+	}
+}
+
 func (self *Web) ActionNewGet(w http.ResponseWriter, req *http.Request) {
 	const templateName = "action/new.html"
 
@@ -454,6 +751,138 @@ func (self *Web) ActionNewGet(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+const transformerExampleDefinition = `{
+	"output": {
+		"success": {"example": true}
+	},
+	"job": {
+		"example": {
+			"group": {
+				"example": {
+					"task": {
+						"example": {
+							"driver": "exec",
+							"config": {"command": "true"}
+						}
+					}
+				}
+			}
+		}
+	}
+}`
+
+func (self *Web) TransformerGet(w http.ResponseWriter, req *http.Request) {
+	if err := render("transformer/index.html", w, map[string]interface{}{
+		"Transformers": self.EvaluationService.ListTransformers(),
+		"Definition":   transformerExampleDefinition,
+	}); err != nil {
+		self.ServerError(w, err)
+	}
+}
+
+func (self *Web) TransformerPost(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		self.BadRequest(w, err)
+		return
+	}
+	definition := req.PostForm.Get("definition")
+
+	data := map[string]interface{}{
+		"Transformers": self.EvaluationService.ListTransformers(),
+		"Definition":   definition,
+	}
+
+	if !json.Valid([]byte(definition)) {
+		data["Error"] = "The run definition is not valid JSON."
+	} else if steps, err := self.EvaluationService.PreviewTransform([]byte(definition)); err != nil {
+		var evalErr service.EvaluationError
+		if !errors.As(err, &evalErr) {
+			self.ServerError(w, err)
+			return
+		}
+		data["Steps"] = steps
+		data["Error"] = err.Error()
+	} else {
+		data["Steps"] = steps
+	}
+
+	if err := render("transformer/index.html", w, data); err != nil {
+		self.ServerError(w, err)
+	}
+}
+
+func (self *Web) ActionSetGet(w http.ResponseWriter, req *http.Request) {
+	if sets, err := self.ActionSetService.GetAll(); err != nil {
+		self.ServerError(w, err)
+	} else if err := render("action-set/index.html", w, map[string]interface{}{
+		"ActionSets": sets,
+	}); err != nil {
+		self.ServerError(w, err)
+	}
+}
+
+func (self *Web) ActionSetPost(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		self.BadRequest(w, err)
+		return
+	}
+
+	var match *string
+	if m := req.PostForm.Get("match"); m != "" {
+		match = &m
+	}
+
+	if set, _, err := self.ActionSetService.Create(req.PostForm.Get("source"), match); err != nil {
+		self.ClientError(w, err)
+	} else {
+		http.Redirect(w, req, "/action-set/"+set.ID.String(), http.StatusFound)
+	}
+}
+
+func (self *Web) ActionSetIdGet(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action Set ID"))
+	} else if set, err := self.ActionSetService.GetById(id); err != nil {
+		self.NotFound(w, err)
+	} else if page, err := getPage(req); err != nil {
+		self.BadRequest(w, err)
+	} else if syncs, err := self.ActionSetService.GetSyncsByActionSetId(id, page); err != nil {
+		self.ServerError(w, err)
+	} else if err := render("action-set/[id].html", w, struct {
+		ActionSet domain.ActionSet
+		Syncs     []*domain.ActionSetSync
+		*repository.Page
+	}{
+		ActionSet: set,
+		Syncs:     syncs,
+		Page:      page,
+	}); err != nil {
+		self.ServerError(w, err)
+	}
+}
+
+func (self *Web) ActionSetIdPatch(w http.ResponseWriter, req *http.Request) {
+	self.ApiActionSetIdPatch(NopResponseWriter{w}, req)
+
+	if referer := req.Header.Get("Referer"); referer != "" {
+		http.Redirect(w, req, referer, http.StatusFound)
+	} else {
+		http.Redirect(w, req, "/action-set", http.StatusFound)
+	}
+}
+
+func (self *Web) ActionSetIdSyncPost(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action Set ID"))
+	} else if set, err := self.ActionSetService.GetById(id); err != nil {
+		self.NotFound(w, err)
+	} else if _, err := self.ActionSetService.Sync(&set, nil); err != nil {
+		self.ServerError(w, err)
+	} else {
+		http.Redirect(w, req, "/action-set/"+id.String(), http.StatusFound)
+	}
+}
+
 func (self *Web) RunIdDelete(w http.ResponseWriter, req *http.Request) {
 	id, err := uuid.Parse(mux.Vars(req)["id"])
 	if err != nil {
@@ -519,12 +948,37 @@ func (self *Web) RunIdGet(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Runs from before jobs were stored have none.
+	var job *domain.RunJob
+	var jobChanges []domain.JsonChange
+	if runJob, err := self.RunService.GetJobByNomadJobId(id); err != nil {
+		if !pgxscan.NotFound(err) {
+			self.ServerError(w, err)
+			return
+		}
+	} else {
+		job = &runJob
+
+		var evaluated, transformed interface{}
+		if err := json.Unmarshal(job.Evaluated, &evaluated); err != nil {
+			self.ServerError(w, err)
+			return
+		} else if err := json.Unmarshal(job.Transformed, &transformed); err != nil {
+			self.ServerError(w, err)
+			return
+		}
+		jobChanges = domain.DiffJson(evaluated, transformed)
+	}
+
 	if err := render("run/[id].html", w, map[string]interface{}{
-		"Run":    run,
-		"inputs": inputs,
-		"output": output,
-		"facts":  facts,
-		"allocs": allocs,
+		"Run":        run,
+		"inputs":     inputs,
+		"output":     output,
+		"facts":      facts,
+		"allocs":     allocs,
+		"job":        job,
+		"jobChanges": jobChanges,
+		"now":        time.Now(),
 	}); err != nil {
 		self.ServerError(w, err)
 		return
@@ -627,7 +1081,7 @@ func (self *Web) ApiActionDefinitionSourceNameIdGet(w http.ResponseWriter, req *
 		self.ClientError(w, errors.WithMessagef(err, "Invalid escaping of action ID: %q", vars["id"]))
 	} else if id, err := uuid.Parse(idStr); err != nil {
 		self.ClientError(w, errors.WithMessagef(err, "Invalid UUID given as action ID: %q", idStr))
-	} else if def, err := self.EvaluationService.EvaluateAction(source, name, id); err != nil {
+	} else if def, err := self.EvaluationService.EvaluateAction(source, nil, name, id); err != nil {
 		self.ServerError(w, err)
 	} else {
 		self.json(w, def, http.StatusOK)
@@ -666,6 +1120,16 @@ func (self *Web) ApiRunByInputGet(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+type apiActionSetPostBody struct {
+	Source string  `json:"source"`
+	Match  *string `json:"match"`
+}
+
+type apiActionSetPostResponse struct {
+	ActionSet *domain.ActionSet    `json:"action_set"`
+	Sync      domain.ActionSetSync `json:"sync"`
+}
+
 type apiActionPostBody struct {
 	Source string  `json:"source"`
 	Name   *string `json:"name"`
@@ -744,7 +1208,25 @@ func (self *Web) ApiRunIdOutputGet(w http.ResponseWriter, req *http.Request) {
 			self.ServerError(w, err)
 		}
 	} else {
-		self.json(w, output, http.StatusOK)
+		self.json(w, struct {
+			domain.RunOutput
+			Published *domain.RunOutputPublished `json:"published,omitempty"`
+			FactId    *uuid.UUID                 `json:"fact_id,omitempty"`
+		}{output, output.Published, output.FactId}, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiRunIdJobGet(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, err)
+	} else if job, err := self.RunService.GetJobByNomadJobId(id); err != nil {
+		if pgxscan.NotFound(err) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			self.ServerError(w, err)
+		}
+	} else {
+		self.json(w, job, http.StatusOK)
 	}
 }
 
@@ -828,7 +1310,7 @@ func (self *Web) ApiActionCurrentNameDefinitionGet(w http.ResponseWriter, req *h
 		self.ClientError(w, errors.WithMessagef(err, "Invalid escaping of action name: %q", vars["name"]))
 	} else if action, err := self.ActionService.GetLatestByName(name); err != nil {
 		self.ClientError(w, errors.WithMessage(err, "Failed to get action"))
-	} else if actionDef, err := self.EvaluationService.EvaluateAction(action.Source, action.Name, action.ID); err != nil {
+	} else if actionDef, err := self.EvaluationService.EvaluateAction(action.Source, action.SourceRevision, action.Name, action.ID); err != nil {
 		self.ServerError(w, errors.WithMessage(err, "Failed to evaluate action"))
 	} else {
 		self.json(w, actionDef, http.StatusOK)
@@ -867,35 +1349,308 @@ func (self *Web) ApiActionIdPatch(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (self *Web) ApiActionIdRefreshPost(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.NotFound(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if refreshed, err := self.ActionService.Refresh(&action); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not refresh Action with ID %q", id))
+	} else {
+		self.json(w, refreshed, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionIdPromotePost(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.NotFound(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if promoted, err := self.ActionService.Promote(&action); err != nil {
+		self.ServerError(w, errors.WithMessagef(err, "Could not promote Action with ID %q", id))
+	} else {
+		self.json(w, promoted, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionIdArchivePost(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.NotFound(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if err := self.ActionService.Archive(action.Name); err != nil {
+		self.ServerError(w, err)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *Web) ApiActionIdArchiveDelete(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.NotFound(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if err := self.ActionService.Unarchive(action.Name); err != nil {
+		self.ServerError(w, err)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (self *Web) ApiActionIdDeletionGet(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.NotFound(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if deletion, err := self.ActionService.GetDeletionByName(action.Name); err != nil {
+		self.ServerError(w, err)
+	} else {
+		self.json(w, deletion, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionIdDelete(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action ID"))
+	} else if action, err := self.ActionService.GetById(id); err != nil {
+		self.NotFound(w, errors.WithMessagef(err, "Could not get Action by ID: %q", id))
+	} else if deletion, err := self.ActionService.GetDeletionByName(action.Name); err != nil {
+		self.ServerError(w, err)
+	} else if !deletion.Possible() {
+		self.ClientError(w, errors.Errorf("Runs of other Actions took facts produced by Action %q as inputs: %v", action.Name, deletion.DependentRuns))
+	} else if deletion, err := self.ActionService.DeleteByName(action.Name); err != nil {
+		self.ServerError(w, err)
+	} else {
+		self.json(w, deletion, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionIdDiffOtherIdGet(w http.ResponseWriter, req *http.Request) {
+	if from, to, err := self.getActionVersions(req); err != nil {
+		self.ClientError(w, err)
+	} else if diff, err := self.ActionService.Diff(&from, &to); err != nil {
+		self.ServerError(w, err)
+	} else {
+		self.json(w, diff, http.StatusOK)
+	}
+}
+
 func (self *Web) ApiActionIdDefinitionGet(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	if id, err := uuid.Parse(vars["id"]); err != nil {
 		self.ClientError(w, errors.WithMessage(err, "Failed to parse id"))
 	} else if action, err := self.ActionService.GetById(id); err != nil {
 		self.ServerError(w, errors.WithMessage(err, "Failed to get action"))
-	} else if actionDef, err := self.EvaluationService.EvaluateAction(action.Source, action.Name, action.ID); err != nil {
+	} else if actionDef, err := self.EvaluationService.EvaluateAction(action.Source, action.SourceRevision, action.Name, action.ID); err != nil {
 		self.ServerError(w, errors.WithMessage(err, "Failed to evaluate action"))
 	} else {
 		self.json(w, actionDef, http.StatusOK)
 	}
 }
 
+type apiEvaluationCacheDeleteResponse struct {
+	Purged int `json:"purged"`
+}
+
+func (self *Web) ApiEvaluationCacheDelete(w http.ResponseWriter, req *http.Request) {
+	self.json(w, apiEvaluationCacheDeleteResponse{
+		Purged: self.EvaluationService.PurgeCache(),
+	}, http.StatusOK)
+}
+
+func (self *Web) ApiTransformerGet(w http.ResponseWriter, req *http.Request) {
+	self.json(w, self.EvaluationService.ListTransformers(), http.StatusOK)
+}
+
+func (self *Web) ApiTransformerPreviewPost(w http.ResponseWriter, req *http.Request) {
+	if definition, err := io.ReadAll(req.Body); err != nil {
+		self.BadRequest(w, errors.WithMessage(err, "Could not read body"))
+	} else if !json.Valid(definition) {
+		self.BadRequest(w, errors.New("Body is not valid JSON"))
+	} else if steps, err := self.EvaluationService.PreviewTransform(definition); err != nil {
+		var evalErr service.EvaluationError
+		if errors.As(err, &evalErr) {
+			self.ClientError(w, err)
+		} else {
+			self.ServerError(w, err)
+		}
+	} else {
+		self.json(w, steps, http.StatusOK)
+	}
+}
+
+// Loki refuses to return more lines at once by default.
+const maxLogsLimit = 5000
+
+// Returns a page of the run's log lines as JSON
+// or, with `format=text`, all lines from the cursor on as plain text to download.
 func (self *Web) ApiRunIdLogsGet(w http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
-	if id, err := uuid.Parse(vars["id"]); err != nil {
+	id, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil {
 		self.ClientError(w, errors.WithMessage(err, "Failed to parse id"))
-	} else {
-		run, err := self.RunService.GetByNomadJobId(id)
-		if err != nil {
-			self.ClientError(w, errors.WithMessage(err, "Failed to fetch job"))
+		return
+	}
+
+	run, err := self.RunService.GetByNomadJobId(id)
+	if err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Failed to fetch job"))
+		return
+	}
+
+	query := domain.LogQuery{
+		AllocId: req.FormValue("alloc"),
+		Task:    req.FormValue("task"),
+		Filter:  req.FormValue("filter"),
+		Cursor:  req.FormValue("cursor"),
+		Limit:   1000,
+	}
+
+	if regexStr := req.FormValue("regex"); regexStr != "" {
+		if query.Regex, err = strconv.ParseBool(regexStr); err != nil {
+			self.BadRequest(w, errors.WithMessage(err, "regex parameter is invalid, should be a boolean"))
 			return
 		}
+	}
 
-		if logs, err := self.RunService.JobLogs(id, run.CreatedAt, run.FinishedAt); err != nil {
+	if limitStr := req.FormValue("limit"); limitStr != "" {
+		if query.Limit, err = strconv.Atoi(limitStr); err != nil || query.Limit < 1 || query.Limit > maxLogsLimit {
+			self.BadRequest(w, errors.Errorf("limit parameter is invalid, should be an integer from 1 to %d", maxLogsLimit))
+			return
+		}
+	}
+
+	logsError := func(err error) {
+		if errors.Is(err, application.ErrInvalidLogQuery) {
+			self.BadRequest(w, err)
+		} else {
 			self.ServerError(w, errors.WithMessage(err, "Failed to get logs"))
+		}
+	}
+
+	switch req.FormValue("format") {
+	case "", "json":
+		if page, err := self.RunService.Logs(&run, query); err != nil {
+			logsError(err)
+		} else {
+			self.json(w, page, http.StatusOK)
+		}
+	case "text":
+		// the whole log, written as it is read
+		started := false
+		start := func() {
+			if !started {
+				started = true
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.log"`, id))
+			}
+		}
+
+		var writeErr error
+		if err := self.RunService.AllLogs(&run, query, func(line domain.LogLine) error {
+			start()
+			_, writeErr = io.WriteString(w, line.Text+"\n")
+			return writeErr
+		}); err != nil {
+			switch {
+			case !started:
+				logsError(err)
+			case err != writeErr:
+				// too late for an error response
+				self.Logger.Err(err).Str("run", id.String()).Msg("Failed to get logs")
+			}
+			return
+		}
+
+		// an empty log
+		start()
+	default:
+		self.BadRequest(w, errors.New("format parameter is invalid, should be json or text"))
+	}
+}
+
+// How long to keep following the logs of a run after it finished
+// so that lines that are still on their way arrive.
+const logsStreamGracePeriod = 10 * time.Second
+
+// Streams the run's log lines as server-sent events until the run finished.
+// Each line is sent as a `line` event with the line as JSON.
+// Once the run finished an `end` event is sent, or an `error` event if following failed.
+func (self *Web) ApiRunIdLogsStreamGet(w http.ResponseWriter, req *http.Request) {
+	id, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Failed to parse id"))
+		return
+	}
+
+	run, err := self.RunService.GetByNomadJobId(id)
+	if err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Failed to fetch job"))
+		return
+	}
+
+	since := run.CreatedAt
+	if sinceStr := req.FormValue("since"); sinceStr != "" {
+		if since, err = time.Parse(time.RFC3339Nano, sinceStr); err != nil {
+			self.BadRequest(w, errors.WithMessage(err, "since parameter is invalid, should be an RFC 3339 timestamp"))
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		self.ServerError(w, errors.New("Streaming is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for finished := run.FinishedAt != nil; !finished; {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if current, err := self.RunService.GetByNomadJobId(id); err != nil {
+					self.Logger.Err(err).Str("run", id.String()).Msg("Failed to check whether run finished")
+				} else {
+					finished = current.FinishedAt != nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(logsStreamGracePeriod):
+			cancel()
+		}
+	}()
+
+	sendEvent := func(event string, data []byte) {
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+	}
+
+	if err := self.RunService.TailLogs(ctx, &run, req.FormValue("task"), since, func(line domain.LogLine) error {
+		if data, err := json.Marshal(line); err != nil {
+			return err
 		} else {
-			self.json(w, map[string]*domain.LokiOutput{"logs": logs}, http.StatusOK)
+			sendEvent("line", data)
+			return nil
 		}
+	}); err != nil {
+		self.Logger.Err(err).Str("run", id.String()).Msg("Failed to stream logs")
+		sendEvent("error", []byte(err.Error()))
+	} else if req.Context().Err() == nil {
+		sendEvent("end", nil)
 	}
 }
 
@@ -949,3 +1704,77 @@ func (self *Web) ApiFactPost(w http.ResponseWriter, req *http.Request) {
 		self.json(w, fact, http.StatusOK)
 	}
 }
+
+func (self *Web) ApiActionSetGet(w http.ResponseWriter, req *http.Request) {
+	if sets, err := self.ActionSetService.GetAll(); err != nil {
+		self.ServerError(w, err)
+	} else {
+		self.json(w, sets, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionSetPost(w http.ResponseWriter, req *http.Request) {
+	params := apiActionSetPostBody{}
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not unmarshal params from request body"))
+	} else if set, sync, err := self.ActionSetService.Create(params.Source, params.Match); err != nil {
+		self.ClientError(w, err)
+	} else {
+		self.json(w, apiActionSetPostResponse{set, sync}, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionSetIdGet(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action Set ID"))
+	} else if set, err := self.ActionSetService.GetById(id); err != nil {
+		self.NotFound(w, err)
+	} else {
+		self.json(w, set, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionSetIdPatch(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action Set ID"))
+		return
+	} else if set, err := self.ActionSetService.GetById(id); err != nil {
+		self.NotFound(w, err)
+		return
+	} else {
+		if active, err := strconv.ParseBool(req.PostFormValue("active")); err == nil {
+			set.Active = active
+		}
+
+		if err := self.ActionSetService.Update(&set); err != nil {
+			self.ServerError(w, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (self *Web) ApiActionSetIdSyncGet(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action Set ID"))
+	} else if page, err := getPage(req); err != nil {
+		self.BadRequest(w, err)
+	} else if syncs, err := self.ActionSetService.GetSyncsByActionSetId(id, page); err != nil {
+		self.ServerError(w, err)
+	} else {
+		self.json(w, syncs, http.StatusOK)
+	}
+}
+
+func (self *Web) ApiActionSetIdSyncPost(w http.ResponseWriter, req *http.Request) {
+	if id, err := uuid.Parse(mux.Vars(req)["id"]); err != nil {
+		self.ClientError(w, errors.WithMessage(err, "Could not parse Action Set ID"))
+	} else if set, err := self.ActionSetService.GetById(id); err != nil {
+		self.NotFound(w, err)
+	} else if sync, err := self.ActionSetService.Sync(&set, nil); err != nil {
+		self.ServerError(w, err)
+	} else {
+		self.json(w, sync, http.StatusOK)
+	}
+}
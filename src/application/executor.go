@@ -0,0 +1,79 @@
+package application
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pkg/errors"
+)
+
+// Runs the Nomad jobs of runs.
+// Executors other than Nomad itself emulate the parts of Nomad's API that Cicero uses
+// so that runs end the same way no matter where they ran.
+type Executor interface {
+	EventStream(ctx context.Context, index uint64) (<-chan *nomad.Events, error)
+	JobsRegister(job *nomad.Job, q *nomad.WriteOptions) (*nomad.JobRegisterResponse, *nomad.WriteMeta, error)
+	JobsDeregister(jobID string, purge bool, q *nomad.WriteOptions) (string, *nomad.WriteMeta, error)
+	JobsInfo(jobID string, q *nomad.QueryOptions) (*nomad.Job, *nomad.QueryMeta, error)
+	JobsAllocations(jobID string, allAllocs bool, q *nomad.QueryOptions) ([]*nomad.AllocationListStub, *nomad.QueryMeta, error)
+	// Returns the whole allocation, including what list stubs leave out like its desired transition.
+	AllocationsInfo(allocID string, q *nomad.QueryOptions) (*nomad.Allocation, *nomad.QueryMeta, error)
+	// Reads the stdout or stderr log of a task from the given origin, either nomad.OriginStart or nomad.OriginEnd.
+	// If following, reading blocks for more output until the reader is closed.
+	AllocLogs(allocID, task, logType string, follow bool, origin string, q *nomad.QueryOptions) (io.ReadCloser, error)
+}
+
+// Returned by executors for jobs they do not know.
+var ErrJobNotFound = errors.New("Unexpected response code: 404 (job not found)")
+
+// Whether the error is Nomad's response for something that does not exist.
+func IsNomadNotFound(err error) bool {
+	return err != nil && (errors.Is(err, ErrJobNotFound) || strings.Contains(err.Error(), "Unexpected response code: 404"))
+}
+
+// The name of the Nomad cluster if none are configured.
+const DefaultNomadCluster = "default"
+
+// The name of the cluster that runs jobs as local processes.
+const LocalNomadCluster = "local"
+
+type NomadCluster struct {
+	Name     string
+	Executor Executor
+}
+
+// The configured Nomad clusters.
+// The first one is used for actions that do not name one.
+type NomadClusters []NomadCluster
+
+func (self NomadClusters) Default() NomadCluster {
+	return self[0]
+}
+
+func (self NomadClusters) Get(name string) (Executor, error) {
+	if cluster := self.find(self.Resolve(name)); cluster != nil {
+		return cluster.Executor, nil
+	}
+	return nil, errors.Errorf("No such Nomad cluster: %q", name)
+}
+
+// Returns the name of the configured cluster that runs on the named cluster are on.
+// Runs from before clusters could be named are on the cluster named default,
+// which is taken to be the default cluster if none is named so.
+func (self NomadClusters) Resolve(name string) string {
+	if name == DefaultNomadCluster && len(self) > 0 && self.find(name) == nil {
+		return self.Default().Name
+	}
+	return name
+}
+
+func (self NomadClusters) find(name string) *NomadCluster {
+	for i := range self {
+		if self[i].Name == name {
+			return &self[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,718 @@
+package application
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Runs the tasks of jobs as local processes, for example to develop actions without Nomad.
+// Only the exec and raw_exec drivers are supported and there is no isolation between tasks.
+// Allocation events are published like Nomad's own so that runs end the same way.
+type localExecutor struct {
+	logger zerolog.Logger
+	// Where the directories of allocations are created.
+	dir string
+
+	lock sync.Mutex
+	jobs map[string]*localJob
+	// The index of the last event that was taken from the stream.
+	index uint64
+	// Events not yet taken from the stream.
+	events []nomad.Event
+	notify chan struct{}
+}
+
+type localJob struct {
+	job    *nomad.Job
+	allocs []*nomad.Allocation
+	stop   context.CancelFunc
+}
+
+func NewLocalExecutor(dir string, logger *zerolog.Logger) (Executor, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.WithMessagef(err, "Could not create directory for local executor at %q", dir)
+	}
+
+	return &localExecutor{
+		logger: logger.With().Str("component", "LocalExecutor").Logger(),
+		dir:    dir,
+		jobs:   map[string]*localJob{},
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+// Events are numbered as they are taken so that they
+// always follow the given index, even after a restart of Cicero.
+// There should be only one stream at a time as streams take events from each other.
+func (self *localExecutor) EventStream(ctx context.Context, index uint64) (<-chan *nomad.Events, error) {
+	self.lock.Lock()
+	if index > 0 && self.index < index-1 {
+		self.index = index - 1
+	}
+	self.lock.Unlock()
+
+	stream := make(chan *nomad.Events)
+
+	go func() {
+		for {
+			self.lock.Lock()
+			if len(self.events) == 0 {
+				self.lock.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case <-self.notify:
+					continue
+				}
+			}
+
+			event := self.events[0]
+			self.events = self.events[1:]
+			self.index++
+			event.Index = self.index
+			self.lock.Unlock()
+
+			select {
+			case <-ctx.Done():
+				self.lock.Lock()
+				self.events = append([]nomad.Event{event}, self.events...)
+				self.lock.Unlock()
+				return
+			case stream <- &nomad.Events{Index: event.Index, Events: []nomad.Event{event}}:
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+func (self *localExecutor) JobsRegister(job *nomad.Job, _ *nomad.WriteOptions) (*nomad.JobRegisterResponse, *nomad.WriteMeta, error) {
+	if job.ID == nil {
+		return nil, nil, errors.New("Job has no ID")
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if existing, exists := self.jobs[*job.ID]; exists && (existing.job.Stop == nil || !*existing.job.Stop) {
+		return nil, nil, errors.Errorf("Job with ID %q is already running", *job.ID)
+	}
+
+	running := "running"
+	stop := false
+	job.Status = &running
+	job.Stop = &stop
+
+	ctx, cancel := context.WithCancel(context.Background())
+	localJob := &localJob{job: job, stop: cancel}
+	self.jobs[*job.ID] = localJob
+
+	now := time.Now().UnixNano()
+	for _, group := range job.TaskGroups {
+		count := 1
+		if group.Count != nil {
+			count = *group.Count
+		}
+
+		for i := 0; i < count; i++ {
+			alloc := &nomad.Allocation{
+				ID:            uuid.NewString(),
+				Name:          fmt.Sprintf("%s.%s[%d]", *job.ID, *group.Name, i),
+				JobID:         *job.ID,
+				Job:           job,
+				TaskGroup:     *group.Name,
+				DesiredStatus: nomad.AllocDesiredStatusRun,
+				ClientStatus:  nomad.AllocClientStatusPending,
+				TaskStates:    map[string]*nomad.TaskState{},
+				// there are no resource limits but the web UI expects this
+				AllocatedResources: &nomad.AllocatedResources{Tasks: map[string]*nomad.AllocatedTaskResources{}},
+				CreateTime:         now,
+				ModifyTime:         now,
+			}
+			for _, task := range group.Tasks {
+				alloc.TaskStates[task.Name] = &nomad.TaskState{State: "pending"}
+			}
+			localJob.allocs = append(localJob.allocs, alloc)
+
+			go self.runAlloc(ctx, alloc, group, i)
+		}
+	}
+
+	self.logger.Info().Str("job", *job.ID).Int("allocations", len(localJob.allocs)).Msg("Registered job")
+
+	return &nomad.JobRegisterResponse{EvalID: uuid.NewString()}, &nomad.WriteMeta{}, nil
+}
+
+func (self *localExecutor) JobsDeregister(jobID string, purge bool, _ *nomad.WriteOptions) (string, *nomad.WriteMeta, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	localJob, exists := self.jobs[jobID]
+	if !exists {
+		return "", nil, ErrJobNotFound
+	}
+
+	stop := true
+	localJob.job.Stop = &stop
+	localJob.stop()
+
+	if purge {
+		delete(self.jobs, jobID)
+		for _, alloc := range localJob.allocs {
+			if err := os.RemoveAll(filepath.Join(self.dir, alloc.ID)); err != nil {
+				self.logger.Warn().Err(err).Str("alloc", alloc.ID).Msg("Could not remove allocation directory")
+			}
+		}
+	}
+
+	self.logger.Info().Str("job", jobID).Msg("Deregistered job")
+
+	return uuid.NewString(), &nomad.WriteMeta{}, nil
+}
+
+func (self *localExecutor) JobsInfo(jobID string, _ *nomad.QueryOptions) (*nomad.Job, *nomad.QueryMeta, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	localJob, exists := self.jobs[jobID]
+	if !exists {
+		return nil, nil, ErrJobNotFound
+	}
+
+	job := *localJob.job
+	return &job, &nomad.QueryMeta{}, nil
+}
+
+func (self *localExecutor) JobsAllocations(jobID string, _ bool, _ *nomad.QueryOptions) ([]*nomad.AllocationListStub, *nomad.QueryMeta, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	localJob, exists := self.jobs[jobID]
+	if !exists {
+		return nil, nil, ErrJobNotFound
+	}
+
+	stubs := make([]*nomad.AllocationListStub, len(localJob.allocs))
+	for i, alloc := range localJob.allocs {
+		taskStates := map[string]*nomad.TaskState{}
+		for name, state := range alloc.TaskStates {
+			state := *state
+			taskStates[name] = &state
+		}
+
+		stubs[i] = &nomad.AllocationListStub{
+			ID:            alloc.ID,
+			Name:          alloc.Name,
+			JobID:         alloc.JobID,
+			TaskGroup:     alloc.TaskGroup,
+			DesiredStatus: alloc.DesiredStatus,
+			ClientStatus:  alloc.ClientStatus,
+			TaskStates:    taskStates,
+			CreateTime:    alloc.CreateTime,
+			ModifyTime:    alloc.ModifyTime,
+		}
+	}
+
+	return stubs, &nomad.QueryMeta{}, nil
+}
+
+// Local allocations are never rescheduled.
+func (self *localExecutor) AllocationsInfo(allocID string, _ *nomad.QueryOptions) (*nomad.Allocation, *nomad.QueryMeta, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, localJob := range self.jobs {
+		for _, alloc := range localJob.allocs {
+			if alloc.ID == allocID {
+				alloc := *alloc
+				return &alloc, &nomad.QueryMeta{}, nil
+			}
+		}
+	}
+
+	return nil, nil, errors.Errorf("Unexpected response code: 404 (alloc not found: %s)", allocID)
+}
+
+func (self *localExecutor) AllocLogs(allocID, task, logType string, follow bool, origin string, _ *nomad.QueryOptions) (io.ReadCloser, error) {
+	if logType != "stdout" && logType != "stderr" {
+		return nil, errors.Errorf("Invalid log type %q", logType)
+	}
+
+	// only known allocations and tasks so that the path cannot be chosen freely
+	if !self.hasTask(allocID, task) {
+		return nil, errors.Errorf("Unexpected response code: 404 (unknown allocation %q or task %q)", allocID, task)
+	}
+
+	reader := &localLogReader{
+		path:   filepath.Join(self.dir, allocID, "alloc", "logs", task+"."+logType+".0"),
+		follow: follow,
+		end:    origin == nomad.OriginEnd,
+		closed: make(chan struct{}),
+	}
+	if err := reader.open(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (self *localExecutor) hasTask(allocID, task string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, localJob := range self.jobs {
+		for _, alloc := range localJob.allocs {
+			if alloc.ID == allocID {
+				_, exists := alloc.TaskStates[task]
+				return exists
+			}
+		}
+	}
+	return false
+}
+
+// Reads a log file that may not exist yet and may still be written to.
+type localLogReader struct {
+	path   string
+	follow bool
+	// Whether to skip what was written before the file was opened.
+	end bool
+
+	file      *os.File
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (self *localLogReader) open() error {
+	if self.file != nil {
+		return nil
+	}
+
+	file, err := os.Open(self.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// written from the start once the task runs
+			self.end = false
+			return nil
+		}
+		return err
+	}
+
+	if self.end {
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	self.file = file
+	return nil
+}
+
+func (self *localLogReader) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-self.closed:
+			if self.file != nil {
+				self.file.Close()
+			}
+			return 0, io.EOF
+		default:
+		}
+
+		if err := self.open(); err != nil {
+			return 0, err
+		}
+
+		if self.file != nil {
+			if n, err := self.file.Read(p); n > 0 || err != io.EOF {
+				return n, err
+			}
+		}
+
+		if !self.follow {
+			return 0, io.EOF
+		}
+
+		select {
+		case <-self.closed:
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// Safe to call while reading in another goroutine,
+// in which case the file is closed by the reading goroutine.
+func (self *localLogReader) Close() error {
+	self.closeOnce.Do(func() { close(self.closed) })
+	if !self.follow && self.file != nil {
+		return self.file.Close()
+	}
+	return nil
+}
+
+// Runs prestart tasks, then main tasks alongside sidecars and poststart tasks, then poststop tasks.
+// The allocation fails if any task that is not a sidecar fails.
+func (self *localExecutor) runAlloc(ctx context.Context, alloc *nomad.Allocation, group *nomad.TaskGroup, index int) {
+	logger := self.logger.With().Str("job", alloc.JobID).Str("alloc", alloc.ID).Logger()
+
+	var prestart, sidecars, main, poststart, poststop []*nomad.Task
+	for _, task := range group.Tasks {
+		switch {
+		case task.Lifecycle == nil || task.Lifecycle.Hook == "":
+			main = append(main, task)
+		case task.Lifecycle.Hook == nomad.TaskLifecycleHookPrestart && task.Lifecycle.Sidecar:
+			sidecars = append(sidecars, task)
+		case task.Lifecycle.Hook == nomad.TaskLifecycleHookPrestart:
+			prestart = append(prestart, task)
+		case task.Lifecycle.Hook == nomad.TaskLifecycleHookPoststart:
+			poststart = append(poststart, task)
+		case task.Lifecycle.Hook == nomad.TaskLifecycleHookPoststop:
+			poststop = append(poststop, task)
+		}
+	}
+
+	allocDir := filepath.Join(self.dir, alloc.ID)
+	if err := os.MkdirAll(filepath.Join(allocDir, "alloc", "logs"), 0o755); err != nil {
+		logger.Err(err).Msg("Could not create allocation directory")
+		self.updateAlloc(alloc, func() { alloc.ClientStatus = nomad.AllocClientStatusFailed })
+		return
+	}
+
+	self.updateAlloc(alloc, func() { alloc.ClientStatus = nomad.AllocClientStatusRunning })
+
+	failed := false
+	runTasks := func(ctx context.Context, tasks []*nomad.Task) {
+		wg := sync.WaitGroup{}
+		for _, task := range tasks {
+			wg.Add(1)
+			go func(task *nomad.Task) {
+				defer wg.Done()
+				if !self.runTask(ctx, allocDir, alloc, group, index, task) {
+					self.lock.Lock()
+					failed = true
+					self.lock.Unlock()
+				}
+			}(task)
+		}
+		wg.Wait()
+	}
+
+	runTasks(ctx, prestart)
+
+	if !failed {
+		sidecarCtx, stopSidecars := context.WithCancel(ctx)
+		sidecarsDone := make(chan struct{})
+		go func() {
+			defer close(sidecarsDone)
+			self.runTasksIgnoringFailure(sidecarCtx, allocDir, alloc, group, index, sidecars)
+		}()
+
+		runTasks(ctx, append(main, poststart...))
+
+		stopSidecars()
+		<-sidecarsDone
+	}
+
+	// poststop tasks run even if the job was stopped
+	runTasks(context.Background(), poststop)
+
+	self.updateAlloc(alloc, func() {
+		if failed {
+			alloc.ClientStatus = nomad.AllocClientStatusFailed
+		} else {
+			alloc.ClientStatus = nomad.AllocClientStatusComplete
+		}
+
+		if localJob, exists := self.jobs[alloc.JobID]; exists {
+			for _, alloc := range localJob.allocs {
+				if !alloc.ClientTerminalStatus() {
+					return
+				}
+			}
+			dead := "dead"
+			localJob.job.Status = &dead
+		}
+	})
+
+	logger.Debug().Bool("failed", failed).Msg("Allocation ended")
+}
+
+func (self *localExecutor) runTasksIgnoringFailure(ctx context.Context, allocDir string, alloc *nomad.Allocation, group *nomad.TaskGroup, index int, tasks []*nomad.Task) {
+	wg := sync.WaitGroup{}
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task *nomad.Task) {
+			defer wg.Done()
+			self.runTask(ctx, allocDir, alloc, group, index, task)
+		}(task)
+	}
+	wg.Wait()
+}
+
+// Returns whether the task succeeded.
+// Tasks that are killed because their context is done do not fail.
+func (self *localExecutor) runTask(ctx context.Context, allocDir string, alloc *nomad.Allocation, group *nomad.TaskGroup, index int, task *nomad.Task) bool {
+	fail := func(eventType string, err error) bool {
+		self.updateTask(alloc, task.Name, func(state *nomad.TaskState) {
+			state.State = "dead"
+			state.Failed = true
+			state.FinishedAt = time.Now().UTC()
+			state.Events = append(state.Events, &nomad.TaskEvent{
+				Type:           eventType,
+				Time:           time.Now().UnixNano(),
+				DisplayMessage: err.Error(),
+				FailsTask:      true,
+			})
+		})
+		return false
+	}
+
+	switch task.Driver {
+	case "exec", "raw_exec":
+	default:
+		return fail(nomad.TaskDriverFailure, errors.Errorf("Driver %q is not supported by the local executor", task.Driver))
+	}
+
+	taskDir := filepath.Join(allocDir, task.Name)
+	for _, dir := range []string{"local", "secrets", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(taskDir, dir), 0o755); err != nil {
+			return fail(nomad.TaskSetupFailure, err)
+		}
+	}
+
+	env := localTaskEnv(allocDir, taskDir, alloc, group, index, task)
+
+	for _, tmpl := range task.Templates {
+		if err := renderLocalTemplate(taskDir, tmpl, env); err != nil {
+			return fail(nomad.TaskSetupFailure, err)
+		}
+	}
+
+	command, _ := task.Config["command"].(string)
+	if command == "" {
+		return fail(nomad.TaskSetupFailure, errors.New("Missing command in task config"))
+	}
+	args := []string{}
+	if configArgs, ok := task.Config["args"].([]interface{}); ok {
+		for _, arg := range configArgs {
+			args = append(args, interpolateLocalEnv(fmt.Sprint(arg), env))
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, interpolateLocalEnv(command, env), args...)
+	cmd.Dir = taskDir
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	logsDir := filepath.Join(allocDir, "alloc", "logs")
+	stdout, err := os.Create(filepath.Join(logsDir, task.Name+".stdout.0"))
+	if err != nil {
+		return fail(nomad.TaskSetupFailure, err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(logsDir, task.Name+".stderr.0"))
+	if err != nil {
+		return fail(nomad.TaskSetupFailure, err)
+	}
+	defer stderr.Close()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		if ctx.Err() != nil {
+			// stopped before it started
+			return true
+		}
+		return fail(nomad.TaskDriverFailure, err)
+	}
+
+	self.updateTask(alloc, task.Name, func(state *nomad.TaskState) {
+		state.State = "running"
+		state.StartedAt = time.Now().UTC()
+		state.Events = append(state.Events, &nomad.TaskEvent{Type: nomad.TaskStarted, Time: time.Now().UnixNano()})
+	})
+
+	err = cmd.Wait()
+	killed := ctx.Err() != nil
+	exitCode := cmd.ProcessState.ExitCode()
+	succeeded := killed || err == nil
+
+	self.updateTask(alloc, task.Name, func(state *nomad.TaskState) {
+		state.State = "dead"
+		state.Failed = !succeeded
+		state.FinishedAt = time.Now().UTC()
+		event := &nomad.TaskEvent{Type: nomad.TaskTerminated, Time: time.Now().UnixNano(), ExitCode: exitCode}
+		if killed {
+			event.Type = nomad.TaskKilled
+		}
+		state.Events = append(state.Events, event)
+	})
+
+	return succeeded
+}
+
+// Changes the allocation and publishes an event for it.
+func (self *localExecutor) updateAlloc(alloc *nomad.Allocation, update func()) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	update()
+	alloc.ModifyTime = time.Now().UnixNano()
+
+	self.publish(alloc)
+}
+
+func (self *localExecutor) updateTask(alloc *nomad.Allocation, taskName string, update func(*nomad.TaskState)) {
+	self.updateAlloc(alloc, func() {
+		update(alloc.TaskStates[taskName])
+	})
+}
+
+// Must be called with the lock held.
+func (self *localExecutor) publish(alloc *nomad.Allocation) {
+	// Payloads are decoded JSON like those from Nomad's event stream.
+	payload := map[string]interface{}{}
+	if data, err := json.Marshal(map[string]interface{}{"Allocation": alloc}); err != nil {
+		self.logger.Err(err).Str("alloc", alloc.ID).Msg("Could not encode allocation event")
+		return
+	} else if err := json.Unmarshal(data, &payload); err != nil {
+		self.logger.Err(err).Str("alloc", alloc.ID).Msg("Could not decode allocation event")
+		return
+	}
+
+	self.events = append(self.events, nomad.Event{
+		Topic:   nomad.TopicAllocation,
+		Type:    "AllocationUpdated",
+		Key:     alloc.ID,
+		Payload: payload,
+	})
+
+	select {
+	case self.notify <- struct{}{}:
+	default:
+	}
+}
+
+// The environment variables Nomad sets plus those of the task.
+// Only PATH is taken from Cicero's environment.
+func localTaskEnv(allocDir, taskDir string, alloc *nomad.Allocation, group *nomad.TaskGroup, index int, task *nomad.Task) map[string]string {
+	job := alloc.Job
+
+	env := map[string]string{
+		"PATH":              os.Getenv("PATH"),
+		"NOMAD_ALLOC_DIR":   filepath.Join(allocDir, "alloc"),
+		"NOMAD_TASK_DIR":    filepath.Join(taskDir, "local"),
+		"NOMAD_SECRETS_DIR": filepath.Join(taskDir, "secrets"),
+		"TMPDIR":            filepath.Join(taskDir, "tmp"),
+		"NOMAD_ALLOC_ID":    alloc.ID,
+		"NOMAD_ALLOC_NAME":  alloc.Name,
+		"NOMAD_ALLOC_INDEX": strconv.Itoa(index),
+		"NOMAD_GROUP_NAME":  *group.Name,
+		"NOMAD_TASK_NAME":   task.Name,
+		"NOMAD_JOB_ID":      *job.ID,
+	}
+	if job.Name != nil {
+		env["NOMAD_JOB_NAME"] = *job.Name
+	}
+	if job.Namespace != nil {
+		env["NOMAD_NAMESPACE"] = *job.Namespace
+	}
+	if job.Region != nil {
+		env["NOMAD_REGION"] = *job.Region
+	}
+
+	for _, meta := range []map[string]string{job.Meta, group.Meta, task.Meta} {
+		for k, v := range meta {
+			env["NOMAD_META_"+k] = v
+		}
+	}
+
+	for k, v := range task.Env {
+		env[k] = interpolateLocalEnv(v, env)
+	}
+
+	return env
+}
+
+// Replaces `${VAR}` with environment variables, leaving unknown ones like `${attr.…}` as they are.
+func interpolateLocalEnv(s string, env map[string]string) string {
+	return os.Expand(s, func(key string) string {
+		if value, exists := env[key]; exists {
+			return value
+		}
+		return "${" + key + "}"
+	})
+}
+
+// Renders an embedded template with Go's text/template
+// offering only the `env` function of consul-template.
+func renderLocalTemplate(taskDir string, tmpl *nomad.Template, env map[string]string) error {
+	if tmpl.EmbeddedTmpl == nil || tmpl.DestPath == nil {
+		return errors.New("Only templates with data and destination are supported by the local executor")
+	}
+
+	parsed := template.New(*tmpl.DestPath).Funcs(template.FuncMap{
+		"env": func(key string) string { return env[key] },
+	})
+	if tmpl.LeftDelim != nil && tmpl.RightDelim != nil {
+		parsed = parsed.Delims(*tmpl.LeftDelim, *tmpl.RightDelim)
+	}
+	parsed, err := parsed.Parse(*tmpl.EmbeddedTmpl)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not parse template for %q", *tmpl.DestPath)
+	}
+
+	rendered := bytes.Buffer{}
+	if err := parsed.Execute(&rendered, nil); err != nil {
+		return errors.WithMessagef(err, "Could not render template for %q", *tmpl.DestPath)
+	}
+
+	perms := os.FileMode(0o644)
+	if tmpl.Perms != nil {
+		if parsedPerms, err := strconv.ParseUint(*tmpl.Perms, 8, 32); err != nil {
+			return errors.WithMessagef(err, "Invalid permissions of template for %q", *tmpl.DestPath)
+		} else {
+			perms = os.FileMode(parsedPerms)
+		}
+	}
+
+	dest := interpolateLocalEnv(*tmpl.DestPath, env)
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(taskDir, dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dest, rendered.Bytes(), perms); err != nil {
+		return err
+	}
+
+	if tmpl.Envvars != nil && *tmpl.Envvars {
+		scanner := bufio.NewScanner(&rendered)
+		for scanner.Scan() {
+			if parts := strings.SplitN(scanner.Text(), "=", 2); len(parts) == 2 {
+				env[strings.TrimSpace(parts[0])] = parts[1]
+			}
+		}
+	}
+
+	return nil
+}
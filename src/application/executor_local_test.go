@@ -0,0 +1,106 @@
+package application
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRunJobAsLocalProcesses(t *testing.T) {
+	t.Parallel()
+
+	// given
+	dir := t.TempDir()
+	logger := zerolog.Nop()
+	executor, err := NewLocalExecutor(dir, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := executor.EventStream(ctx, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobId, groupName, tmplDest, tmplData := "test-job", "group", "local/greeting", `hello {{env "NOMAD_TASK_NAME"}}`
+	job := &nomad.Job{
+		ID: &jobId,
+		TaskGroups: []*nomad.TaskGroup{{
+			Name: &groupName,
+			Tasks: []*nomad.Task{
+				{
+					Name:      "prepare",
+					Driver:    "exec",
+					Lifecycle: &nomad.TaskLifecycle{Hook: nomad.TaskLifecycleHookPrestart},
+					Config: map[string]interface{}{
+						"command": "/bin/sh",
+						"args":    []interface{}{"-c", `cp "$NOMAD_TASK_DIR/greeting" "$NOMAD_ALLOC_DIR/greeting"`},
+					},
+					Templates: []*nomad.Template{{DestPath: &tmplDest, EmbeddedTmpl: &tmplData}},
+				},
+				{
+					Name:   "main",
+					Driver: "raw_exec",
+					Env:    map[string]string{"EXIT_CODE": "3"},
+					Config: map[string]interface{}{
+						"command": "/bin/sh",
+						"args":    []interface{}{"-c", `exit "$EXIT_CODE"`},
+					},
+				},
+			},
+		}},
+	}
+
+	// when
+	if _, _, err := executor.JobsRegister(job, &nomad.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var alloc *nomad.Allocation
+	for alloc == nil || !alloc.ClientTerminalStatus() {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the allocation to end")
+		case events := <-stream:
+			assert.GreaterOrEqual(t, events.Index, uint64(42))
+			if alloc, err = events.Events[0].Allocation(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// then
+	assert.Equal(t, jobId, alloc.JobID)
+	assert.Equal(t, nomad.AllocClientStatusFailed, alloc.ClientStatus)
+	assert.False(t, alloc.TaskStates["prepare"].Failed)
+	assert.True(t, alloc.TaskStates["main"].Failed)
+
+	mainEvents := alloc.TaskStates["main"].Events
+	assert.Equal(t, nomad.TaskTerminated, mainEvents[len(mainEvents)-1].Type)
+	assert.Equal(t, 3, mainEvents[len(mainEvents)-1].ExitCode)
+
+	greeting, err := os.ReadFile(filepath.Join(dir, alloc.ID, "alloc", "greeting"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello prepare", string(greeting))
+
+	allocs, _, err := executor.JobsAllocations(jobId, true, &nomad.QueryOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, allocs, 1)
+	assert.Equal(t, nomad.AllocClientStatusFailed, allocs[0].ClientStatus)
+
+	info, _, err := executor.JobsInfo(jobId, &nomad.QueryOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "dead", *info.Status)
+
+	_, _, err = executor.JobsInfo("unknown", &nomad.QueryOptions{})
+	assert.True(t, IsNomadNotFound(err))
+}
@@ -0,0 +1,63 @@
+package application
+
+import (
+	"context"
+	"io"
+
+	nomad "github.com/hashicorp/nomad/api"
+)
+
+type nomadExecutor struct {
+	nClient *nomad.Client
+}
+
+func NewNomadExecutor(nClient *nomad.Client) Executor {
+	return &nomadExecutor{
+		nClient: nClient,
+	}
+}
+
+func (self *nomadExecutor) EventStream(ctx context.Context, nomadIndex uint64) (<-chan *nomad.Events, error) {
+	return self.nClient.EventStream().Stream(
+		ctx,
+		// Only allocation events are handled.
+		// Nomad cannot filter by job ID prefix so events of other jobs are filtered out later.
+		map[nomad.Topic][]string{
+			nomad.TopicAllocation: {string(nomad.TopicAll)},
+		},
+		nomadIndex,
+		// events of jobs in all namespaces
+		&nomad.QueryOptions{Namespace: "*"},
+	)
+}
+
+func (self *nomadExecutor) JobsRegister(job *nomad.Job, q *nomad.WriteOptions) (*nomad.JobRegisterResponse, *nomad.WriteMeta, error) {
+	return self.nClient.Jobs().Register(job, q)
+}
+
+func (self *nomadExecutor) JobsDeregister(jobID string, purge bool, q *nomad.WriteOptions) (string, *nomad.WriteMeta, error) {
+	return self.nClient.Jobs().Deregister(jobID, purge, q)
+}
+
+func (self *nomadExecutor) JobsInfo(jobID string, q *nomad.QueryOptions) (*nomad.Job, *nomad.QueryMeta, error) {
+	return self.nClient.Jobs().Info(jobID, q)
+}
+
+func (self *nomadExecutor) JobsAllocations(jobID string, allAllocs bool, q *nomad.QueryOptions) ([]*nomad.AllocationListStub, *nomad.QueryMeta, error) {
+	return self.nClient.Jobs().Allocations(jobID, allAllocs, q)
+}
+
+func (self *nomadExecutor) AllocationsInfo(allocID string, q *nomad.QueryOptions) (*nomad.Allocation, *nomad.QueryMeta, error) {
+	return self.nClient.Allocations().Info(allocID, q)
+}
+
+func (self *nomadExecutor) AllocLogs(allocID, task, logType string, follow bool, origin string, q *nomad.QueryOptions) (io.ReadCloser, error) {
+	alloc, _, err := self.nClient.Allocations().Info(allocID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	cancel := make(chan struct{})
+	frames, errs := self.nClient.AllocFS().Logs(alloc, follow, task, logType, origin, 0, cancel, q)
+	return nomad.NewFrameReader(frames, errs, cancel), nil
+}
@@ -0,0 +1,32 @@
+package application
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldResolveUnnamedClusterToDefault(t *testing.T) {
+	t.Parallel()
+
+	// given
+	ci, deploy := &localExecutor{}, &localExecutor{}
+	named := NomadClusters{{Name: "ci", Executor: ci}, {Name: "deploy", Executor: deploy}}
+	withDefault := NomadClusters{{Name: "ci", Executor: ci}, {Name: DefaultNomadCluster, Executor: deploy}}
+
+	// then
+	assert.Equal(t, "ci", named.Resolve(DefaultNomadCluster))
+	assert.Equal(t, "deploy", named.Resolve("deploy"))
+	assert.Equal(t, DefaultNomadCluster, withDefault.Resolve(DefaultNomadCluster))
+
+	executor, err := named.Get(DefaultNomadCluster)
+	assert.NoError(t, err)
+	assert.Same(t, ci, executor)
+
+	executor, err = withDefault.Get(DefaultNomadCluster)
+	assert.NoError(t, err)
+	assert.Same(t, deploy, executor)
+
+	_, err = named.Get("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package application
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// Where the logs of the tasks of runs come from.
+type LogProvider interface {
+	// Returns a page of the log lines of the run's job that match the query in order.
+	// Cursors are only meaningful to the provider that returned them.
+	Logs(run *domain.Run, query domain.LogQuery) (*domain.LogPage, error)
+	// Calls the given function with every log line of the run's job that matches the query in order,
+	// starting at the query's cursor regardless of its limit.
+	AllLogs(run *domain.Run, query domain.LogQuery, fn func(domain.LogLine) error) error
+	// Returns the logs of a task of one of the run's allocations.
+	TaskLogs(run *domain.Run, allocId, taskGroup, taskName string) (*domain.LokiOutput, error)
+	// Calls the given function with every log line of the run's job since the given time,
+	// optionally only of the given task, as they come in until the context is done.
+	TailLogs(ctx context.Context, run *domain.Run, taskName string, since time.Time, fn func(domain.LogLine) error) error
+}
+
+// Returned for queries with an invalid filter or cursor.
+var ErrInvalidLogQuery = errors.New("Invalid log query")
+
+// Returns whether a line's text matches the query's filter.
+func logLineFilter(query domain.LogQuery) (func(string) bool, error) {
+	switch {
+	case query.Filter == "":
+		return func(string) bool { return true }, nil
+	case query.Regex:
+		if re, err := regexp.Compile(query.Filter); err != nil {
+			return nil, errors.WithMessagef(ErrInvalidLogQuery, "filter is not a valid regular expression: %s", err)
+		} else {
+			return re.MatchString, nil
+		}
+	default:
+		return func(text string) bool { return strings.Contains(text, query.Filter) }, nil
+	}
+}
+
+// Pages through all lines of a log by their position,
+// for providers that can only read logs as a whole.
+func pageLogLines(lines []domain.LogLine, query domain.LogQuery) (*domain.LogPage, error) {
+	filter, err := logLineFilter(query)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if query.Cursor != "" {
+		if offset, err = strconv.Atoi(query.Cursor); err != nil || offset < 0 {
+			return nil, errors.WithMessagef(ErrInvalidLogQuery, "cursor %q is invalid", query.Cursor)
+		}
+	}
+
+	page := &domain.LogPage{Lines: []domain.LogLine{}}
+	for i := offset; i < len(lines); i++ {
+		if !filter(lines[i].Text) {
+			continue
+		}
+
+		if query.Limit > 0 && len(page.Lines) == query.Limit {
+			page.NextCursor = strconv.Itoa(i)
+			break
+		}
+
+		page.Lines = append(page.Lines, lines[i])
+	}
+
+	return page, nil
+}
+
+// Calls the given function with all lines of a log from the query's cursor on that match its filter,
+// for providers that can only read logs as a whole.
+func eachLogLine(lines []domain.LogLine, query domain.LogQuery, fn func(domain.LogLine) error) error {
+	query.Limit = 0
+	page, err := pageLogLines(lines, query)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range page.Lines {
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls the given function with every line read until it returns false.
+func scanLogLines(reader io.Reader, fn func(string) bool) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,212 @@
+package application
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// Reads logs from files at <dir>/<run id>/<alloc id>/<task>.<stdout|stderr>,
+// for example to test without Loki or Nomad.
+// Lines may start with an RFC 3339 time followed by a space,
+// otherwise the file's modification time is used.
+type fileLogProvider struct {
+	dir string
+}
+
+func NewFileLogProvider(dir string) LogProvider {
+	return &fileLogProvider{dir: dir}
+}
+
+func (self *fileLogProvider) Logs(run *domain.Run, query domain.LogQuery) (*domain.LogPage, error) {
+	lines, err := self.readQueryLines(run, query)
+	if err != nil {
+		return nil, err
+	}
+	return pageLogLines(lines, query)
+}
+
+// Reads the files only once, unlike paging through them.
+func (self *fileLogProvider) AllLogs(run *domain.Run, query domain.LogQuery, fn func(domain.LogLine) error) error {
+	lines, err := self.readQueryLines(run, query)
+	if err != nil {
+		return err
+	}
+	return eachLogLine(lines, query, fn)
+}
+
+// Reads all lines of the allocations and tasks that the query selects in order of time.
+func (self *fileLogProvider) readQueryLines(run *domain.Run, query domain.LogQuery) ([]domain.LogLine, error) {
+	allocPattern, taskPattern := "*", "*"
+	if query.AllocId != "" {
+		allocPattern = filepath.Base(query.AllocId)
+	}
+	if query.Task != "" {
+		taskPattern = filepath.Base(query.Task)
+	}
+
+	linesByPath, err := self.readLines(run, allocPattern, taskPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(linesByPath))
+	for path := range linesByPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	lines := []domain.LogLine{}
+	for _, path := range paths {
+		lines = append(lines, linesByPath[path]...)
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+
+	return lines, nil
+}
+
+func (self *fileLogProvider) TaskLogs(run *domain.Run, allocId, _, taskName string) (*domain.LokiOutput, error) {
+	return self.readLogs(run, filepath.Base(allocId), filepath.Base(taskName))
+}
+
+func (self *fileLogProvider) readLogs(run *domain.Run, allocPattern, taskPattern string) (*domain.LokiOutput, error) {
+	lines, err := self.readLines(run, allocPattern, taskPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &domain.LokiOutput{
+		Stdout: []domain.LokiLine{},
+		Stderr: []domain.LokiLine{},
+	}
+	for _, fileLines := range lines {
+		for _, line := range fileLines {
+			if line.Source == "stderr" {
+				output.Stderr = append(output.Stderr, line.LokiLine)
+			} else {
+				output.Stdout = append(output.Stdout, line.LokiLine)
+			}
+		}
+	}
+
+	sortLines := func(lines []domain.LokiLine) {
+		sort.SliceStable(lines, func(i, j int) bool {
+			return lines[i].Time.Before(lines[j].Time)
+		})
+	}
+	sortLines(output.Stdout)
+	sortLines(output.Stderr)
+
+	return output, nil
+}
+
+// Returns the lines of all matching files by path.
+func (self *fileLogProvider) readLines(run *domain.Run, allocPattern, taskPattern string) (map[string][]domain.LogLine, error) {
+	paths, err := filepath.Glob(filepath.Join(self.dir, run.NomadJobID.String(), allocPattern, taskPattern+".std*"))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := map[string][]domain.LogLine{}
+	for _, path := range paths {
+		taskName, logType := filepath.Base(path), ""
+		if i := strings.LastIndexByte(taskName, '.'); i != -1 {
+			taskName, logType = taskName[:i], taskName[i+1:]
+		}
+		if logType != "stdout" && logType != "stderr" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "Failed to read logs from %q", path)
+		}
+
+		for _, text := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			if text == "" {
+				continue
+			}
+
+			line := domain.LogLine{
+				LokiLine: domain.LokiLine{Time: info.ModTime(), Text: text},
+				Source:   logType,
+				AllocId:  filepath.Base(filepath.Dir(path)),
+				Task:     taskName,
+			}
+			if parts := strings.SplitN(text, " ", 2); len(parts) == 2 {
+				if t, err := time.Parse(time.RFC3339Nano, parts[0]); err == nil {
+					line.Time, line.Text = t, parts[1]
+				}
+			}
+
+			lines[path] = append(lines[path], line)
+		}
+	}
+
+	return lines, nil
+}
+
+// Files are read again every second and lines
+// that were added since are passed on in order.
+func (self *fileLogProvider) TailLogs(ctx context.Context, run *domain.Run, taskName string, since time.Time, fn func(domain.LogLine) error) error {
+	taskPattern := "*"
+	if taskName != "" {
+		taskPattern = filepath.Base(taskName)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	seen := map[string]int{}
+	for {
+		lines, err := self.readLines(run, "*", taskPattern)
+		if err != nil {
+			return err
+		}
+
+		newLines := []domain.LogLine{}
+		for path, fileLines := range lines {
+			// start over if the file was truncated
+			if seen[path] > len(fileLines) {
+				seen[path] = 0
+			}
+
+			for _, line := range fileLines[seen[path]:] {
+				if !line.Time.Before(since) {
+					newLines = append(newLines, line)
+				}
+			}
+			seen[path] = len(fileLines)
+		}
+
+		sort.SliceStable(newLines, func(i, j int) bool {
+			return newLines[i].Time.Before(newLines[j].Time)
+		})
+
+		for _, line := range newLines {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
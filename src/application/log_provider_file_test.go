@@ -0,0 +1,133 @@
+package application
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func TestShouldTailLogsFromFiles(t *testing.T) {
+	t.Parallel()
+
+	// given
+	dir := t.TempDir()
+	run := domain.Run{NomadJobID: uuid.New()}
+
+	allocDir := filepath.Join(dir, run.NomadJobID.String(), "alloc")
+	if err := os.MkdirAll(allocDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(allocDir, "main.stdout"), []byte("2022-03-16T10:00:00Z old\n2022-03-16T10:00:02Z third\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(allocDir, "main.stderr"), []byte("2022-03-16T10:00:01Z second\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logProvider := NewFileLogProvider(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// when
+	lines := []domain.LogLine{}
+	err := logProvider.TailLogs(ctx, &run, "main", time.Date(2022, 3, 16, 10, 0, 1, 0, time.UTC), func(line domain.LogLine) error {
+		lines = append(lines, line)
+		if len(lines) == 2 {
+			cancel()
+		}
+		return nil
+	})
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "second", lines[0].Text)
+		assert.Equal(t, "stderr", lines[0].Source)
+		assert.Equal(t, "third", lines[1].Text)
+		assert.Equal(t, "stdout", lines[1].Source)
+		assert.Equal(t, "alloc", lines[1].AllocId)
+		assert.Equal(t, "main", lines[1].Task)
+	}
+}
+
+func TestShouldPageThroughLogsFromFiles(t *testing.T) {
+	t.Parallel()
+
+	// given
+	dir := t.TempDir()
+	run := domain.Run{NomadJobID: uuid.New()}
+
+	allocDir := filepath.Join(dir, run.NomadJobID.String(), "alloc")
+	if err := os.MkdirAll(allocDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(allocDir, "main.stdout"), []byte("2022-03-16T10:00:00Z a1\n2022-03-16T10:00:01Z b\n2022-03-16T10:00:03Z a3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(allocDir, "main.stderr"), []byte("2022-03-16T10:00:02Z a2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logProvider := NewFileLogProvider(dir)
+	query := domain.LogQuery{Filter: "^a", Regex: true, Limit: 2}
+
+	// when
+	first, firstErr := logProvider.Logs(&run, query)
+	query.Cursor = first.NextCursor
+	second, secondErr := logProvider.Logs(&run, query)
+	_, invalidErr := logProvider.Logs(&run, domain.LogQuery{Filter: "(", Regex: true})
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+	texts := func(page *domain.LogPage) (texts []string) {
+		for _, line := range page.Lines {
+			texts = append(texts, line.Text)
+		}
+		return
+	}
+	assert.Equal(t, []string{"a1", "a2"}, texts(first))
+	assert.NotEmpty(t, first.NextCursor)
+	assert.Equal(t, []string{"a3"}, texts(second))
+	assert.Empty(t, second.NextCursor)
+	assert.ErrorIs(t, invalidErr, ErrInvalidLogQuery)
+}
+
+func TestShouldReadAllLogsFromFilesFromCursor(t *testing.T) {
+	t.Parallel()
+
+	// given
+	dir := t.TempDir()
+	run := domain.Run{NomadJobID: uuid.New()}
+
+	allocDir := filepath.Join(dir, run.NomadJobID.String(), "alloc")
+	if err := os.MkdirAll(allocDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(allocDir, "main.stdout"), []byte("2022-03-16T10:00:00Z a1\n2022-03-16T10:00:01Z b\n2022-03-16T10:00:02Z a2\n2022-03-16T10:00:03Z a3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logProvider := NewFileLogProvider(dir)
+
+	// when
+	texts := []string{}
+	err := logProvider.AllLogs(&run, domain.LogQuery{Filter: "a", Cursor: "1", Limit: 1}, func(line domain.LogLine) error {
+		texts = append(texts, line.Text)
+		return nil
+	})
+	invalidErr := logProvider.AllLogs(&run, domain.LogQuery{Cursor: "-1"}, func(domain.LogLine) error { return nil })
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a2", "a3"}, texts)
+	assert.ErrorIs(t, invalidErr, ErrInvalidLogQuery)
+}
@@ -0,0 +1,314 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/grafana/loki/pkg/loghttp"
+	"github.com/pkg/errors"
+	prometheus "github.com/prometheus/client_golang/api"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// Queries logs from Loki, into which they are shipped by Promtail or the like
+// with the labels nomad_job_id, nomad_alloc_id, nomad_task_group, nomad_task_name and source.
+type lokiLogProvider struct {
+	prometheus prometheus.Client
+}
+
+func NewLokiLogProvider(addr string) (LogProvider, error) {
+	if prom, err := prometheus.NewClient(prometheus.Config{
+		Address: addr,
+	}); err != nil {
+		return nil, errors.WithMessage(err, "Failed to create new prometheus client")
+	} else {
+		return &lokiLogProvider{prometheus: prom}, nil
+	}
+}
+
+// The filter is applied by Loki as a line filter expression.
+// Cursors consist of the time of the last line of the previous page
+// and the number of lines at that time that were already returned,
+// as more lines may have the same time.
+func (self *lokiLogProvider) Logs(run *domain.Run, query domain.LogQuery) (*domain.LogPage, error) {
+	selector := fmt.Sprintf(`nomad_job_id=%q`, run.NomadJobID.String())
+	if query.AllocId != "" {
+		selector += fmt.Sprintf(`,nomad_alloc_id=%q`, query.AllocId)
+	}
+	if query.Task != "" {
+		selector += fmt.Sprintf(`,nomad_task_name=%q`, query.Task)
+	}
+	logQL := "{" + selector + "}"
+
+	if query.Filter != "" {
+		// rejects invalid regular expressions early as Loki uses the same syntax
+		if _, err := logLineFilter(query); err != nil {
+			return nil, err
+		}
+
+		if query.Regex {
+			logQL += fmt.Sprintf(` |~ %q`, query.Filter)
+		} else {
+			logQL += fmt.Sprintf(` |= %q`, query.Filter)
+		}
+	}
+
+	start, seen := run.CreatedAt, 0
+	if query.Cursor != "" {
+		var nanos int64
+		if _, err := fmt.Sscanf(query.Cursor, "%d:%d", &nanos, &seen); err != nil || seen < 0 {
+			return nil, errors.WithMessagef(ErrInvalidLogQuery, "cursor %q is invalid", query.Cursor)
+		}
+		start = time.Unix(0, nanos)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 5000
+	}
+
+	streams, err := self.queryRange(logQL, start, lokiQueryEnd(run.FinishedAt), int64(limit+seen))
+	if err != nil {
+		return nil, err
+	}
+	lines := lokiLogLines(streams)
+
+	page := &domain.LogPage{Lines: []domain.LogLine{}}
+	skip := seen
+	for _, line := range lines {
+		if skip > 0 && line.Time.Equal(start) {
+			skip--
+			continue
+		}
+		page.Lines = append(page.Lines, line)
+	}
+
+	// there may be more lines if Loki returned as many as it was asked for
+	if len(lines) == limit+seen && len(page.Lines) > 0 {
+		last := page.Lines[len(page.Lines)-1].Time
+
+		lastSeen := 0
+		if last.Equal(start) {
+			lastSeen = seen
+		}
+		for _, line := range page.Lines {
+			if line.Time.Equal(last) {
+				lastSeen++
+			}
+		}
+
+		page.NextCursor = fmt.Sprintf("%d:%d", last.UnixNano(), lastSeen)
+	}
+
+	return page, nil
+}
+
+// Pages through the logs so that Loki never has to return all lines at once.
+func (self *lokiLogProvider) AllLogs(run *domain.Run, query domain.LogQuery, fn func(domain.LogLine) error) error {
+	query.Limit = 5000
+	for first := true; first || query.Cursor != ""; first = false {
+		page, err := self.Logs(run, query)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range page.Lines {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+
+		query.Cursor = page.NextCursor
+	}
+	return nil
+}
+
+func (self *lokiLogProvider) TaskLogs(run *domain.Run, allocID, taskGroup, taskName string) (*domain.LokiOutput, error) {
+	return self.LokiQueryRange(
+		fmt.Sprintf(`{nomad_alloc_id=%q,nomad_task_group=%q,nomad_task_name=%q}`, allocID, taskGroup, taskName),
+		run.CreatedAt, run.FinishedAt)
+}
+
+func (self *lokiLogProvider) TailLogs(ctx context.Context, run *domain.Run, taskName string, since time.Time, fn func(domain.LogLine) error) error {
+	query := fmt.Sprintf(`{nomad_job_id=%q}`, run.NomadJobID.String())
+	if taskName != "" {
+		query = fmt.Sprintf(`{nomad_job_id=%q,nomad_task_name=%q}`, run.NomadJobID.String(), taskName)
+	}
+
+	tailUrl := self.prometheus.URL("/loki/api/v1/tail", nil)
+	switch tailUrl.Scheme {
+	case "https":
+		tailUrl.Scheme = "wss"
+	default:
+		tailUrl.Scheme = "ws"
+	}
+	q := tailUrl.Query()
+	q.Set("query", query)
+	q.Set("start", strconv.FormatInt(since.UnixNano(), 10))
+	q.Set("limit", "5000")
+	tailUrl.RawQuery = q.Encode()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, tailUrl.String(), nil)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to tail logs from Loki")
+	}
+	defer conn.Close()
+
+	// unblocks reading once the context is done
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		response := loghttp.TailResponse{}
+		if err := conn.ReadJSON(&response); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.WithMessage(err, "Failed to read logs from Loki")
+		}
+
+		lines := lokiLogLines(response.Streams)
+
+		for _, line := range lines {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (self *lokiLogProvider) LokiQueryRange(query string, start time.Time, end *time.Time) (*domain.LokiOutput, error) {
+	linesToFetch := 10000
+	// TODO: figure out the correct value for our infra, 5000 is the default
+	// configuration in loki
+	var limit int64 = 5000
+	output := &domain.LokiOutput{
+		Stdout: []domain.LokiLine{},
+		Stderr: []domain.LokiLine{},
+	}
+
+	for {
+		streams, err := self.queryRange(query, start, lokiQueryEnd(end), limit)
+		if err != nil {
+			return output, err
+		}
+
+		if len(streams) == 0 {
+			return output, nil
+		}
+
+		for _, stream := range streams {
+			source, ok := stream.Labels.Map()["source"]
+
+			for _, entry := range stream.Entries {
+				if ok && source == "stderr" {
+					output.Stderr = append(output.Stderr, domain.LokiLine{Time: entry.Timestamp, Text: entry.Line})
+				} else {
+					output.Stdout = append(output.Stdout, domain.LokiLine{Time: entry.Timestamp, Text: entry.Line})
+				}
+
+				if (len(output.Stdout) + len(output.Stderr)) >= linesToFetch {
+					return output, nil
+				}
+			}
+
+			if int64(len(stream.Entries)) >= limit {
+				start = stream.Entries[len(stream.Entries)-1].Timestamp
+			} else if int64(len(stream.Entries)) < limit {
+				return output, nil
+			}
+		}
+	}
+}
+
+// Until when to query the logs of a run that ended at the given time, if at all.
+// Lines may arrive a little later than the run ended.
+func lokiQueryEnd(end *time.Time) time.Time {
+	if end == nil {
+		return time.Now().UTC().Add(1 * time.Minute)
+	}
+	return end.Add(1 * time.Minute)
+}
+
+func (self *lokiLogProvider) queryRange(query string, start, end time.Time, limit int64) (loghttp.Streams, error) {
+	req, err := http.NewRequest(
+		"GET",
+		self.prometheus.URL("/loki/api/v1/query_range", nil).String(),
+		http.NoBody,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Set("query", query)
+	q.Set("limit", strconv.FormatInt(limit, 10))
+	q.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	q.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	q.Set("direction", "FORWARD")
+	req.URL.RawQuery = q.Encode()
+
+	done, body, err := self.prometheus.Do(context.Background(), req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to talk with loki")
+	}
+
+	if done.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("Error response %d from Loki: %s", done.StatusCode, string(body))
+	}
+
+	response := loghttp.QueryResponse{}
+
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	streams, ok := response.Data.Result.(loghttp.Streams)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected loki result type: %s", response.Data.Result.Type())
+	}
+
+	return streams, nil
+}
+
+// Interleaves the lines of all streams in order.
+func lokiLogLines(streams loghttp.Streams) []domain.LogLine {
+	// the order of lines at the same time should not change between queries
+	sort.SliceStable(streams, func(i, j int) bool {
+		return streams[i].Labels.String() < streams[j].Labels.String()
+	})
+
+	lines := []domain.LogLine{}
+	for _, stream := range streams {
+		labels := stream.Labels.Map()
+		source := "stdout"
+		if labels["source"] == "stderr" {
+			source = "stderr"
+		}
+
+		for _, entry := range stream.Entries {
+			lines = append(lines, domain.LogLine{
+				LokiLine: domain.LokiLine{Time: entry.Timestamp, Text: entry.Line},
+				Source:   source,
+				AllocId:  labels["nomad_alloc_id"],
+				Task:     labels["nomad_task_name"],
+			})
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+
+	return lines
+}
@@ -0,0 +1,149 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/grafana/loki/pkg/loghttp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func TestShouldTailLogsInterleaved(t *testing.T) {
+	t.Parallel()
+
+	// given
+	run := domain.Run{NomadJobID: uuid.New()}
+	start := time.Unix(1000, 0)
+
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/loki/api/v1/tail", req.URL.Path)
+		assert.Equal(t, `{nomad_job_id="`+run.NomadJobID.String()+`",nomad_task_name="main"}`, req.URL.Query().Get("query"))
+
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		assert.NoError(t, conn.WriteJSON(loghttp.TailResponse{Streams: []loghttp.Stream{
+			{
+				Labels:  loghttp.LabelSet{"nomad_alloc_id": "alloc", "nomad_task_name": "main", "source": "stdout"},
+				Entries: []loghttp.Entry{{Timestamp: start, Line: "first"}, {Timestamp: start.Add(2 * time.Second), Line: "third"}},
+			},
+			{
+				Labels:  loghttp.LabelSet{"nomad_alloc_id": "alloc", "nomad_task_name": "main", "source": "stderr"},
+				Entries: []loghttp.Entry{{Timestamp: start.Add(time.Second), Line: "second"}},
+			},
+		}}))
+
+		// keep the connection open until the client is done
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer loki.Close()
+
+	logProvider, err := NewLokiLogProvider(loki.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// when
+	lines := []domain.LogLine{}
+	err = logProvider.TailLogs(ctx, &run, "main", start, func(line domain.LogLine) error {
+		lines = append(lines, line)
+		if len(lines) == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, "first", lines[0].Text)
+		assert.Equal(t, "stdout", lines[0].Source)
+		assert.Equal(t, "second", lines[1].Text)
+		assert.Equal(t, "stderr", lines[1].Source)
+		assert.Equal(t, "third", lines[2].Text)
+		assert.Equal(t, "alloc", lines[2].AllocId)
+		assert.Equal(t, "main", lines[2].Task)
+	}
+}
+
+func TestShouldPageThroughLogsFromLoki(t *testing.T) {
+	t.Parallel()
+
+	// given
+	run := domain.Run{NomadJobID: uuid.New(), CreatedAt: time.Unix(1000, 0)}
+	entries := []struct {
+		nanos int64
+		line  string
+	}{{1000e9, "a"}, {1001e9, "b"}, {1001e9, "c"}}
+
+	loki := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/loki/api/v1/query_range", req.URL.Path)
+		assert.Equal(t, `{nomad_job_id="`+run.NomadJobID.String()+`",nomad_task_name="main"} |= "x"`, req.URL.Query().Get("query"))
+
+		start, err := strconv.ParseInt(req.URL.Query().Get("start"), 10, 64)
+		assert.NoError(t, err)
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		assert.NoError(t, err)
+
+		values := [][]string{}
+		for _, entry := range entries {
+			if entry.nanos >= start && len(values) < limit {
+				values = append(values, []string{strconv.FormatInt(entry.nanos, 10), entry.line})
+			}
+		}
+
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data": map[string]interface{}{
+				"resultType": "streams",
+				"result": []interface{}{map[string]interface{}{
+					"stream": map[string]string{"nomad_task_name": "main", "source": "stdout"},
+					"values": values,
+				}},
+			},
+		}))
+	}))
+	defer loki.Close()
+
+	logProvider, err := NewLokiLogProvider(loki.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := domain.LogQuery{Task: "main", Filter: "x", Limit: 2}
+
+	// when
+	first, firstErr := logProvider.Logs(&run, query)
+	query.Cursor = first.NextCursor
+	second, secondErr := logProvider.Logs(&run, query)
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, secondErr)
+	texts := func(page *domain.LogPage) (texts []string) {
+		for _, line := range page.Lines {
+			texts = append(texts, line.Text)
+		}
+		return
+	}
+	assert.Equal(t, []string{"a", "b"}, texts(first))
+	assert.Equal(t, "1001000000000:1", first.NextCursor)
+	assert.Equal(t, []string{"c"}, texts(second))
+	assert.Empty(t, second.NextCursor)
+}
@@ -0,0 +1,222 @@
+package application
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pkg/errors"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// Reads logs from the file systems of allocations through the executor of the run's cluster.
+// This needs nothing but Nomad itself but only works as long as Nomad keeps the allocations.
+// The logs carry no times so lines are timestamped as they are read when tailing
+// and have no time otherwise.
+type nomadLogProvider struct {
+	nomadClusters NomadClusters
+}
+
+func NewNomadLogProvider(nomadClusters NomadClusters) LogProvider {
+	return &nomadLogProvider{nomadClusters: nomadClusters}
+}
+
+// Lines are in order of allocations, then tasks, then stdout before stderr.
+func (self *nomadLogProvider) Logs(run *domain.Run, query domain.LogQuery) (*domain.LogPage, error) {
+	lines, err := self.readLines(run, query)
+	if err != nil {
+		return nil, err
+	}
+	return pageLogLines(lines, query)
+}
+
+// Reads the logs only once, unlike paging through them.
+func (self *nomadLogProvider) AllLogs(run *domain.Run, query domain.LogQuery, fn func(domain.LogLine) error) error {
+	lines, err := self.readLines(run, query)
+	if err != nil {
+		return err
+	}
+	return eachLogLine(lines, query, fn)
+}
+
+// Reads all lines of the allocations and tasks that the query selects.
+func (self *nomadLogProvider) readLines(run *domain.Run, query domain.LogQuery) ([]domain.LogLine, error) {
+	executor, err := self.nomadClusters.Get(run.NomadCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs, _, err := executor.JobsAllocations(run.NomadJobID.String(), true, run.NomadQueryOptions())
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Failed to get allocations of job %q", run.NomadJobID)
+	}
+	sort.SliceStable(allocs, func(i, j int) bool {
+		return allocs[i].CreateTime < allocs[j].CreateTime
+	})
+
+	lines := []domain.LogLine{}
+	for _, alloc := range allocs {
+		if query.AllocId != "" && alloc.ID != query.AllocId {
+			continue
+		}
+
+		taskNames := make([]string, 0, len(alloc.TaskStates))
+		for taskName := range alloc.TaskStates {
+			if query.Task == "" || taskName == query.Task {
+				taskNames = append(taskNames, taskName)
+			}
+		}
+		sort.Strings(taskNames)
+
+		for _, taskName := range taskNames {
+			if err := self.readTaskLines(executor, run, alloc.ID, taskName, func(line domain.LogLine) {
+				lines = append(lines, line)
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+func (self *nomadLogProvider) TaskLogs(run *domain.Run, allocId, _, taskName string) (*domain.LokiOutput, error) {
+	executor, err := self.nomadClusters.Get(run.NomadCluster)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &domain.LokiOutput{
+		Stdout: []domain.LokiLine{},
+		Stderr: []domain.LokiLine{},
+	}
+	return output, self.readTaskLines(executor, run, allocId, taskName, func(line domain.LogLine) {
+		if line.Source == "stderr" {
+			output.Stderr = append(output.Stderr, line.LokiLine)
+		} else {
+			output.Stdout = append(output.Stdout, line.LokiLine)
+		}
+	})
+}
+
+func (self *nomadLogProvider) readTaskLines(executor Executor, run *domain.Run, allocId, taskName string, fn func(domain.LogLine)) error {
+	for _, logType := range []string{"stdout", "stderr"} {
+		reader, err := executor.AllocLogs(allocId, taskName, logType, false, nomad.OriginStart, run.NomadQueryOptions())
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to get %s of task %q of allocation %q", logType, taskName, allocId)
+		}
+
+		err = scanLogLines(reader, func(text string) bool {
+			fn(domain.LogLine{
+				LokiLine: domain.LokiLine{Text: text},
+				Source:   logType,
+				AllocId:  allocId,
+				Task:     taskName,
+			})
+			return true
+		})
+		reader.Close()
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to read %s of task %q of allocation %q", logType, taskName, allocId)
+		}
+	}
+	return nil
+}
+
+// Allocations and tasks that appear later are picked up by polling.
+// As there are no times, logs of allocations created before the given time
+// are followed from their current end, otherwise from the start.
+func (self *nomadLogProvider) TailLogs(ctx context.Context, run *domain.Run, taskName string, since time.Time, fn func(domain.LogLine) error) error {
+	executor, err := self.nomadClusters.Get(run.NomadCluster)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan domain.LogLine)
+	errs := make(chan error, 1)
+
+	follow := func(reader io.ReadCloser, allocId, taskName, logType string) {
+		go func() {
+			<-ctx.Done()
+			reader.Close()
+		}()
+
+		if err := scanLogLines(reader, func(text string) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case lines <- domain.LogLine{
+				LokiLine: domain.LokiLine{Time: time.Now(), Text: text},
+				Source:   logType,
+				AllocId:  allocId,
+				Task:     taskName,
+			}:
+				return true
+			}
+		}); err != nil && ctx.Err() == nil {
+			select {
+			case errs <- errors.WithMessagef(err, "Failed to read %s of task %q of allocation %q", logType, taskName, allocId):
+			default:
+			}
+		}
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	following := map[string]struct{}{}
+	for {
+		allocs, _, err := executor.JobsAllocations(run.NomadJobID.String(), true, run.NomadQueryOptions())
+		if err != nil && !IsNomadNotFound(err) {
+			return errors.WithMessagef(err, "Failed to get allocations of job %q", run.NomadJobID)
+		}
+
+		for _, alloc := range allocs {
+			origin := nomad.OriginStart
+			if since.After(time.Unix(0, alloc.CreateTime)) {
+				origin = nomad.OriginEnd
+			}
+
+			for allocTaskName := range alloc.TaskStates {
+				if taskName != "" && allocTaskName != taskName {
+					continue
+				}
+
+				for _, logType := range []string{"stdout", "stderr"} {
+					key := alloc.ID + "/" + allocTaskName + "/" + logType
+					if _, exists := following[key]; exists {
+						continue
+					}
+
+					reader, err := executor.AllocLogs(alloc.ID, allocTaskName, logType, true, origin, run.NomadQueryOptions())
+					if err != nil {
+						return errors.WithMessagef(err, "Failed to follow %s of task %q of allocation %q", logType, allocTaskName, alloc.ID)
+					}
+					following[key] = struct{}{}
+					go follow(reader, alloc.ID, allocTaskName, logType)
+				}
+			}
+		}
+
+		for polling := true; polling; {
+			select {
+			case <-ctx.Done():
+				return nil
+			case err := <-errs:
+				return err
+			case line := <-lines:
+				if err := fn(line); err != nil {
+					return err
+				}
+			case <-ticker.C:
+				polling = false
+			}
+		}
+	}
+}
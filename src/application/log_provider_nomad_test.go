@@ -0,0 +1,140 @@
+package application
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func TestShouldReadLogsFromAllocations(t *testing.T) {
+	t.Parallel()
+
+	// given
+	logger := zerolog.Nop()
+	executor, err := NewLocalExecutor(t.TempDir(), &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := executor.EventStream(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := domain.Run{NomadJobID: uuid.New(), NomadCluster: LocalNomadCluster}
+	jobId, groupName := run.NomadJobID.String(), "group"
+	if _, _, err := executor.JobsRegister(&nomad.Job{
+		ID: &jobId,
+		TaskGroups: []*nomad.TaskGroup{{
+			Name: &groupName,
+			Tasks: []*nomad.Task{{
+				Name:   "main",
+				Driver: "exec",
+				Config: map[string]interface{}{
+					"command": "/bin/sh",
+					"args":    []interface{}{"-c", "echo out; echo err >&2"},
+				},
+			}},
+		}},
+	}, &nomad.WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var alloc *nomad.Allocation
+	for alloc == nil || !alloc.ClientTerminalStatus() {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the allocation to end")
+		case events := <-stream:
+			if alloc, err = events.Events[0].Allocation(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	logProvider := NewNomadLogProvider(NomadClusters{{Name: LocalNomadCluster, Executor: executor}})
+
+	// when
+	page, pageErr := logProvider.Logs(&run, domain.LogQuery{Task: "main", Limit: 10})
+	taskLogs, taskErr := logProvider.TaskLogs(&run, alloc.ID, groupName, "main")
+
+	// then
+	if assert.NoError(t, pageErr) {
+		assert.Equal(t, []domain.LogLine{
+			{LokiLine: domain.LokiLine{Text: "out"}, Source: "stdout", AllocId: alloc.ID, Task: "main"},
+			{LokiLine: domain.LokiLine{Text: "err"}, Source: "stderr", AllocId: alloc.ID, Task: "main"},
+		}, page.Lines)
+		assert.Empty(t, page.NextCursor)
+	}
+
+	if assert.NoError(t, taskErr) {
+		assert.Equal(t, []domain.LokiLine{{Text: "out"}}, taskLogs.Stdout)
+		assert.Equal(t, []domain.LokiLine{{Text: "err"}}, taskLogs.Stderr)
+	}
+
+	_, err = logProvider.TaskLogs(&run, alloc.ID, groupName, "unknown")
+	assert.Error(t, err)
+}
+
+// Serves the same logs for every task of a fixed set of allocations and counts how often they are read.
+type countingLogExecutor struct {
+	Executor
+
+	allocs []*nomad.AllocationListStub
+	logs   string
+
+	mutex sync.Mutex
+	reads int
+}
+
+func (self *countingLogExecutor) JobsAllocations(string, bool, *nomad.QueryOptions) ([]*nomad.AllocationListStub, *nomad.QueryMeta, error) {
+	return self.allocs, nil, nil
+}
+
+func (self *countingLogExecutor) AllocLogs(_, _, logType string, _ bool, _ string, _ *nomad.QueryOptions) (io.ReadCloser, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.reads++
+	if logType == "stderr" {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return io.NopCloser(strings.NewReader(self.logs)), nil
+}
+
+func TestShouldReadAllLogsFromAllocationsOnce(t *testing.T) {
+	t.Parallel()
+
+	// given
+	executor := &countingLogExecutor{
+		allocs: []*nomad.AllocationListStub{{ID: "alloc", TaskStates: map[string]*nomad.TaskState{"main": {}}}},
+		logs:   strings.Repeat("skipped\nline\n", 5000),
+	}
+	run := domain.Run{NomadJobID: uuid.New()}
+	logProvider := NewNomadLogProvider(NomadClusters{{Executor: executor}})
+
+	// when
+	count := 0
+	err := logProvider.AllLogs(&run, domain.LogQuery{Filter: "line", Cursor: "2", Limit: 10}, func(line domain.LogLine) error {
+		count++
+		return nil
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 4999, count)
+	assert.Equal(t, 2, executor.reads, "stdout and stderr should be read once each")
+}
@@ -33,6 +33,18 @@ type ActionService interface {
 	Update(*domain.Action) error
 	IsRunnable(*domain.Action) (bool, map[string]interface{}, error)
 	Create(string, string) (*domain.Action, error)
+	Refresh(*domain.Action) (*domain.Action, error)
+	Diff(from, to *domain.Action) (domain.ActionDiff, error)
+	Promote(*domain.Action) (*domain.Action, error)
+	SaveVersion(*domain.Action) error
+	Archive(name string) error
+	Unarchive(name string) error
+	// Summarizes what DeleteByName would remove.
+	GetDeletionByName(string) (domain.ActionDeletion, error)
+	// Deletes all versions of an action with their runs and the facts those produced
+	// and stops the Nomad jobs of unfinished runs.
+	// Fails if runs of other actions took any of these facts as inputs.
+	DeleteByName(string) (domain.ActionDeletion, error)
 	Invoke(*domain.Action) (bool, error)
 	InvokeCurrentActive() error
 }
@@ -43,17 +55,17 @@ type actionService struct {
 	factRepository    repository.FactRepository
 	evaluationService EvaluationService
 	runService        RunService
-	nomadClient       application.NomadClient
+	nomadClusters     application.NomadClusters
 	db                config.PgxIface
 }
 
-func NewActionService(db config.PgxIface, nomadClient application.NomadClient, runService RunService, evaluationService EvaluationService, logger *zerolog.Logger) ActionService {
+func NewActionService(db config.PgxIface, nomadClusters application.NomadClusters, runService RunService, evaluationService EvaluationService, logger *zerolog.Logger) ActionService {
 	return &actionService{
 		logger:            logger.With().Str("component", "ActionService").Logger(),
 		actionRepository:  persistence.NewActionRepository(db),
 		factRepository:    persistence.NewFactRepository(db),
 		evaluationService: evaluationService,
-		nomadClient:       nomadClient,
+		nomadClusters:     nomadClusters,
 		runService:        runService,
 		db:                db,
 	}
@@ -66,7 +78,7 @@ func (self *actionService) WithQuerier(querier config.PgxIface) ActionService {
 		factRepository:    self.factRepository.WithQuerier(querier),
 		runService:        self.runService.WithQuerier(querier),
 		evaluationService: self.evaluationService,
-		nomadClient:       self.nomadClient,
+		nomadClusters:     self.nomadClusters,
 		db:                querier,
 	}
 }
@@ -489,14 +501,75 @@ func collectFieldPaths(value cue.Value) (paths [][]string) {
 }
 
 func (self *actionService) Create(source, name string) (*domain.Action, error) {
+	revision, err := self.evaluationService.ResolveSource(source)
+	if err != nil {
+		self.logger.Err(err).Str("source", source).Msg("Could not resolve source")
+		return nil, err
+	}
+
+	return self.create(source, revision, name)
+}
+
+// Creates a new version of the action from the latest revision of its source.
+// Returns the given action if its source did not change.
+func (self *actionService) Refresh(action *domain.Action) (*domain.Action, error) {
+	revision, err := self.evaluationService.ResolveSource(action.Source)
+	if err != nil {
+		self.logger.Err(err).Str("source", action.Source).Msg("Could not resolve source")
+		return nil, err
+	}
+
+	if action.SourceRevision != nil && *action.SourceRevision == revision {
+		self.logger.Debug().
+			Str("id", action.ID.String()).
+			Str("revision", revision).
+			Msg("Source of Action did not change")
+		return action, nil
+	}
+
+	return self.create(action.Source, revision, action.Name)
+}
+
+// Compares two versions of an action.
+// Failing to evaluate their definitions is reported in the result, not as error.
+// Both are evaluated with the same ID so that it does not show up as a change.
+func (self *actionService) Diff(from, to *domain.Action) (diff domain.ActionDiff, err error) {
+	diff.From = from.ID
+	diff.To = to.ID
+
+	if diff.Changes, err = domain.DiffJsonOf(from.Version(), to.Version()); err != nil {
+		err = errors.WithMessage(err, "Could not compare Actions")
+		return
+	}
+
+	evaluate := func(action *domain.Action) (domain.ActionDefinition, error) {
+		def, err := self.evaluationService.EvaluateAction(action.Source, action.SourceRevision, action.Name, to.ID)
+		return def, errors.WithMessagef(err, "Could not evaluate Action %q", action.ID)
+	}
+
+	if fromDef, err := evaluate(from); err != nil {
+		msg := err.Error()
+		diff.DefinitionError = &msg
+	} else if toDef, err := evaluate(to); err != nil {
+		msg := err.Error()
+		diff.DefinitionError = &msg
+	} else if diff.DefinitionChanges, err = domain.DiffJsonOf(fromDef, toDef); err != nil {
+		return diff, errors.WithMessage(err, "Could not compare Action definitions")
+	}
+
+	return
+}
+
+func (self *actionService) create(source, revision, name string) (*domain.Action, error) {
 	action := domain.Action{
-		ID:     uuid.New(),
-		Name:   name,
-		Source: source,
+		ID:             uuid.New(),
+		Name:           name,
+		Source:         source,
+		SourceRevision: &revision,
 	}
 
 	var actionDef domain.ActionDefinition
-	if def, err := self.evaluationService.EvaluateAction(source, name, action.ID); err != nil {
+	if def, err := self.evaluationService.EvaluateAction(source, &revision, name, action.ID); err != nil {
 		self.logger.Err(err).Send()
 		return nil, err
 	} else {
@@ -505,32 +578,165 @@ func (self *actionService) Create(source, name string) (*domain.Action, error) {
 
 	action.Meta = actionDef.Meta
 	action.Inputs = actionDef.Inputs
+	action.Active = true
+
+	if err := self.SaveVersion(&action); err != nil {
+		return nil, err
+	}
+
+	return &action, nil
+}
+
+// Makes a copy of an older version the latest version of the action.
+// The copy is active only if the given version is.
+// Returns the given action if it already is the latest version.
+func (self *actionService) Promote(action *domain.Action) (*domain.Action, error) {
+	if latest, err := self.GetLatestByName(action.Name); err != nil {
+		return nil, err
+	} else if latest.ID == action.ID {
+		self.logger.Debug().
+			Str("id", action.ID.String()).
+			Msg("Action is already the latest version")
+		return action, nil
+	}
+
+	promoted := *action
+	promoted.ID = uuid.New()
+
+	if err := self.SaveVersion(&promoted); err != nil {
+		return nil, err
+	}
+
+	self.logger.Debug().
+		Str("id", promoted.ID.String()).
+		Str("promoted-id", action.ID.String()).
+		Msg("Promoted Action")
+
+	return &promoted, nil
+}
+
+// Saves a new version of an action, deactivating the previous one,
+// and invokes it if active.
+func (self *actionService) SaveVersion(action *domain.Action) error {
+	if err := action.ValidateMeta(); err != nil {
+		return errors.WithMessagef(err, "Invalid Action %q", action.Name)
+	}
+	if nomad, err := action.Nomad(); err == nil && nomad != nil && nomad.Cluster != "" {
+		if _, err := self.nomadClusters.Get(nomad.Cluster); err != nil {
+			return errors.WithMessagef(err, "Invalid Action %q", action.Name)
+		}
+	}
 
-	if err := self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
+	return self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
 		txSelf := self.WithQuerier(tx)
 
 		// deactivate previous version for convenience
 		if prev, err := txSelf.GetLatestByName(action.Name); err != nil && !pgxscan.NotFound(err) {
 			return err
-		} else if err == nil && prev.Active {
-			prev.Active = false
-			if err := txSelf.Update(&prev); err != nil {
-				return err
+		} else if err == nil {
+			if prev.Active {
+				prev.Active = false
+				if err := txSelf.Update(&prev); err != nil {
+					return err
+				}
+			}
+
+			// saving a new version brings an archived action back
+			if prev.ArchivedAt != nil {
+				if err := txSelf.Unarchive(action.Name); err != nil {
+					return err
+				}
 			}
 		}
 
-		if err := txSelf.Save(&action); err != nil {
+		if err := txSelf.Save(action); err != nil {
 			return err
 		}
 
-		_, err := txSelf.Invoke(&action)
+		// new actions are active by default
+		if !action.Active {
+			return txSelf.Update(action)
+		}
+
+		_, err := txSelf.Invoke(action)
 
 		return err
+	})
+}
+
+func (self *actionService) Archive(name string) error {
+	self.logger.Debug().Str("name", name).Msg("Archiving Action")
+	if err := self.actionRepository.Archive(name); err != nil {
+		return errors.WithMessagef(err, "Could not archive Action with name %q", name)
+	}
+	self.logger.Debug().Str("name", name).Msg("Archived Action")
+	return nil
+}
+
+func (self *actionService) Unarchive(name string) error {
+	self.logger.Debug().Str("name", name).Msg("Unarchiving Action")
+	if err := self.actionRepository.Unarchive(name); err != nil {
+		return errors.WithMessagef(err, "Could not unarchive Action with name %q", name)
+	}
+	self.logger.Debug().Str("name", name).Msg("Unarchived Action")
+	return nil
+}
+
+func (self *actionService) GetDeletionByName(name string) (deletion domain.ActionDeletion, err error) {
+	self.logger.Debug().Str("name", name).Msg("Getting Action deletion by name")
+	deletion, err = self.actionRepository.GetDeletionByName(name)
+	err = errors.WithMessagef(err, "Could not select what to delete for Action with name %q", name)
+	return
+}
+
+func (self *actionService) DeleteByName(name string) (deletion domain.ActionDeletion, err error) {
+	logger := self.logger.With().Str("name", name).Logger()
+
+	unfinishedRuns := []domain.Run{}
+	if err = self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
+		txSelf := self.WithQuerier(tx)
+
+		if deletion, err = txSelf.GetDeletionByName(name); err != nil {
+			return err
+		} else if !deletion.Possible() {
+			return fmt.Errorf("Cannot delete Action with name %q because %d runs of other Actions took facts it produced as inputs", name, len(deletion.DependentRuns))
+		}
+
+		// needed to find the jobs after deletion
+		for _, runId := range deletion.UnfinishedRuns {
+			if run, err := self.runService.WithQuerier(tx).GetByNomadJobId(runId); err != nil {
+				return err
+			} else {
+				unfinishedRuns = append(unfinishedRuns, run)
+			}
+		}
+
+		logger.Debug().Msg("Deleting Action")
+		if err := self.actionRepository.WithQuerier(tx).DeleteByName(name); err != nil {
+			return errors.WithMessagef(err, "Could not delete Action with name %q", name)
+		}
+
+		return nil
 	}); err != nil {
-		return nil, err
+		return
 	}
 
-	return &action, nil
+	// The runs are gone already so events for these jobs are ignored.
+	for _, run := range unfinishedRuns {
+		if executor, err := self.nomadClusters.Get(run.NomadCluster); err != nil {
+			logger.Warn().Err(err).Str("nomad-job", run.NomadJobID.String()).Msg("Failed to deregister job of deleted Run")
+		} else if _, _, err := executor.JobsDeregister(run.NomadJobID.String(), false, run.NomadWriteOptions()); err != nil {
+			logger.Warn().Err(err).Str("nomad-job", run.NomadJobID.String()).Msg("Failed to deregister job of deleted Run")
+		}
+	}
+
+	logger.Debug().
+		Int("actions", deletion.Actions).
+		Int("runs", deletion.Runs).
+		Int("facts", deletion.Facts).
+		Msg("Deleted Action")
+
+	return
 }
 
 func (self *actionService) Invoke(action *domain.Action) (bool, error) {
@@ -544,7 +750,7 @@ func (self *actionService) Invoke(action *domain.Action) (bool, error) {
 			return err
 		}
 
-		runDef, err := self.evaluationService.EvaluateRun(action.Source, action.Name, action.ID, inputs)
+		runDef, evaluation, err := self.evaluationService.EvaluateRun(action.Source, action.SourceRevision, action.Name, action.ID, inputs)
 		if err != nil {
 			var evalErr EvaluationError
 			if errors.As(err, &evalErr) {
@@ -557,44 +763,86 @@ func (self *actionService) Invoke(action *domain.Action) (bool, error) {
 		}
 
 		run := domain.Run{
-			ActionId: action.ID,
+			ActionId:     action.ID,
+			Attempt:      1,
+			NomadCluster: self.nomadClusters.Default().Name,
+		}
+		if err := self.targetNomad(action, &run, runDef.Job); err != nil {
+			return err
 		}
 
 		if err := self.runService.WithQuerier(tx).Save(&run, inputs, &runDef.Output); err != nil {
 			return errors.WithMessage(err, "Could not insert Run")
 		}
 
+		runId := run.NomadJobID.String()
+		if !runDef.IsDecision() {
+			runDef.Job.ID = &runId
+		}
+
+		if err := self.runService.WithQuerier(tx).SaveJob(&domain.RunJob{
+			RunId:         run.NomadJobID,
+			RunEvaluation: evaluation,
+			Job:           runDef.Job,
+		}); err != nil {
+			return err
+		}
+
 		if runDef.IsDecision() {
+			var fact *domain.Fact
 			if runDef.Output.Success != nil {
-				if err := self.factRepository.WithQuerier(tx).Save(&domain.Fact{Value: runDef.Output.Success}, nil); err != nil {
+				fact = &domain.Fact{Value: runDef.Output.Success}
+				if err := self.factRepository.WithQuerier(tx).Save(fact, nil); err != nil {
 					return errors.WithMessage(err, "Could not publish fact")
 				}
 			}
+			runDef.Output.Publish(domain.RunOutputPublishedSuccess, fact)
 
 			run.CreatedAt = run.CreatedAt.UTC()
+			run.StartedAt = &run.CreatedAt
 			run.FinishedAt = &run.CreatedAt
 
-			err := self.runService.WithQuerier(tx).Update(&run)
-			err = errors.WithMessage(err, "Could not update decision Run")
+			err := self.runService.WithQuerier(tx).End(&run, &runDef.Output)
+			err = errors.WithMessage(err, "Could not end decision Run")
 
 			return err
 		}
 
-		runId := run.NomadJobID.String()
-		runDef.Job.ID = &runId
-
-		if response, _, err := self.nomadClient.JobsRegister(runDef.Job, &nomad.WriteOptions{}); err != nil {
-			return errors.WithMessage(err, "Failed to run Action")
-		} else if len(response.Warnings) > 0 {
-			self.logger.Warn().
-				Str("nomad-job", runId).
-				Str("nomad-evaluation", response.EvalID).
-				Str("warnings", response.Warnings).
-				Msg("Warnings occured registering Nomad job")
+		return self.runService.WithQuerier(tx).Schedule(&run, action)
+	})
+}
+
+// Sets where the run's job is scheduled from the action's meta and the job itself.
+func (self *actionService) targetNomad(action *domain.Action, run *domain.Run, job *nomad.Job) error {
+	target, err := action.Nomad()
+	if err != nil {
+		return errors.WithMessagef(err, "Could not get Nomad target of Action with ID %q", action.ID)
+	} else if target == nil {
+		target = &domain.ActionNomad{}
+	}
+
+	if target.Cluster != "" {
+		if _, err := self.nomadClusters.Get(target.Cluster); err != nil {
+			return errors.WithMessagef(err, "Invalid Nomad cluster of Action with ID %q", action.ID)
 		}
+		run.NomadCluster = target.Cluster
+	}
 
+	// decisions have no job
+	if job == nil {
 		return nil
-	})
+	}
+
+	if target.Namespace != "" {
+		job.Namespace = &target.Namespace
+	}
+	if target.Region != "" {
+		job.Region = &target.Region
+	}
+	run.NomadNamespace = job.Namespace
+	run.NomadRegion = job.Region
+
+	return nil
 }
 
 func (self *actionService) InvokeCurrentActive() error {
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+	"github.com/input-output-hk/cicero/src/infrastructure/persistence"
+)
+
+type ActionSetService interface {
+	WithQuerier(config.PgxIface) ActionSetService
+
+	GetById(uuid.UUID) (domain.ActionSet, error)
+	GetAll() ([]*domain.ActionSet, error)
+	GetSyncsByActionSetId(uuid.UUID, *repository.Page) ([]*domain.ActionSetSync, error)
+	// Creates the set and syncs it right away.
+	Create(source string, match *string) (*domain.ActionSet, domain.ActionSetSync, error)
+	Update(*domain.ActionSet) error
+	// Syncs the actions of the set with its source and records the result.
+	// Problems with the source are recorded, not returned.
+	Sync(*domain.ActionSet, *domain.Fact) (domain.ActionSetSync, error)
+	// Syncs all active sets that were not synced within the interval
+	// or whose match is satisfied by a new fact.
+	// Sets without match are never synced if the interval is 0.
+	SyncDue(interval time.Duration) error
+}
+
+type actionSetService struct {
+	logger                  zerolog.Logger
+	actionSetRepository     repository.ActionSetRepository
+	actionSetSyncRepository repository.ActionSetSyncRepository
+	factRepository          repository.FactRepository
+	actionService           ActionService
+	evaluationService       EvaluationService
+	db                      config.PgxIface
+}
+
+func NewActionSetService(db config.PgxIface, actionService ActionService, evaluationService EvaluationService, logger *zerolog.Logger) ActionSetService {
+	return &actionSetService{
+		logger:                  logger.With().Str("component", "ActionSetService").Logger(),
+		actionSetRepository:     persistence.NewActionSetRepository(db),
+		actionSetSyncRepository: persistence.NewActionSetSyncRepository(db),
+		factRepository:          persistence.NewFactRepository(db),
+		actionService:           actionService,
+		evaluationService:       evaluationService,
+		db:                      db,
+	}
+}
+
+func (self *actionSetService) WithQuerier(querier config.PgxIface) ActionSetService {
+	return &actionSetService{
+		logger:                  self.logger,
+		actionSetRepository:     self.actionSetRepository.WithQuerier(querier),
+		actionSetSyncRepository: self.actionSetSyncRepository.WithQuerier(querier),
+		factRepository:          self.factRepository.WithQuerier(querier),
+		actionService:           self.actionService.WithQuerier(querier),
+		evaluationService:       self.evaluationService,
+		db:                      querier,
+	}
+}
+
+func (self *actionSetService) GetById(id uuid.UUID) (set domain.ActionSet, err error) {
+	self.logger.Debug().Str("id", id.String()).Msg("Getting Action Set by ID")
+	set, err = self.actionSetRepository.GetById(id)
+	err = errors.WithMessagef(err, "Could not select existing Action Set for ID %q", id)
+	return
+}
+
+func (self *actionSetService) GetAll() (sets []*domain.ActionSet, err error) {
+	self.logger.Debug().Msg("Getting all Action Sets")
+	sets, err = self.actionSetRepository.GetAll()
+	err = errors.WithMessage(err, "Could not select Action Sets")
+	return
+}
+
+func (self *actionSetService) GetSyncsByActionSetId(id uuid.UUID, page *repository.Page) (syncs []*domain.ActionSetSync, err error) {
+	self.logger.Debug().Str("id", id.String()).Int("offset", page.Offset).Int("limit", page.Limit).Msg("Getting Action Set Syncs by Action Set ID")
+	syncs, err = self.actionSetSyncRepository.GetByActionSetId(id, page)
+	err = errors.WithMessagef(err, "Could not select Action Set Syncs for Action Set ID %q with offset %d and limit %d", id, page.Offset, page.Limit)
+	return
+}
+
+func (self *actionSetService) Create(source string, match *string) (*domain.ActionSet, domain.ActionSetSync, error) {
+	set := domain.ActionSet{
+		Source: source,
+		Match:  match,
+		Active: true,
+	}
+
+	if match != nil {
+		matchCue := domain.InputDefinitionMatch(*match)
+		if err := matchCue.WithoutInputs().Err(); err != nil {
+			return nil, domain.ActionSetSync{}, errors.WithMessage(err, "Invalid match")
+		}
+	}
+
+	self.logger.Debug().Str("source", source).Msg("Saving new Action Set")
+	if err := self.actionSetRepository.Save(&set); err != nil {
+		return nil, domain.ActionSetSync{}, errors.WithMessage(err, "Could not insert Action Set")
+	}
+	self.logger.Debug().Str("id", set.ID.String()).Msg("Created Action Set")
+
+	sync, err := self.Sync(&set, nil)
+	return &set, sync, err
+}
+
+func (self *actionSetService) Update(set *domain.ActionSet) error {
+	self.logger.Debug().Str("id", set.ID.String()).Msg("Updating Action Set")
+	if err := self.actionSetRepository.Update(set); err != nil {
+		return errors.WithMessagef(err, "Could not update Action Set with ID %q", set.ID)
+	}
+	self.logger.Debug().Str("id", set.ID.String()).Msg("Updated Action Set")
+	return nil
+}
+
+func (self *actionSetService) Sync(set *domain.ActionSet, fact *domain.Fact) (domain.ActionSetSync, error) {
+	logger := self.logger.With().
+		Str("id", set.ID.String()).
+		Str("source", set.Source).
+		Logger()
+
+	logger.Debug().Msg("Syncing Action Set")
+
+	sync := domain.ActionSetSync{
+		ActionSetId: set.ID,
+		Changes:     []domain.ActionSetChange{},
+	}
+	if fact != nil {
+		sync.FactId = &fact.ID
+	}
+
+	// before syncing so that facts created meanwhile can still trigger the next sync
+	now := time.Now().UTC()
+
+	if revision, changes, err := self.sync(set.Source); err != nil {
+		logger.Err(err).Msg("Could not sync Action Set")
+		msg := err.Error()
+		sync.Error = &msg
+	} else {
+		sync.SourceRevision = &revision
+		sync.Changes = changes
+		set.SourceRevision = &revision
+	}
+
+	set.SyncedAt = &now
+
+	if err := self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
+		if err := self.actionSetRepository.WithQuerier(tx).Update(set); err != nil {
+			return errors.WithMessagef(err, "Could not update Action Set with ID %q", set.ID)
+		}
+		if err := self.actionSetSyncRepository.WithQuerier(tx).Save(&sync); err != nil {
+			return errors.WithMessagef(err, "Could not insert Action Set Sync for Action Set with ID %q", set.ID)
+		}
+		return nil
+	}); err != nil {
+		return sync, err
+	}
+
+	logger.Debug().Str("sync-id", sync.ID.String()).Msg("Synced Action Set")
+
+	return sync, nil
+}
+
+func (self *actionSetService) sync(source string) (string, []domain.ActionSetChange, error) {
+	revision, err := self.evaluationService.ResolveSource(source)
+	if err != nil {
+		return "", nil, err
+	}
+
+	names, err := self.evaluationService.ListActions(source)
+	if err != nil {
+		return revision, nil, err
+	}
+
+	current, err := self.actionService.GetCurrent()
+	if err != nil {
+		return revision, nil, err
+	}
+
+	currentByName := map[string]*domain.Action{}
+	for _, action := range current {
+		currentByName[action.Name] = action
+	}
+
+	changes := []domain.ActionSetChange{}
+
+	listed := map[string]struct{}{}
+	for _, name := range names {
+		listed[name] = struct{}{}
+		changes = append(changes, self.syncAction(source, revision, name, currentByName[name]))
+	}
+
+	for _, action := range current {
+		if action.Source != source || !action.Active {
+			continue
+		}
+		if _, exists := listed[action.Name]; exists {
+			continue
+		}
+
+		change := domain.ActionSetChange{
+			Name:     action.Name,
+			Kind:     domain.ActionSetChangeDeactivated,
+			ActionId: &action.ID,
+		}
+
+		action.Active = false
+		if err := self.actionService.Update(action); err != nil {
+			msg := err.Error()
+			change.Kind = domain.ActionSetChangeFailed
+			change.Error = &msg
+		}
+
+		changes = append(changes, change)
+	}
+
+	return revision, changes, nil
+}
+
+// Creates a new version of the action if its definition changed.
+func (self *actionSetService) syncAction(source, revision, name string, current *domain.Action) domain.ActionSetChange {
+	change := domain.ActionSetChange{Name: name}
+
+	fail := func(err error) domain.ActionSetChange {
+		msg := err.Error()
+		change.Kind = domain.ActionSetChangeFailed
+		change.Error = &msg
+		return change
+	}
+
+	if current != nil {
+		change.ActionId = &current.ID
+
+		if current.Source != source {
+			return fail(fmt.Errorf("Action %q already exists with source %q", name, current.Source))
+		}
+	} else if latest, err := self.actionService.GetLatestByName(name); err != nil && !pgxscan.NotFound(err) {
+		return fail(err)
+	} else if err == nil && latest.ArchivedAt != nil {
+		change.Kind = domain.ActionSetChangeArchived
+		change.ActionId = &latest.ID
+		return change
+	}
+
+	action := domain.Action{
+		ID:             uuid.New(),
+		Name:           name,
+		Source:         source,
+		SourceRevision: &revision,
+		Active:         true,
+	}
+
+	if def, err := self.evaluationService.EvaluateAction(source, &revision, name, action.ID); err != nil {
+		return fail(err)
+	} else {
+		action.ActionDefinition = def
+	}
+
+	if current == nil {
+		change.Kind = domain.ActionSetChangeCreated
+	} else if diff, err := domain.DiffJsonOf(current.ActionDefinition, action.ActionDefinition); err != nil {
+		return fail(err)
+	} else if len(diff) == 0 {
+		change.Kind = domain.ActionSetChangeUnchanged
+		return change
+	} else {
+		change.Kind = domain.ActionSetChangeUpdated
+		// keep actions deactivated by hand deactivated
+		action.Active = current.Active
+	}
+
+	if err := self.actionService.SaveVersion(&action); err != nil {
+		return fail(err)
+	}
+	change.ActionId = &action.ID
+
+	return change
+}
+
+func (self *actionSetService) SyncDue(interval time.Duration) error {
+	sets, err := self.actionSetRepository.GetActive()
+	if err != nil {
+		return errors.WithMessage(err, "Could not select active Action Sets")
+	}
+
+	for _, set := range sets {
+		var fact *domain.Fact
+		if set.Match != nil {
+			if fact, err = self.getTriggeringFact(set); err != nil {
+				return err
+			} else if fact == nil {
+				continue
+			}
+		} else if interval == 0 || (set.SyncedAt != nil && time.Since(*set.SyncedAt) < interval) {
+			continue
+		}
+
+		if _, err := self.Sync(set, fact); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the latest fact that matches the set's match
+// of those that were created after the last sync.
+func (self *actionSetService) getTriggeringFact(set *domain.ActionSet) (*domain.Fact, error) {
+	matchCue := domain.InputDefinitionMatch(*set.Match)
+	match := matchCue.WithoutInputs()
+	if err := match.Err(); err != nil {
+		return nil, errors.WithMessagef(err, "Invalid match of Action Set %q", set.ID)
+	}
+
+	var since time.Time
+	if set.SyncedAt != nil {
+		since = *set.SyncedAt
+	}
+
+	facts, err := self.factRepository.GetByFieldsCreatedAfter(collectFieldPaths(match), since)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Could not select Facts for Action Set %q", set.ID)
+	}
+
+	for _, fact := range facts {
+		if matches, err := matchFact(match, fact); err != nil {
+			return nil, err
+		} else if matches {
+			return fact, nil
+		}
+	}
+
+	return nil, nil
+}
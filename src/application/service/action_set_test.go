@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/pashagolub/pgxmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+)
+
+// Calling methods that are not overridden panics.
+type fakeActionService struct {
+	ActionService
+
+	current []*domain.Action
+	latest  map[string]domain.Action
+	saved   []*domain.Action
+	updated []*domain.Action
+}
+
+func (self *fakeActionService) GetCurrent() ([]*domain.Action, error) {
+	return self.current, nil
+}
+
+func (self *fakeActionService) GetLatestByName(name string) (domain.Action, error) {
+	if action, exists := self.latest[name]; exists {
+		return action, nil
+	}
+	return domain.Action{}, pgx.ErrNoRows
+}
+
+func (self *fakeActionService) SaveVersion(action *domain.Action) error {
+	self.saved = append(self.saved, action)
+	return nil
+}
+
+func (self *fakeActionService) Update(action *domain.Action) error {
+	self.updated = append(self.updated, action)
+	return nil
+}
+
+func TestShouldSyncActionSetChanges(t *testing.T) {
+	// given
+	t.Setenv("CICERO_CACHE_DIR", t.TempDir())
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "actions.cue"), []byte(`
+package actions
+
+actions: {
+	"test/archived": meta: n:  1
+	"test/changed": meta: n:   2
+	"test/created": meta: n:   3
+	"test/unchanged": meta: n: 4
+}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	evaluationService, err := NewEvaluationService(nil, []string{cueEvaluatorName}, nil, 0, 0, 0, 0, 0, EvaluationSandbox{}, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unchangedDef, err := evaluationService.EvaluateAction(src, nil, "test/unchanged", uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivedAt := time.Now()
+	changed := &domain.Action{ID: uuid.New(), Name: "test/changed", Source: src, Active: false}
+	changed.Meta = map[string]interface{}{"n": 1}
+	unchanged := &domain.Action{ID: uuid.New(), Name: "test/unchanged", Source: src, Active: true, ActionDefinition: unchangedDef}
+	gone := &domain.Action{ID: uuid.New(), Name: "test/gone", Source: src, Active: true}
+	archived := domain.Action{ID: uuid.New(), Name: "test/archived", Source: src, ArchivedAt: &archivedAt}
+
+	actionService := &fakeActionService{
+		current: []*domain.Action{changed, unchanged, gone},
+		latest:  map[string]domain.Action{archived.Name: archived},
+	}
+	actionSetService := &actionSetService{
+		logger:            logger,
+		actionService:     actionService,
+		evaluationService: evaluationService,
+	}
+
+	// when
+	_, changes, err := actionSetService.sync(src)
+
+	// then
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 5) {
+		assert.Equal(t, domain.ActionSetChange{Name: archived.Name, Kind: domain.ActionSetChangeArchived, ActionId: &archived.ID}, changes[0])
+		assert.Equal(t, domain.ActionSetChangeUpdated, changes[1].Kind)
+		assert.NotEqual(t, changed.ID, *changes[1].ActionId)
+		assert.Equal(t, domain.ActionSetChangeCreated, changes[2].Kind)
+		assert.Equal(t, domain.ActionSetChange{Name: unchanged.Name, Kind: domain.ActionSetChangeUnchanged, ActionId: &unchanged.ID}, changes[3])
+		assert.Equal(t, domain.ActionSetChange{Name: gone.Name, Kind: domain.ActionSetChangeDeactivated, ActionId: &gone.ID}, changes[4])
+	}
+
+	if assert.Len(t, actionService.saved, 2) {
+		assert.Equal(t, "test/changed", actionService.saved[0].Name)
+		assert.False(t, actionService.saved[0].Active, "actions deactivated by hand should stay deactivated")
+		assert.Equal(t, "test/created", actionService.saved[1].Name)
+		assert.True(t, actionService.saved[1].Active)
+	}
+	if assert.Len(t, actionService.updated, 1) {
+		assert.Equal(t, gone.ID, actionService.updated[0].ID)
+		assert.False(t, actionService.updated[0].Active)
+	}
+}
+
+type fakeFactRepository struct {
+	repository.FactRepository
+
+	facts []*domain.Fact
+	after time.Time
+}
+
+func (self *fakeFactRepository) GetByFieldsCreatedAfter(_ [][]string, after time.Time) ([]*domain.Fact, error) {
+	self.after = after
+	facts := []*domain.Fact{}
+	for _, fact := range self.facts {
+		if fact.CreatedAt.After(after) {
+			facts = append(facts, fact)
+		}
+	}
+	return facts, nil
+}
+
+func TestShouldTriggerActionSetByAnyFactSinceSync(t *testing.T) {
+	t.Parallel()
+
+	// given
+	syncedAt := time.Now().Add(-time.Hour)
+	match := `push: branch: "main"`
+	set := &domain.ActionSet{ID: uuid.New(), Match: &match, SyncedAt: &syncedAt}
+
+	matching := &domain.Fact{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().Add(-time.Minute),
+		Value:     map[string]interface{}{"push": map[string]interface{}{"branch": "main"}},
+	}
+	factRepository := &fakeFactRepository{facts: []*domain.Fact{
+		{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			Value:     map[string]interface{}{"push": map[string]interface{}{"branch": "other"}},
+		},
+		matching,
+	}}
+
+	actionSetService := &actionSetService{logger: zerolog.Nop(), factRepository: factRepository}
+
+	// when
+	fact, err := actionSetService.getTriggeringFact(set)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, matching, fact)
+	assert.Equal(t, syncedAt, factRepository.after)
+}
+
+func TestShouldNotTriggerActionSetWithoutMatchingFactSinceSync(t *testing.T) {
+	t.Parallel()
+
+	// given
+	syncedAt := time.Now().Add(-time.Hour)
+	match := `push: branch: "main"`
+	set := &domain.ActionSet{ID: uuid.New(), Match: &match, SyncedAt: &syncedAt}
+
+	factRepository := &fakeFactRepository{facts: []*domain.Fact{
+		{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			Value:     map[string]interface{}{"push": map[string]interface{}{"branch": "other"}},
+		},
+		{
+			ID:        uuid.New(),
+			CreatedAt: syncedAt.Add(-time.Minute),
+			Value:     map[string]interface{}{"push": map[string]interface{}{"branch": "main"}},
+		},
+	}}
+
+	actionSetService := &actionSetService{logger: zerolog.Nop(), factRepository: factRepository}
+
+	// when
+	fact, err := actionSetService.getTriggeringFact(set)
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, fact)
+}
+
+// Calling methods that are not overridden panics.
+type fakeSourceEvaluationService struct {
+	EvaluationService
+
+	resolvedAt time.Time
+}
+
+func (self *fakeSourceEvaluationService) ResolveSource(string) (string, error) {
+	self.resolvedAt = time.Now().UTC()
+	// takes a while like a real fetch
+	time.Sleep(10 * time.Millisecond)
+	return "", errors.New("unreachable")
+}
+
+type fakeActionSetRepository struct {
+	repository.ActionSetRepository
+}
+
+func (self fakeActionSetRepository) WithQuerier(config.PgxIface) repository.ActionSetRepository {
+	return self
+}
+
+func (self fakeActionSetRepository) Update(*domain.ActionSet) error {
+	return nil
+}
+
+type fakeActionSetSyncRepository struct {
+	repository.ActionSetSyncRepository
+}
+
+func (self fakeActionSetSyncRepository) WithQuerier(config.PgxIface) repository.ActionSetSyncRepository {
+	return self
+}
+
+func (self fakeActionSetSyncRepository) Save(*domain.ActionSetSync) error {
+	return nil
+}
+
+func TestShouldRecordSyncTimeBeforeSyncing(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close(context.Background())
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	evaluationService := &fakeSourceEvaluationService{}
+	actionSetService := &actionSetService{
+		logger:                  zerolog.Nop(),
+		evaluationService:       evaluationService,
+		actionSetRepository:     fakeActionSetRepository{},
+		actionSetSyncRepository: fakeActionSetSyncRepository{},
+		db:                      mock,
+	}
+	set := &domain.ActionSet{ID: uuid.New(), Source: "unreachable"}
+
+	// when
+	sync, err := actionSetService.Sync(set, nil)
+
+	// then
+	assert.NoError(t, err)
+	assert.NotNil(t, sync.Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	if assert.NotNil(t, set.SyncedAt) {
+		assert.False(t, set.SyncedAt.After(evaluationService.resolvedAt), "facts created while syncing must be newer than the sync")
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/application"
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func TestShouldDiffActionVersionsWithSameId(t *testing.T) {
+	// given
+	t.Setenv("CICERO_CACHE_DIR", t.TempDir())
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "actions.cue"), []byte(`
+package actions
+
+actions: "test/id": {
+	#id: string
+	meta: id: #id
+}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	evaluationService, err := NewEvaluationService(nil, []string{cueEvaluatorName}, nil, 0, 0, 0, 0, 0, EvaluationSandbox{}, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actionService := NewActionService(nil, nil, nil, evaluationService, &logger)
+
+	from := &domain.Action{ID: uuid.New(), Name: "test/id", Source: src}
+	to := &domain.Action{ID: uuid.New(), Name: "test/id", Source: src}
+
+	// when
+	diff, err := actionService.Diff(from, to)
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, diff.DefinitionError)
+	assert.Empty(t, diff.DefinitionChanges)
+}
+
+func newDeletionActionService(t *testing.T) (ActionService, pgxmock.PgxConnIface) {
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	t.Cleanup(func() { mock.Close(context.Background()) })
+
+	logger := zerolog.Nop()
+	runService := NewRunService(mock, nil, nil, RunJobConfig{}, &logger)
+	return NewActionService(mock, nil, runService, nil, &logger), mock
+}
+
+func expectDeletion(mock pgxmock.PgxConnIface, name string, dependentRuns ...uuid.UUID) {
+	mock.ExpectQuery("SELECT").WithArgs(name).
+		WillReturnRows(mock.NewRows([]string{"actions", "runs", "facts"}).AddRow(2, 3, 1))
+	mock.ExpectQuery("SELECT nomad_job_id FROM run").WithArgs(name).
+		WillReturnRows(mock.NewRows([]string{"nomad_job_id"}))
+
+	rows := mock.NewRows([]string{"run_id"})
+	for _, runId := range dependentRuns {
+		rows.AddRow(runId)
+	}
+	mock.ExpectQuery("SELECT DISTINCT run_id FROM run_inputs").WithArgs(name).WillReturnRows(rows)
+}
+
+func TestShouldNotDeleteActionWithDependentRuns(t *testing.T) {
+	t.Parallel()
+
+	// given
+	actionService, mock := newDeletionActionService(t)
+	dependentRun := uuid.New()
+
+	mock.ExpectBegin()
+	expectDeletion(mock, "test", dependentRun)
+	mock.ExpectRollback()
+
+	// when
+	deletion, err := actionService.DeleteByName("test")
+
+	// then
+	assert.Error(t, err)
+	assert.False(t, deletion.Possible())
+	assert.Equal(t, []uuid.UUID{dependentRun}, deletion.DependentRuns)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldDeleteActionWithoutDependentRuns(t *testing.T) {
+	t.Parallel()
+
+	// given
+	actionService, mock := newDeletionActionService(t)
+
+	mock.ExpectBegin()
+	expectDeletion(mock, "test")
+	for _, sql := range []string{
+		"UPDATE action_set_sync",
+		"DELETE FROM run_inputs",
+		"DELETE FROM run_output",
+		"DELETE FROM run_job",
+		"DELETE FROM fact",
+		"DELETE FROM run",
+		"DELETE FROM action",
+	} {
+		mock.ExpectExec(sql).WithArgs("test").WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	}
+	mock.ExpectCommit()
+
+	// when
+	deletion, err := actionService.DeleteByName("test")
+
+	// then
+	assert.NoError(t, err)
+	assert.True(t, deletion.Possible())
+	assert.Equal(t, 2, deletion.Actions)
+	assert.Equal(t, 3, deletion.Runs)
+	assert.Equal(t, 1, deletion.Facts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectActionVersionWithInvalidMeta(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+
+	logger := zerolog.Nop()
+	actionService := NewActionService(mock, application.NomadClusters{{Name: "ci"}}, nil, nil, &logger)
+
+	invalidRetry := &domain.Action{ID: uuid.New(), Name: "test"}
+	invalidRetry.Meta = map[string]interface{}{"retry": map[string]interface{}{"max_attempts": 0}}
+
+	unknownCluster := &domain.Action{ID: uuid.New(), Name: "test"}
+	unknownCluster.Meta = map[string]interface{}{"nomad": map[string]interface{}{"cluster": "unknown"}}
+
+	// when
+	invalidRetryErr := actionService.SaveVersion(invalidRetry)
+	unknownClusterErr := actionService.SaveVersion(unknownCluster)
+
+	// then
+	assert.Error(t, invalidRetryErr)
+	assert.Error(t, unknownClusterErr)
+	assert.NoError(t, mock.ExpectationsWereMet(), "nothing should be saved")
+}
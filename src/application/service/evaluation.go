@@ -2,17 +2,12 @@ package service
 
 import (
 	"bytes"
-	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/url"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"sync"
+	"time"
 
-	"github.com/adrg/xdg"
 	"github.com/google/uuid"
 	getter "github.com/hashicorp/go-getter/v2"
 	"github.com/hashicorp/nomad/jobspec2"
@@ -21,12 +16,23 @@ import (
 
 	"github.com/input-output-hk/cicero/src/config"
 	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+	"github.com/input-output-hk/cicero/src/infrastructure/persistence"
 )
 
 type EvaluationService interface {
+	// Fetches the latest revision of a source and returns it.
+	ResolveSource(src string) (string, error)
 	ListActions(src string) ([]string, error)
-	EvaluateAction(src, name string, id uuid.UUID) (domain.ActionDefinition, error)
-	EvaluateRun(src, name string, id uuid.UUID, inputs map[string]interface{}) (domain.RunDefinition, error)
+	// Evaluates at the given revision or the latest one if nil.
+	EvaluateAction(src string, revision *string, name string, id uuid.UUID) (domain.ActionDefinition, error)
+	// Evaluates at the given revision or the latest one if nil.
+	// Also returns the evaluator's output and how transformers changed it.
+	EvaluateRun(src string, revision *string, name string, id uuid.UUID, inputs map[string]interface{}) (domain.RunDefinition, domain.RunEvaluation, error)
+	PurgeCache() int
+	ListTransformers() []TransformerInfo
+	// Applies all transformers to a run definition given as JSON.
+	PreviewTransform(def []byte) ([]TransformStep, error)
 }
 
 func parseSource(src string) (fetchUrl *url.URL, evaluator string, err error) {
@@ -43,152 +49,206 @@ func parseSource(src string) (fetchUrl *url.URL, evaluator string, err error) {
 }
 
 type evaluationService struct {
-	Evaluators   []string // Default evaluators. Will be tried in order if none is given for a source.
-	Transformers []string
-	logger       zerolog.Logger
+	Evaluators   []string      // Default evaluators. Will be tried in order if none is given for a source.
+	Transformers []string      // Paths of transformers in the order they are applied.
+	SourceMaxAge time.Duration // Source trees unused for longer are garbage collected.
+
+	EvaluatorWorkers  int           // Max number of workers per evaluator that supports them, 0 to disable.
+	EvaluationTimeout time.Duration // Max duration of fetching a source, an evaluation or transformation, 0 for none.
+	Sandbox           EvaluationSandbox
+
+	transformers     []transformer
+	cache            *evaluationCache
+	actionRepository repository.ActionRepository
+	sourceGetter     *getter.Client
+	logger           zerolog.Logger
+
+	// Guards `sourceLocks` and `lastGarbageCollection`.
+	sourcesMutex sync.Mutex
+	// Locks of source directories so that fetches of different sources do not wait for each other.
+	sourceLocks           map[string]*sync.Mutex
+	lastGarbageCollection time.Time
+
+	evaluatorsMutex sync.Mutex
+	evaluators      map[string]evaluator // by name
 }
 
-func NewEvaluationService(evaluators, transformers []string, logger *zerolog.Logger) EvaluationService {
-	return &evaluationService{
-		Evaluators:   evaluators,
-		Transformers: transformers,
-		logger:       logger.With().Str("component", "EvaluationService").Logger(),
+func NewEvaluationService(db config.PgxIface, evaluators, transformers []string, cacheSize int, cacheTtl, sourceMaxAge time.Duration, workers int, timeout time.Duration, sandbox EvaluationSandbox, logger *zerolog.Logger) (EvaluationService, error) {
+	self := &evaluationService{
+		Evaluators:        evaluators,
+		Transformers:      transformers,
+		SourceMaxAge:      sourceMaxAge,
+		EvaluatorWorkers:  workers,
+		EvaluationTimeout: timeout,
+		Sandbox:           sandbox,
+		cache:             newEvaluationCache(cacheSize, cacheTtl),
+		actionRepository:  persistence.NewActionRepository(db),
+		sourceGetter:      newSourceGetter(timeout),
+		sourceLocks:       map[string]*sync.Mutex{},
+		evaluators:        map[string]evaluator{},
+		logger:            logger.With().Str("component", "EvaluationService").Logger(),
 	}
+
+	var err error
+	self.transformers, err = parseTransformers(transformers, self.logger)
+
+	return self, err
 }
 
 // Evaluation failed due to a faulty action definition or transformer output.
 type EvaluationError struct {
 	err error
+	// Structured problems reported by evaluators speaking protocol version 2.
+	Diagnostics []EvaluationDiagnostic
 }
 
 func (e EvaluationError) Error() string {
-	return e.err.Error()
+	msg := e.err.Error()
+	for _, diag := range e.Diagnostics {
+		msg += "\n" + diag.String()
+	}
+	return msg
 }
 
 func (e EvaluationError) Unwrap() error {
 	return e.err
 }
 
-func (e *evaluationService) evaluate(src string, args, extraEnv []string) ([]byte, error) {
-	fetchUrl, evaluator, err := parseSource(src)
-	if err != nil {
-		return nil, err
-	}
-
-	cacheDir := config.GetenvStr("CICERO_CACHE_DIR")
-	if cacheDir == "" {
-		e.logger.Debug().Err(err).Msg("Falling back to XDG cache directory")
-		cacheDir = xdg.CacheHome + "/cicero"
-	}
-	cacheDir += "/sources"
-
-	dst, err := filepath.Abs(cacheDir + "/" + base64.RawURLEncoding.EncodeToString([]byte(src)))
+// Returns the output and the name of the evaluator that produced it.
+func (e *evaluationService) evaluate(src string, req evaluationRequest) ([]byte, string, error) {
+	_, evaluatorName, err := parseSource(src)
 	if err != nil {
-		return nil, err
-	}
-
-	result, err := getter.GetAny(context.Background(), dst, fetchUrl.String())
-	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	if result.Dst != dst {
-		return nil, errors.WithMessage(err, "go-getter did not download to the given directory. This should never happen™")
-	}
-
-	tryEval := func(evaluator string) ([]byte, error) {
-		cmd := exec.Command("cicero-evaluator-"+evaluator, args...)
-		cmdEnv := append(extraEnv, "CICERO_ACTION_SRC="+dst) //nolint:gocritic // false positive
-		cmd.Env = append(os.Environ(), cmdEnv...)            //nolint:gocritic // false positive
-
-		e.logger.Debug().
-			Strs("command", cmd.Args).
-			Strs("environment", cmdEnv).
-			Msg("Running evaluator")
-
-		if output, err := cmd.Output(); err != nil {
-			message := "Failed to evaluate"
-
-			var errExit *exec.ExitError
-			if errors.As(err, &errExit) {
-				message += fmt.Sprintf("\nStdout: %s\nStderr: %s", output, errExit.Stderr)
-				err = EvaluationError{err: errors.WithMessage(err, message)}
-			}
 
+	tryEval := func(evaluatorName string) ([]byte, error) {
+		if ev, err := e.evaluator(evaluatorName); err != nil {
 			return nil, err
 		} else {
-			return output, err
+			return ev.evaluate(req)
 		}
 	}
 
-	if evaluator != "" {
-		if output, err := tryEval(evaluator); err != nil {
-			return nil, errors.WithMessagef(err, "Evaluator %q specified in source failed", evaluator)
+	if evaluatorName != "" {
+		if output, err := tryEval(evaluatorName); err != nil {
+			return nil, "", errors.WithMessagef(err, "Evaluator %q specified in source failed", evaluatorName)
 		} else {
-			return output, nil
+			return output, evaluatorName, nil
 		}
 	} else {
 		e.logger.Debug().Msg("No evaluator given in source, trying all")
 		var evalErr error
-		for _, evaluator := range e.Evaluators {
-			if output, err := tryEval(evaluator); err != nil {
+		for _, evaluatorName := range e.Evaluators {
+			if output, err := tryEval(evaluatorName); err != nil {
 				format := ""
 				if evalErr != nil {
 					format = "\n" + format
 				}
 				format += "Evaluator %q failed: %w"
-				evalErr = fmt.Errorf(format, evaluator, err)
+				evalErr = fmt.Errorf(format, evaluatorName, err)
 			} else {
-				return output, nil
+				return output, evaluatorName, nil
 			}
 		}
 		e.logger.Err(evalErr).Msg("No evaluator succeeded.")
-		return nil, errors.WithMessage(evalErr, "No evaluator succeeded.")
+		return nil, "", errors.WithMessage(evalErr, "No evaluator succeeded.")
 	}
 }
 
-func (e *evaluationService) EvaluateAction(src, name string, id uuid.UUID) (domain.ActionDefinition, error) {
+func (e *evaluationService) EvaluateAction(src string, revision *string, name string, id uuid.UUID) (domain.ActionDefinition, error) {
 	var def domain.ActionDefinition
 
-	if output, err := e.evaluate(src,
-		[]string{"eval", "meta", "inputs"},
-		[]string{
-			"CICERO_ACTION_NAME=" + name,
-			"CICERO_ACTION_ID=" + id.String(),
-		},
-	); err != nil {
+	dst, resolved, err := e.fetch(src, revision)
+	if err != nil {
+		return def, err
+	}
+
+	cacheKey := evaluationCacheKey{
+		Kind:       "action",
+		Source:     src,
+		Revision:   resolved,
+		Name:       name,
+		ID:         id,
+		Evaluators: e.Evaluators,
+	}.String()
+	if e.getCached(cacheKey, &def) {
+		return def, nil
+	}
+
+	if output, _, err := e.evaluate(src, evaluationRequest{
+		Command: "eval",
+		Source:  dst,
+		Name:    name,
+		ID:      &id,
+		Attrs:   []string{"meta", "inputs"},
+	}); err != nil {
 		return def, err
 	} else if err := json.Unmarshal(output, &def); err != nil {
 		e.logger.Err(err).Str("output", string(output)).Send()
 		return def, errors.WithMessage(err, "While unmarshaling evaluator output")
 	}
 
+	e.putCached(cacheKey, def)
+
 	return def, nil
 }
 
-func (e *evaluationService) EvaluateRun(src, name string, id uuid.UUID, inputs map[string]interface{}) (domain.RunDefinition, error) {
+func (e *evaluationService) EvaluateRun(src string, revision *string, name string, id uuid.UUID, inputs map[string]interface{}) (domain.RunDefinition, domain.RunEvaluation, error) {
 	var def domain.RunDefinition
+	var evaluation domain.RunEvaluation
 
-	inputsJson, err := json.Marshal(inputs)
+	dst, resolved, err := e.fetch(src, revision)
 	if err != nil {
-		return def, errors.WithMessagef(err, "Could not marshal inputs to JSON: %s", inputs)
+		return def, evaluation, err
 	}
 
-	extraEnv := []string{
-		"CICERO_ACTION_NAME=" + name,
-		"CICERO_ACTION_ID=" + id.String(),
-		"CICERO_ACTION_INPUTS=" + string(inputsJson),
+	cacheKey := evaluationCacheKey{
+		Kind:         "run",
+		Source:       src,
+		Revision:     resolved,
+		Name:         name,
+		ID:           id,
+		Evaluators:   e.Evaluators,
+		Transformers: e.Transformers,
+		Inputs:       inputFactIds(inputs),
+	}.String()
+	cached := runEvaluationCacheEntry{}
+	if e.getCached(cacheKey, &cached) {
+		return cached.Definition, cached.Evaluation, nil
 	}
 
-	output, err := e.evaluate(src, []string{"eval", "output", "job"}, extraEnv)
+	inputsJson, err := json.Marshal(inputs)
 	if err != nil {
-		return def, err
+		return def, evaluation, errors.WithMessagef(err, "Could not marshal inputs to JSON: %s", inputs)
 	}
 
-	output, err = e.transform(output, extraEnv)
+	output, evaluatorName, err := e.evaluate(src, evaluationRequest{
+		Command: "eval",
+		Source:  dst,
+		Name:    name,
+		ID:      &id,
+		Inputs:  inputsJson,
+		Attrs:   []string{"output", "job"},
+	})
 	if err != nil {
-		return def, err
+		return def, evaluation, err
 	}
 
+	evaluation.Evaluator = evaluatorName
+	evaluation.SourceRevision = resolved
+	evaluation.Evaluated = output
+
+	output, err = e.transform(output, transformContext{
+		name:   name,
+		id:     id,
+		inputs: inputsJson,
+	}, nil)
+	if err != nil {
+		return def, evaluation, err
+	}
+
+	evaluation.Transformed = output
+
 	freeformDef := struct {
 		domain.RunDefinition
 		Job *interface{} `json:"job"`
@@ -196,13 +256,13 @@ func (e *evaluationService) EvaluateRun(src, name string, id uuid.UUID, inputs m
 
 	err = json.Unmarshal(output, &freeformDef)
 	if err != nil {
-		return def, errors.WithMessagef(err, "While unmarshaling evaluator output %s into freeform definition", string(output))
+		return def, evaluation, errors.WithMessagef(err, "While unmarshaling evaluator output %s into freeform definition", string(output))
 	}
 
 	def.Output = freeformDef.Output
 	if freeformDef.Job != nil {
 		if job, err := json.Marshal(*freeformDef.Job); err != nil {
-			return def, err
+			return def, evaluation, err
 		} else {
 			// escape HCL variable interpolation
 			job = bytes.ReplaceAll(job, []byte("${"), []byte("$${"))
@@ -212,58 +272,121 @@ func (e *evaluationService) EvaluateRun(src, name string, id uuid.UUID, inputs m
 				AllowFS: false,
 				Strict:  true,
 			}); err != nil {
-				return def, err
+				return def, evaluation, err
 			} else {
 				def.Job = job
 			}
 		}
 	}
 
-	return def, nil
+	e.putCached(cacheKey, runEvaluationCacheEntry{def, evaluation})
+
+	return def, evaluation, nil
+}
+
+type runEvaluationCacheEntry struct {
+	Definition domain.RunDefinition
+	Evaluation domain.RunEvaluation
+}
+
+func (e *evaluationService) getCached(key string, def interface{}) bool {
+	if cached, found := e.cache.get(key); !found {
+		return false
+	} else if err := json.Unmarshal(cached, def); err != nil {
+		e.logger.Err(err).Str("key", key).Msg("Could not unmarshal cached evaluation result")
+		return false
+	}
+	e.logger.Debug().Str("key", key).Msg("Evaluation cache hit")
+	return true
+}
+
+func (e *evaluationService) putCached(key string, def interface{}) {
+	if data, err := json.Marshal(def); err != nil {
+		e.logger.Err(err).Str("key", key).Msg("Could not marshal evaluation result for cache")
+	} else {
+		e.cache.put(key, data)
+	}
 }
 
-func (e *evaluationService) transform(output []byte, extraEnv []string) ([]byte, error) {
-	for _, transformer := range e.Transformers {
-		cmd := exec.Command(transformer)
-		cmd.Env = append(os.Environ(), extraEnv...) //nolint:gocritic // false positive
+func (e *evaluationService) PurgeCache() int {
+	n := e.cache.purge()
+	e.logger.Info().Int("entries", n).Msg("Purged evaluation cache")
+	return n
+}
 
-		stdin, err := cmd.StdinPipe()
+// Applies all transformers in order.
+// Calls `step` after each if not nil.
+func (e *evaluationService) transform(output []byte, ctx transformContext, step func(transformer, []byte, []byte)) ([]byte, error) {
+	processes, err := e.processes()
+	if err != nil {
+		return nil, err
+	}
+	processes.Env = append(append([]string{}, processes.Env...), processes.TransformerEnv...)
+
+	for _, t := range e.transformers {
+		transformed, err := t.transform(processes, output, ctx)
 		if err != nil {
-			return nil, err
+			return nil, errors.WithMessagef(err, "Transformer %q failed", t.info().Path)
 		}
-		if _, err := io.Copy(stdin, bytes.NewReader(output)); err != nil {
-			return nil, err
+		if step != nil {
+			step(t, output, transformed)
 		}
-		if err := stdin.Close(); err != nil {
-			return nil, err
-		}
-
-		e.logger.Debug().
-			Strs("command", cmd.Args).
-			Strs("environment", extraEnv).
-			Str("transformer", transformer).
-			Msg("Running transformer")
+		output = transformed
+	}
 
-		if transformedOutput, err := cmd.Output(); err != nil {
-			message := "Failed to transform"
+	return output, nil
+}
 
-			var errExit *exec.ExitError
-			if errors.As(err, &errExit) {
-				message += fmt.Sprintf("\nStdout: %s\nStderr: %s", transformedOutput, errExit.Stderr)
-				err = EvaluationError{err: errors.WithMessage(err, message)}
-			}
+func (e *evaluationService) ListTransformers() []TransformerInfo {
+	infos := make([]TransformerInfo, len(e.transformers))
+	for i, t := range e.transformers {
+		infos[i] = t.info()
+	}
+	return infos
+}
 
-			return nil, err
-		} else {
-			output = transformedOutput
+func (e *evaluationService) PreviewTransform(def []byte) ([]TransformStep, error) {
+	steps := []TransformStep{}
+	var stepErr error
+	_, err := e.transform(def, transformContext{inputs: []byte("{}")}, func(t transformer, before, after []byte) {
+		var beforeValue, afterValue interface{}
+		if err := json.Unmarshal(before, &beforeValue); err != nil {
+			stepErr = errors.WithMessage(err, "Could not unmarshal input of transformer")
+		} else if err := json.Unmarshal(after, &afterValue); err != nil {
+			stepErr = errors.WithMessagef(err, "Could not unmarshal output of transformer %q", t.info().Path)
 		}
+		steps = append(steps, TransformStep{
+			Transformer: t.info(),
+			Before:      before,
+			After:       after,
+			Changes:     domain.DiffJson(beforeValue, afterValue),
+		})
+	})
+	if err == nil {
+		err = stepErr
 	}
+	return steps, err
+}
 
-	return output, nil
+func (e *evaluationService) processes() (evaluationProcesses, error) {
+	sourcesDir, err := e.sourcesDir()
+	return evaluationProcesses{
+		EvaluationSandbox: e.Sandbox,
+		timeout:           e.EvaluationTimeout,
+		sourcesDir:        sourcesDir,
+	}, err
 }
 
 func (e *evaluationService) ListActions(src string) ([]string, error) {
-	output, err := e.evaluate(src, []string{"list"}, nil)
+	dst, _, err := e.fetch(src, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	output, _, err := e.evaluate(src, evaluationRequest{
+		Command: "list",
+		Source:  dst,
+	})
 	if err != nil {
 		return nil, err
 	}
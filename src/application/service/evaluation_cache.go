@@ -0,0 +1,143 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+// Least recently used cache of evaluation results
+// whose entries expire after a fixed duration.
+// A size of zero disables caching, a TTL of zero disables expiry.
+type evaluationCache struct {
+	size int
+	ttl  time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type evaluationCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newEvaluationCache(size int, ttl time.Duration) *evaluationCache {
+	return &evaluationCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (c *evaluationCache) get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	entry := elem.Value.(*evaluationCacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *evaluationCache) put(key string, value []byte) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &evaluationCacheEntry{
+		key:     key,
+		value:   value,
+		expires: time.Now().Add(c.ttl),
+	}
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Removes all entries and returns how many there were.
+func (c *evaluationCache) purge() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	n := c.lru.Len()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	return n
+}
+
+func (c *evaluationCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*evaluationCacheEntry).key)
+}
+
+type evaluationCacheKey struct {
+	Kind         string              `json:"kind"`
+	Source       string              `json:"source"`
+	Revision     string              `json:"revision"`
+	Name         string              `json:"name"`
+	ID           uuid.UUID           `json:"id"`
+	Evaluators   []string            `json:"evaluators"`
+	Transformers []string            `json:"transformers,omitempty"`
+	Inputs       map[string][]string `json:"inputs,omitempty"`
+}
+
+func (k evaluationCacheKey) String() string {
+	// Marshaling a struct and maps with sorted keys is deterministic.
+	data, err := json.Marshal(k)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Reduces the inputs given to an evaluation to the IDs of their facts.
+// The fact values are fully determined by their IDs and the action's
+// input definitions, and those are determined by the action ID.
+func inputFactIds(inputs map[string]interface{}) map[string][]string {
+	ids := make(map[string][]string, len(inputs))
+	for name, factOrFacts := range inputs {
+		switch typed := factOrFacts.(type) {
+		case *domain.Fact:
+			ids[name] = []string{typed.ID.String()}
+		case []*domain.Fact:
+			ids[name] = make([]string, len(typed))
+			for i, fact := range typed {
+				ids[name][i] = fact.ID.String()
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func TestShouldEvictLeastRecentlyUsedEvaluation(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache := newEvaluationCache(2, 0)
+	cache.put("a", []byte("a"))
+	cache.put("b", []byte("b"))
+
+	// when
+	_, _ = cache.get("a")
+	cache.put("c", []byte("c"))
+
+	// then
+	_, foundA := cache.get("a")
+	_, foundB := cache.get("b")
+	_, foundC := cache.get("c")
+	assert.True(t, foundA)
+	assert.False(t, foundB)
+	assert.True(t, foundC)
+}
+
+func TestShouldExpireEvaluation(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache := newEvaluationCache(1, time.Nanosecond)
+	cache.put("a", []byte("a"))
+
+	// when
+	time.Sleep(time.Millisecond)
+
+	// then
+	_, found := cache.get("a")
+	assert.False(t, found)
+}
+
+func TestShouldPurgeEvaluations(t *testing.T) {
+	t.Parallel()
+
+	// given
+	cache := newEvaluationCache(2, 0)
+	cache.put("a", []byte("a"))
+	cache.put("b", []byte("b"))
+
+	// when
+	purged := cache.purge()
+
+	// then
+	assert.Equal(t, 2, purged)
+	_, found := cache.get("a")
+	assert.False(t, found)
+}
+
+func TestShouldKeyEvaluationByInputFactIds(t *testing.T) {
+	t.Parallel()
+
+	// given
+	id := uuid.New()
+	factA := domain.Fact{ID: uuid.New(), Value: "a"}
+	factB := domain.Fact{ID: uuid.New(), Value: "a"}
+	keyFor := func(fact *domain.Fact) string {
+		return evaluationCacheKey{
+			Kind:   "run",
+			Source: "source",
+			Name:   "name",
+			ID:     id,
+			Inputs: inputFactIds(map[string]interface{}{"input": fact}),
+		}.String()
+	}
+
+	// then
+	assert.Equal(t, keyFor(&factA), keyFor(&factA))
+	assert.NotEqual(t, keyFor(&factA), keyFor(&factB))
+}
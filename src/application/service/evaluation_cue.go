@@ -0,0 +1,223 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/build"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Name of the built-in evaluator for actions written in CUE.
+const cueEvaluatorName = "cue"
+
+// Evaluates actions written in CUE in-process.
+//
+// The CUE files at the root of the source must have a field `actions`
+// with one field per action. Actions are evaluated with the definitions
+// `#name`, `#id` and `#inputs` filled in, the latter with the facts
+// that satisfy the action's inputs, and must produce
+// the same `meta`, `inputs`, `output` and `job` as with any other evaluator.
+//
+//	actions: "example/hello": {
+//		#inputs: _
+//		inputs: start: match: "hello: string"
+//		output: success: greeted: #inputs.start.value.hello
+//	}
+//
+// Only imports from the CUE standard library are supported.
+// CUE cannot do I/O outside of tool files so no sandbox is needed.
+// A timed out evaluation is abandoned as it cannot be interrupted
+// but keeps its slot until it finishes, so that stuck evaluations
+// cannot pile up: once all slots are taken new evaluations are refused.
+type cueEvaluator struct {
+	timeout time.Duration // 0 for none
+	slots   chan struct{} // one per evaluation that may run at the same time
+	logger  zerolog.Logger
+}
+
+func newCueEvaluator(timeout time.Duration, logger zerolog.Logger) cueEvaluator {
+	return cueEvaluator{
+		timeout: timeout,
+		slots:   make(chan struct{}, runtime.NumCPU()),
+		logger:  logger,
+	}
+}
+
+func (self cueEvaluator) evaluate(req evaluationRequest) ([]byte, error) {
+	var timeout <-chan time.Time
+	if self.timeout > 0 {
+		timer := time.NewTimer(self.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case self.slots <- struct{}{}:
+	case <-timeout:
+		return nil, errors.Errorf("No CUE evaluation finished within %s to make room for this one, maybe some are stuck", self.timeout)
+	}
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() { <-self.slots }()
+
+		output, err := self.evaluateNow(req)
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-timeout:
+		self.logger.Warn().
+			Str("source", req.Source).
+			Str("name", req.Name).
+			Msg("Abandoning CUE evaluation that keeps running in the background")
+		return nil, EvaluationError{err: errors.Errorf("Did not finish within %s", self.timeout)}
+	}
+}
+
+func (self cueEvaluator) evaluateNow(req evaluationRequest) ([]byte, error) {
+	self.logger.Debug().
+		Str("command", req.Command).
+		Str("source", req.Source).
+		Str("name", req.Name).
+		Strs("attrs", req.Attrs).
+		Msg("Evaluating CUE")
+
+	dir := req.Source
+	actions, err := self.load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Command {
+	case "list":
+		names := []string{}
+		if iter, err := actions.Fields(); err != nil {
+			return nil, cueEvaluationError(dir, err)
+		} else {
+			for iter.Next() {
+				names = append(names, iter.Label())
+			}
+		}
+		sort.Strings(names)
+		return json.Marshal(names)
+	case "eval":
+		action := actions.LookupPath(cue.MakePath(cue.Str(req.Name)))
+		if !action.Exists() {
+			return nil, EvaluationError{err: errors.Errorf("No action named %q", req.Name)}
+		}
+
+		action = action.FillPath(cue.MakePath(cue.Def("#name")), req.Name)
+		if req.ID != nil {
+			action = action.FillPath(cue.MakePath(cue.Def("#id")), req.ID.String())
+		}
+		if req.Inputs != nil {
+			inputs := action.Context().CompileBytes(req.Inputs)
+			if inputs.Err() != nil {
+				return nil, errors.WithMessage(inputs.Err(), "Could not compile inputs")
+			}
+			action = action.FillPath(cue.MakePath(cue.Def("#inputs")), inputs)
+		}
+
+		result := map[string]json.RawMessage{}
+		for _, attr := range req.Attrs {
+			value := action.LookupPath(cue.MakePath(cue.Str(attr)))
+			if !value.Exists() {
+				continue
+			}
+			if err := value.Validate(cue.Concrete(true)); err != nil {
+				return nil, cueEvaluationError(dir, err)
+			}
+			if attrJson, err := value.MarshalJSON(); err != nil {
+				return nil, cueEvaluationError(dir, err)
+			} else {
+				result[attr] = attrJson
+			}
+		}
+		return json.Marshal(result)
+	default:
+		return nil, fmt.Errorf("Unknown command %q", req.Command)
+	}
+}
+
+// Returns the `actions` of the CUE files in the given directory.
+func (self cueEvaluator) load(dir string) (cue.Value, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.cue"))
+	if err != nil {
+		return cue.Value{}, err
+	}
+	if len(files) == 0 {
+		return cue.Value{}, EvaluationError{err: errors.Errorf("No CUE files in source")}
+	}
+
+	instance := build.NewContext().NewInstance(dir, nil)
+	for _, file := range files {
+		if err := instance.AddFile(file, nil); err != nil {
+			return cue.Value{}, cueEvaluationError(dir, err)
+		}
+	}
+	if err := instance.Err; err != nil {
+		return cue.Value{}, cueEvaluationError(dir, err)
+	}
+
+	value := cuecontext.New().BuildInstance(instance)
+	if err := value.Err(); err != nil {
+		return value, cueEvaluationError(dir, err)
+	}
+
+	actions := value.LookupPath(cue.ParsePath("actions"))
+	if !actions.Exists() {
+		return actions, EvaluationError{err: errors.New("CUE package has no field `actions`")}
+	}
+
+	return actions, nil
+}
+
+// Wraps CUE errors in an `EvaluationError` with diagnostics
+// whose file names are relative to the given directory.
+func cueEvaluationError(dir string, err error) EvaluationError {
+	var diags []EvaluationDiagnostic
+	for _, cueErr := range cueerrors.Errors(err) {
+		format, args := cueErr.Msg()
+		diag := EvaluationDiagnostic{
+			Severity: EvaluationDiagnosticError,
+			Message:  fmt.Sprintf(format, args...),
+		}
+		if path := cueErr.Path(); len(path) > 0 {
+			diag.Message = cue.MakePath(stringSelectors(path)...).String() + ": " + diag.Message
+		}
+		if pos := cueErr.Position(); pos.IsValid() {
+			diag.File = pos.Filename()
+			if rel, err := filepath.Rel(dir, diag.File); err == nil {
+				diag.File = rel
+			}
+			diag.Line = pos.Line()
+			diag.Column = pos.Column()
+		}
+		diags = append(diags, diag)
+	}
+	return EvaluationError{err: errors.New("Failed to evaluate CUE"), Diagnostics: diags}
+}
+
+func stringSelectors(path []string) []cue.Selector {
+	selectors := make([]cue.Selector, len(path))
+	for i, label := range path {
+		selectors[i] = cue.Str(label)
+	}
+	return selectors
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+const testCueActions = `
+package actions
+
+actions: {
+	"test/job": {
+		#name:   string
+		#id:     string
+		#inputs: _
+
+		meta: name: #name
+		inputs: start: {
+			select: "latest"
+			match:  "start: string"
+		}
+		output: success: started: #inputs.start.value.start
+		job: (#id): group: test: task: test: {
+			driver: "exec"
+			config: command: "true"
+		}
+	}
+
+	"test/decision": {
+		inputs: all: {
+			select: "all"
+			match:  "all: true"
+		}
+		output: success: decided: true
+	}
+
+	"test/incomplete": {
+		#inputs: _
+		output: success: foo: #inputs.start.value.foo & string
+	}
+}
+`
+
+// Evaluates through the `EvaluationService` interface
+// so results are held to the same standard as those of other evaluators.
+func newCueEvaluationService(t *testing.T) (EvaluationService, string) {
+	t.Setenv("CICERO_CACHE_DIR", t.TempDir())
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "actions.cue"), []byte(testCueActions), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.Nop()
+	evaluationService, err := NewEvaluationService(nil, []string{cueEvaluatorName}, nil, 0, 0, 0, 0, 0, EvaluationSandbox{}, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return evaluationService, src
+}
+
+func TestShouldListCueActions(t *testing.T) {
+	// given
+	evaluationService, src := newCueEvaluationService(t)
+
+	// when
+	names, err := evaluationService.ListActions(src)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test/decision", "test/incomplete", "test/job"}, names)
+}
+
+func TestShouldEvaluateCueAction(t *testing.T) {
+	// given
+	evaluationService, src := newCueEvaluationService(t)
+
+	// when
+	def, err := evaluationService.EvaluateAction(src, nil, "test/job", uuid.New())
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "test/job"}, def.Meta)
+	assert.Equal(t, domain.InputDefinitionSelectLatest, def.Inputs["start"].Select)
+	assert.Equal(t, domain.InputDefinitionMatch("start: string"), def.Inputs["start"].Match)
+}
+
+func TestShouldEvaluateCueRun(t *testing.T) {
+	// given
+	evaluationService, src := newCueEvaluationService(t)
+	id := uuid.New()
+	inputs := map[string]interface{}{
+		"start": &domain.Fact{ID: uuid.New(), Value: map[string]interface{}{"start": "now"}},
+	}
+
+	// when
+	def, evaluation, err := evaluationService.EvaluateRun(src, nil, "test/job", id, inputs)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"started": "now"}, *def.Output.Success)
+	assert.False(t, def.IsDecision())
+	assert.Equal(t, id.String(), *def.Job.Name)
+	assert.Len(t, def.Job.TaskGroups, 1)
+	assert.Equal(t, cueEvaluatorName, evaluation.Evaluator)
+	assert.JSONEq(t, string(evaluation.Evaluated), string(evaluation.Transformed))
+}
+
+func TestShouldEvaluateCueDecision(t *testing.T) {
+	// given
+	evaluationService, src := newCueEvaluationService(t)
+	inputs := map[string]interface{}{
+		"all": []*domain.Fact{{ID: uuid.New(), Value: map[string]interface{}{"all": true}}},
+	}
+
+	// when
+	def, _, err := evaluationService.EvaluateRun(src, nil, "test/decision", uuid.New(), inputs)
+
+	// then
+	assert.NoError(t, err)
+	assert.True(t, def.IsDecision())
+	assert.Equal(t, map[string]interface{}{"decided": true}, *def.Output.Success)
+}
+
+func TestShouldReportCueDiagnostics(t *testing.T) {
+	// given
+	evaluationService, src := newCueEvaluationService(t)
+	inputs := map[string]interface{}{
+		"start": &domain.Fact{ID: uuid.New(), Value: map[string]interface{}{}},
+	}
+
+	// when
+	_, _, err := evaluationService.EvaluateRun(src, nil, "test/incomplete", uuid.New(), inputs)
+
+	// then
+	var evalErr EvaluationError
+	if assert.True(t, errors.As(err, &evalErr)) && assert.NotEmpty(t, evalErr.Diagnostics) {
+		assert.Equal(t, "actions.cue", evalErr.Diagnostics[0].File)
+		assert.Positive(t, evalErr.Diagnostics[0].Line)
+	}
+}
+
+func TestShouldRefuseCueEvaluationWhileOthersAreStuck(t *testing.T) {
+	// given
+	_, src := newCueEvaluationService(t)
+	evaluator := newCueEvaluator(10*time.Millisecond, zerolog.Nop())
+	for i := 0; i < cap(evaluator.slots); i++ {
+		evaluator.slots <- struct{}{}
+	}
+
+	// when
+	_, err := evaluator.evaluate(evaluationRequest{Command: "list", Source: src})
+
+	// then
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "make room")
+	}
+
+	// when
+	<-evaluator.slots
+	output, err := evaluator.evaluate(evaluationRequest{Command: "list", Source: src})
+
+	// then
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["test/decision","test/incomplete","test/job"]`, string(output))
+}
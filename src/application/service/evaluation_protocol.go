@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Evaluators speak one of two protocol versions.
+//
+// Version 1 passes everything in CLI arguments and environment variables:
+// `cicero-evaluator-<name> list` and `cicero-evaluator-<name> eval <attrs...>`.
+//
+// Version 2 sends a single-line JSON `evaluationRequest` on stdin
+// to `cicero-evaluator-<name> v2` and expects a single-line JSON
+// `evaluationResponse` on stdout.
+//
+// Evaluators advertise the versions they support in response to
+// `cicero-evaluator-<name> capabilities`. Evaluators that do not
+// understand that command are assumed to speak version 1.
+type evaluatorCapabilities struct {
+	Protocols []int `json:"protocols"`
+	Worker    bool  `json:"worker"`
+}
+
+func (c evaluatorCapabilities) supports(protocol int) bool {
+	for _, p := range c.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+type evaluationRequest struct {
+	Protocol int    `json:"protocol"`
+	Command  string `json:"command"` // one of "list", "eval" or "ping"
+	Source   string `json:"source"`  // path to the fetched source tree
+
+	// The following are only set for "eval".
+	Name   string          `json:"name,omitempty"`
+	ID     *uuid.UUID      `json:"id,omitempty"`
+	Inputs json.RawMessage `json:"inputs,omitempty"`
+	Attrs  []string        `json:"attrs,omitempty"`
+}
+
+type evaluationResponse struct {
+	Protocol    int                    `json:"protocol"`
+	Result      json.RawMessage        `json:"result"`
+	Diagnostics []EvaluationDiagnostic `json:"diagnostics"`
+}
+
+type EvaluationDiagnosticSeverity string
+
+const (
+	EvaluationDiagnosticError   EvaluationDiagnosticSeverity = "error"
+	EvaluationDiagnosticWarning EvaluationDiagnosticSeverity = "warning"
+)
+
+// A problem reported by an evaluator, optionally pointing into the action source.
+type EvaluationDiagnostic struct {
+	Severity EvaluationDiagnosticSeverity `json:"severity"`
+	File     string                       `json:"file,omitempty"`
+	Line     int                          `json:"line,omitempty"`
+	Column   int                          `json:"column,omitempty"`
+	Message  string                       `json:"message"`
+}
+
+func (d EvaluationDiagnostic) String() string {
+	var b strings.Builder
+	if d.File != "" {
+		b.WriteString(d.File)
+		if d.Line > 0 {
+			fmt.Fprintf(&b, ":%d", d.Line)
+			if d.Column > 0 {
+				fmt.Fprintf(&b, ":%d", d.Column)
+			}
+		}
+		b.WriteString(": ")
+	}
+	if d.Severity != "" {
+		b.WriteString(string(d.Severity))
+		b.WriteString(": ")
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+type evaluator interface {
+	// Returns the evaluation result as JSON.
+	evaluate(evaluationRequest) ([]byte, error)
+}
+
+// Runs an evaluator speaking protocol version 1.
+type processEvaluatorV1 struct {
+	command   string
+	processes evaluationProcesses
+	logger    zerolog.Logger
+}
+
+func (self processEvaluatorV1) evaluate(req evaluationRequest) ([]byte, error) {
+	args := []string{req.Command}
+	args = append(args, req.Attrs...)
+
+	cmdEnv := []string{"CICERO_ACTION_SRC=" + req.Source}
+	if req.Command == "eval" {
+		cmdEnv = append(cmdEnv, "CICERO_ACTION_NAME="+req.Name)
+		if req.ID != nil {
+			cmdEnv = append(cmdEnv, "CICERO_ACTION_ID="+req.ID.String())
+		}
+		if req.Inputs != nil {
+			cmdEnv = append(cmdEnv, "CICERO_ACTION_INPUTS="+string(req.Inputs))
+		}
+	}
+
+	cmd := self.processes.command(cmdEnv, []string{req.Source}, self.command, args...)
+
+	self.logger.Debug().
+		Strs("command", cmd.Args).
+		Strs("environment", cmdEnv).
+		Msg("Running evaluator")
+
+	if output, err := self.processes.output(cmd); err != nil {
+		message := "Failed to evaluate"
+
+		var errExit *exec.ExitError
+		if errors.As(err, &errExit) {
+			message += fmt.Sprintf("\nStdout: %s\nStderr: %s", output, errExit.Stderr)
+			err = EvaluationError{err: errors.WithMessage(err, message)}
+		}
+
+		return nil, err
+	} else {
+		return output, nil
+	}
+}
+
+// Runs an evaluator speaking protocol version 2.
+type processEvaluatorV2 struct {
+	command   string
+	processes evaluationProcesses
+	logger    zerolog.Logger
+}
+
+func (self processEvaluatorV2) evaluate(req evaluationRequest) ([]byte, error) {
+	req.Protocol = 2
+
+	reqJson, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not marshal evaluation request")
+	}
+
+	cmd := self.processes.command(nil, []string{req.Source}, self.command, "v2")
+	cmd.Stdin = bytes.NewReader(append(reqJson, '\n'))
+
+	self.logger.Debug().
+		Strs("command", cmd.Args).
+		RawJSON("request", reqJson).
+		Msg("Running evaluator")
+
+	output, cmdErr := self.processes.output(cmd)
+
+	var stderr []byte
+	var errExit *exec.ExitError
+	if errors.As(cmdErr, &errExit) {
+		stderr = errExit.Stderr
+	} else if cmdErr != nil {
+		return nil, cmdErr
+	}
+
+	return decodeEvaluationResponse(output, stderr, cmdErr, self.logger)
+}
+
+// Interprets the output of an evaluator speaking protocol version 2.
+// Errors reported in diagnostics or by a failed process become `EvaluationError`s.
+func decodeEvaluationResponse(output, stderr []byte, cmdErr error, logger zerolog.Logger) ([]byte, error) {
+	var res evaluationResponse
+	if err := json.Unmarshal(output, &res); err != nil {
+		message := "Failed to decode evaluator response"
+		if cmdErr != nil {
+			err = cmdErr
+			message = "Failed to evaluate"
+		}
+		message += fmt.Sprintf("\nStdout: %s\nStderr: %s", output, stderr)
+		return nil, EvaluationError{err: errors.WithMessage(err, message)}
+	}
+
+	var errDiags []EvaluationDiagnostic
+	for _, diag := range res.Diagnostics {
+		if diag.Severity == EvaluationDiagnosticWarning {
+			logger.Warn().Str("diagnostic", diag.String()).Msg("Evaluator warning")
+		} else {
+			errDiags = append(errDiags, diag)
+		}
+	}
+
+	if len(errDiags) > 0 || cmdErr != nil || res.Result == nil {
+		err := cmdErr
+		if err == nil {
+			err = errors.New("Failed to evaluate")
+		}
+		if len(stderr) > 0 {
+			err = errors.WithMessagef(err, "Stderr: %s", stderr)
+		}
+		return nil, EvaluationError{err: err, Diagnostics: errDiags}
+	}
+
+	return res.Result, nil
+}
+
+// Asks an evaluator which protocol versions it speaks.
+func queryEvaluatorCapabilities(processes evaluationProcesses, command string) (evaluatorCapabilities, error) {
+	caps := evaluatorCapabilities{Protocols: []int{1}}
+
+	if _, err := exec.LookPath(command); err != nil {
+		return caps, err
+	}
+
+	output, err := processes.output(processes.command(nil, nil, command, "capabilities"))
+	if err != nil {
+		var errExit *exec.ExitError
+		if errors.As(err, &errExit) {
+			// Evaluators speaking only version 1 exit with an unknown command.
+			return caps, nil
+		}
+		return caps, err
+	}
+
+	if err := json.Unmarshal(output, &caps); err != nil {
+		return evaluatorCapabilities{Protocols: []int{1}}, nil
+	}
+
+	return caps, nil
+}
+
+// Returns the evaluator of the given name, speaking the latest protocol version it supports.
+func (e *evaluationService) evaluator(name string) (evaluator, error) {
+	e.evaluatorsMutex.Lock()
+	defer e.evaluatorsMutex.Unlock()
+
+	if ev, exists := e.evaluators[name]; exists {
+		return ev, nil
+	}
+
+	if name == cueEvaluatorName {
+		ev := newCueEvaluator(e.EvaluationTimeout, e.logger.With().Str("evaluator", name).Logger())
+		e.evaluators[name] = ev
+		return ev, nil
+	}
+
+	command := "cicero-evaluator-" + name
+	logger := e.logger.With().Str("evaluator", name).Logger()
+
+	processes, err := e.processes()
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := queryEvaluatorCapabilities(processes, command)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Could not query capabilities of evaluator %q", name)
+	}
+
+	var ev evaluator
+	switch {
+	case caps.supports(2) && caps.Worker && e.EvaluatorWorkers > 0:
+		ev = newEvaluatorPool(command, processes, e.EvaluatorWorkers, logger)
+	case caps.supports(2):
+		ev = processEvaluatorV2{command: command, processes: processes, logger: logger}
+	default:
+		ev = processEvaluatorV1{command: command, processes: processes, logger: logger}
+	}
+
+	logger.Debug().
+		Ints("protocols", caps.Protocols).
+		Bool("worker", caps.Worker).
+		Msg("Detected evaluator capabilities")
+
+	e.evaluators[name] = ev
+
+	return ev, nil
+}
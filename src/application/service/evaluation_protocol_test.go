@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeEvaluator(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "cicero-evaluator-test")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestShouldFallBackToEvaluatorProtocolV1(t *testing.T) {
+	t.Parallel()
+
+	// given
+	command := writeEvaluator(t, `echo "Unknown command: $1" >&2; exit 1`)
+
+	// when
+	caps, err := queryEvaluatorCapabilities(evaluationProcesses{}, command)
+
+	// then
+	assert.NoError(t, err)
+	assert.True(t, caps.supports(1))
+	assert.False(t, caps.supports(2))
+}
+
+func TestShouldDetectEvaluatorProtocolV2(t *testing.T) {
+	t.Parallel()
+
+	// given
+	command := writeEvaluator(t, `echo '{"protocols":[1,2]}'`)
+
+	// when
+	caps, err := queryEvaluatorCapabilities(evaluationProcesses{}, command)
+
+	// then
+	assert.NoError(t, err)
+	assert.True(t, caps.supports(2))
+}
+
+func TestShouldPassRequestOnStdinWithProtocolV2(t *testing.T) {
+	t.Parallel()
+
+	// given
+	command := writeEvaluator(t, `read -r req; printf '{"protocol":2,"result":%s}\n' "$req"`)
+	ev := processEvaluatorV2{command: command, logger: zerolog.Nop()}
+	id := uuid.New()
+
+	// when
+	output, err := ev.evaluate(evaluationRequest{
+		Command: "eval",
+		Source:  "/src",
+		Name:    "test",
+		ID:      &id,
+		Inputs:  []byte(`{"foo":{"value":1}}`),
+		Attrs:   []string{"output", "job"},
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"protocol": 2,
+		"command": "eval",
+		"source": "/src",
+		"name": "test",
+		"id": "`+id.String()+`",
+		"inputs": {"foo": {"value": 1}},
+		"attrs": ["output", "job"]
+	}`, string(output))
+}
+
+func TestShouldReturnEvaluationDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	// given
+	output := []byte(`{"protocol":2,"diagnostics":[
+		{"severity":"warning","message":"deprecated"},
+		{"severity":"error","file":"action.nix","line":3,"column":7,"message":"undefined variable"}
+	]}`)
+
+	// when
+	_, err := decodeEvaluationResponse(output, nil, nil, zerolog.Nop())
+
+	// then
+	var evalErr EvaluationError
+	assert.True(t, errors.As(err, &evalErr))
+	assert.Equal(t, []EvaluationDiagnostic{{
+		Severity: EvaluationDiagnosticError,
+		File:     "action.nix",
+		Line:     3,
+		Column:   7,
+		Message:  "undefined variable",
+	}}, evalErr.Diagnostics)
+	assert.Contains(t, err.Error(), "action.nix:3:7: error: undefined variable")
+}
+
+func TestShouldWrapUndecodableEvaluatorOutput(t *testing.T) {
+	t.Parallel()
+
+	// given
+	output := []byte("not json")
+
+	// when
+	_, err := decodeEvaluationResponse(output, []byte("crashed"), nil, zerolog.Nop())
+
+	// then
+	var evalErr EvaluationError
+	assert.True(t, errors.As(err, &evalErr))
+	assert.Contains(t, err.Error(), "crashed")
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Restrictions for the processes of evaluators and transformers.
+type EvaluationSandbox struct {
+	// Names of environment variables that are passed through.
+	// Names ending in `*` match all variables with that prefix.
+	Env []string
+	// Like `Env` but only for transformers.
+	TransformerEnv []string
+
+	// Whether to run in a bubblewrap sandbox that can only read
+	// the Nix store, system directories and the fetched sources.
+	Bubblewrap bool
+	// Whether to allow network access in the bubblewrap sandbox.
+	Network bool
+
+	// Max bytes of virtual memory per process, 0 for no limit.
+	MemoryLimit uint64
+}
+
+// Spawns processes restricted by an `EvaluationSandbox`.
+type evaluationProcesses struct {
+	EvaluationSandbox
+	timeout    time.Duration // 0 for none
+	sourcesDir string        // made available read-only in the sandbox
+}
+
+// Returns the environment variables from `os.Environ()` that are allowed to pass through.
+func (self evaluationProcesses) environ() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name := kv[:strings.IndexByte(kv, '=')]
+		for _, allowed := range self.Env {
+			if allowed == name || (strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, strings.TrimSuffix(allowed, "*"))) {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// Returns a command that runs in the sandbox with the given extra environment variables.
+// Paths are made available read-only in addition to the sources directory.
+func (self evaluationProcesses) command(extraEnv []string, paths []string, name string, args ...string) *exec.Cmd {
+	env := append(self.environ(), extraEnv...)
+
+	argv := append([]string{name}, args...)
+
+	if self.MemoryLimit > 0 {
+		argv = append([]string{"prlimit", "--as=" + strconv.FormatUint(self.MemoryLimit, 10), "--"}, argv...)
+	}
+
+	if self.Bubblewrap {
+		bwrap := []string{
+			"bwrap",
+			"--die-with-parent",
+			"--new-session",
+			"--unshare-all",
+			"--dev", "/dev",
+			"--proc", "/proc",
+			"--tmpfs", "/tmp",
+		}
+		if self.Network {
+			bwrap = append(bwrap, "--share-net")
+		}
+
+		roPaths := []string{"/nix", "/usr", "/bin", "/lib", "/lib64", "/etc", "/run/current-system"}
+		if self.sourcesDir != "" {
+			roPaths = append(roPaths, self.sourcesDir)
+		}
+		for _, path := range paths {
+			// Local sources are symlinks so we need their targets.
+			if resolved, err := filepath.EvalSymlinks(path); err == nil {
+				path = resolved
+			}
+			roPaths = append(roPaths, path)
+		}
+		for _, path := range roPaths {
+			bwrap = append(bwrap, "--ro-bind-try", path, path)
+		}
+
+		// The home directory of the host is not available.
+		env = append(env, "HOME=/tmp")
+
+		argv = append(append(bwrap, "--"), argv...)
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...) //nolint:gosec // that is the point
+	cmd.Env = env
+	// Run in a new process group so we can kill all descendants.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	return cmd
+}
+
+// Like `cmd.Output()` but kills the command's process group
+// if it does not finish within the timeout.
+// Returns an `EvaluationError` on timeout.
+func (self evaluationProcesses) output(cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if self.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.timeout)
+		defer cancel()
+	}
+
+	waited := make(chan struct{})
+	defer close(waited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-waited:
+		}
+	}()
+
+	err := cmd.Wait()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return stdout.Bytes(), EvaluationError{err: errors.Errorf("Did not finish within %s\nStderr: %s", self.timeout, stderr.Bytes())}
+	}
+
+	var errExit *exec.ExitError
+	if errors.As(err, &errExit) {
+		errExit.Stderr = stderr.Bytes()
+	}
+
+	return stdout.Bytes(), err
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		_ = cmd.Process.Kill()
+	}
+}
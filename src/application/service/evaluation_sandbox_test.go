@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldOnlyPassAllowedEnvironment(t *testing.T) {
+	// given
+	processes := evaluationProcesses{EvaluationSandbox: EvaluationSandbox{
+		Env: []string{"PATH", "CICERO_TEST_*"},
+	}}
+	t.Setenv("CICERO_TEST_FOO", "foo")
+	t.Setenv("DATABASE_URL", "secret")
+
+	// when
+	output, err := processes.output(processes.command([]string{"EXTRA=extra"}, nil, "env"))
+
+	// then
+	assert.NoError(t, err)
+	assert.Contains(t, string(output), "PATH=")
+	assert.Contains(t, string(output), "CICERO_TEST_FOO=foo")
+	assert.Contains(t, string(output), "EXTRA=extra")
+	assert.NotContains(t, string(output), "DATABASE_URL")
+}
+
+func TestShouldKillProcessGroupOnTimeout(t *testing.T) {
+	t.Parallel()
+
+	// given
+	processes := evaluationProcesses{timeout: 100 * time.Millisecond}
+	command := writeEvaluator(t, "sleep 10 & sleep 10")
+
+	// when
+	start := time.Now()
+	_, err := processes.output(processes.command(nil, nil, command))
+
+	// then
+	var evalErr EvaluationError
+	assert.True(t, errors.As(err, &evalErr))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
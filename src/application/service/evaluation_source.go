@@ -0,0 +1,363 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/direnv/direnv/v2/sri"
+	"github.com/google/uuid"
+	getter "github.com/hashicorp/go-getter/v2"
+	"github.com/pkg/errors"
+
+	"github.com/input-output-hk/cicero/src/config"
+)
+
+var gitRevisionRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func (e *evaluationService) sourcesDir() (string, error) {
+	cacheDir := config.GetenvStr("CICERO_CACHE_DIR")
+	if cacheDir == "" {
+		e.logger.Debug().Msg("Falling back to XDG cache directory")
+		cacheDir = xdg.CacheHome + "/cicero"
+	}
+	return filepath.Abs(cacheDir + "/revisions")
+}
+
+func (e *evaluationService) ResolveSource(src string) (string, error) {
+	_, revision, err := e.fetch(src, nil)
+	return revision, err
+}
+
+// Like go-getter's default client but HTTP requests also time out
+// as its HEAD requests do not honor the context.
+func newSourceGetter(timeout time.Duration) *getter.Client {
+	getters := make([]getter.Getter, len(getter.Getters))
+	for i, g := range getter.Getters {
+		if _, ok := g.(*getter.HttpGetter); ok && timeout > 0 {
+			g = &getter.HttpGetter{Netrc: true, Client: &http.Client{Timeout: timeout}}
+		}
+		getters[i] = g
+	}
+	return &getter.Client{Getters: getters, Decompressors: getter.Decompressors}
+}
+
+// Returns the path to a source tree at the given revision
+// or at the latest revision if none is given.
+// Source trees are kept in the cache directory by revision
+// so that evaluations of pinned revisions do not need to download anything.
+func (e *evaluationService) fetch(src string, revision *string) (string, string, error) {
+	fetchUrl, _, err := parseSource(src)
+	if err != nil {
+		return "", "", err
+	}
+
+	sourcesDir, err := e.sourcesDir()
+	if err != nil {
+		return "", "", err
+	}
+	srcDir := filepath.Join(sourcesDir, sourceDirName(fetchUrl))
+
+	// after unlocking as garbage collection takes the lock of every source
+	defer e.maybeCollectGarbage(sourcesDir)
+
+	lock := e.sourceLock(srcDir)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if revision != nil {
+		dst := filepath.Join(srcDir, revisionDirName(*revision))
+		if info, err := os.Lstat(dst); err == nil {
+			if info.Mode()&fs.ModeSymlink != 0 {
+				// Local sources are linked instead of copied
+				// so we have to make sure they did not change.
+				if actual, err := resolveRevision(dst); err != nil {
+					return "", "", err
+				} else if actual != *revision {
+					return "", "", fmt.Errorf("Source %q is at revision %q instead of pinned revision %q", src, actual, *revision)
+				}
+			}
+
+			return dst, *revision, touch(dst)
+		} else if !os.IsNotExist(err) {
+			return "", "", err
+		}
+
+		if gitRevisionRegexp.MatchString(*revision) {
+			query := fetchUrl.Query()
+			query.Set("ref", *revision)
+			query.Del("depth")
+			fetchUrl.RawQuery = query.Encode()
+		}
+	}
+
+	if err := os.MkdirAll(srcDir, 0o755); err != nil {
+		return "", "", err
+	}
+
+	// so that a hanging fetch does not hold the lock forever
+	ctx := context.Background()
+	if e.EvaluationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.EvaluationTimeout)
+		defer cancel()
+	}
+
+	tmp := filepath.Join(sourcesDir, ".fetch-"+uuid.New().String())
+	e.logger.Debug().Str("source", fetchUrl.String()).Str("destination", tmp).Msg("Fetching source")
+	if result, err := e.sourceGetter.Get(ctx, &getter.Request{Src: fetchUrl.String(), Dst: tmp, GetMode: getter.ModeAny}); err != nil {
+		if err := os.RemoveAll(tmp); err != nil {
+			e.logger.Err(err).Str("path", tmp).Msg("Could not remove partially fetched source")
+		}
+		return "", "", errors.WithMessagef(err, "While fetching source %q", fetchUrl)
+	} else if result.Dst != tmp {
+		return "", "", fmt.Errorf("go-getter did not download to the given directory. This should never happen™")
+	}
+
+	resolved, err := resolveRevision(tmp)
+	if err != nil {
+		return "", "", errors.WithMessagef(err, "While resolving revision of source %q", src)
+	}
+
+	if revision != nil && resolved != *revision {
+		if err := os.RemoveAll(tmp); err != nil {
+			e.logger.Err(err).Str("path", tmp).Msg("Could not remove fetched source")
+		}
+		return "", "", fmt.Errorf("Source %q is at revision %q and pinned revision %q is not available", src, resolved, *revision)
+	}
+
+	dst := filepath.Join(srcDir, revisionDirName(resolved))
+	if _, err := os.Lstat(dst); err == nil {
+		if err := os.RemoveAll(tmp); err != nil {
+			return "", "", err
+		}
+		if err := touch(dst); err != nil {
+			return "", "", err
+		}
+	} else if err := os.Rename(tmp, dst); err != nil {
+		return "", "", err
+	}
+
+	e.logger.Debug().Str("source", src).Str("revision", resolved).Msg("Fetched source")
+
+	return dst, resolved, nil
+}
+
+// The name of the directory that holds the revisions of a source.
+func sourceDirName(fetchUrl *url.URL) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fetchUrl.String()))
+}
+
+// The name of the directory that holds a revision of a source.
+// Content hashes are base64 encoded so they may contain slashes.
+func revisionDirName(revision string) string {
+	return strings.NewReplacer("/", "_", "+", "-").Replace(revision)
+}
+
+func (e *evaluationService) sourceLock(srcDir string) *sync.Mutex {
+	e.sourcesMutex.Lock()
+	defer e.sourcesMutex.Unlock()
+
+	lock, exists := e.sourceLocks[srcDir]
+	if !exists {
+		lock = &sync.Mutex{}
+		e.sourceLocks[srcDir] = lock
+	}
+	return lock
+}
+
+// Marks a source tree as used so it is not garbage collected.
+// Symlinks to local sources are not followed.
+func touch(path string) error {
+	if info, err := os.Lstat(path); err != nil {
+		return err
+	} else if info.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// Returns the commit of a git checkout
+// or else an SRI hash of the tree's contents.
+func resolveRevision(dir string) (string, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		cmd := exec.Command("git", "rev-parse", "HEAD")
+		cmd.Dir = dir
+		if output, err := cmd.Output(); err != nil {
+			return "", errors.WithMessage(err, "While getting git revision")
+		} else {
+			return strings.TrimSpace(string(output)), nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	hash := sri.NewWriter(io.Discard, sri.SHA256)
+	if err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(hash, "%s\x00%s\x00", rel, info.Mode().Type()|info.Mode().Perm()&0o111)
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if target, err := os.Readlink(path); err != nil {
+				return err
+			} else {
+				fmt.Fprintf(hash, "%s\x00", target)
+			}
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			if _, err := io.Copy(hash, file); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	return hash.Sum(), nil
+}
+
+func (e *evaluationService) maybeCollectGarbage(sourcesDir string) {
+	e.sourcesMutex.Lock()
+	if e.SourceMaxAge <= 0 || time.Since(e.lastGarbageCollection) < e.SourceMaxAge/10 {
+		e.sourcesMutex.Unlock()
+		return
+	}
+	// set before collecting so that concurrent fetches do not collect as well
+	e.lastGarbageCollection = time.Now()
+	e.sourcesMutex.Unlock()
+
+	if err := e.collectGarbage(sourcesDir); err != nil {
+		e.logger.Err(err).Msg("Could not collect garbage in source cache")
+	}
+}
+
+// Removes source trees that have not been used for longer than `SourceMaxAge`
+// unless an action is pinned to them, as revisions that are content hashes
+// cannot be fetched again.
+func (e *evaluationService) collectGarbage(sourcesDir string) error {
+	srcDirs, err := os.ReadDir(sourcesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	pinned := map[string]map[string]struct{}{} // revisions by source directory
+	if sourceRevisions, err := e.actionRepository.GetSourceRevisions(); err != nil {
+		return errors.WithMessage(err, "Could not get revisions that actions are pinned to")
+	} else {
+		for src, revisions := range sourceRevisions {
+			fetchUrl, _, err := parseSource(src)
+			if err != nil {
+				continue
+			}
+
+			name := sourceDirName(fetchUrl)
+			if pinned[name] == nil {
+				pinned[name] = map[string]struct{}{}
+			}
+			for _, revision := range revisions {
+				pinned[name][revisionDirName(revision)] = struct{}{}
+			}
+		}
+	}
+
+	threshold := time.Now().Add(-e.SourceMaxAge)
+
+	remove := func(path string) error {
+		e.logger.Debug().Str("path", path).Msg("Removing unused source tree")
+		return os.RemoveAll(path)
+	}
+
+	for _, srcDir := range srcDirs {
+		srcPath := filepath.Join(sourcesDir, srcDir.Name())
+
+		if strings.HasPrefix(srcDir.Name(), ".fetch-") {
+			// left over from an interrupted fetch
+			if info, err := srcDir.Info(); err != nil {
+				return err
+			} else if info.ModTime().Before(threshold) {
+				if err := remove(srcPath); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := func() error {
+			lock := e.sourceLock(srcPath)
+			lock.Lock()
+			defer lock.Unlock()
+
+			revisions, err := os.ReadDir(srcPath)
+			if err != nil {
+				return err
+			}
+
+			removed := 0
+			for _, revision := range revisions {
+				if _, isPinned := pinned[srcDir.Name()][revision.Name()]; isPinned {
+					continue
+				}
+
+				if info, err := revision.Info(); err != nil {
+					return err
+				} else if info.ModTime().Before(threshold) {
+					if err := remove(filepath.Join(srcPath, revision.Name())); err != nil {
+						return err
+					}
+					removed += 1
+				}
+			}
+
+			if removed == len(revisions) {
+				return os.Remove(srcPath)
+			}
+			return nil
+		}(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldResolveRevisionOfDirectoryByContent(t *testing.T) {
+	t.Parallel()
+
+	// given
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "actions.cue"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	first, firstErr := resolveRevision(dir)
+	again, againErr := resolveRevision(dir)
+	if err := os.WriteFile(filepath.Join(dir, "actions.cue"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed, changedErr := resolveRevision(dir)
+
+	// then
+	assert.NoError(t, firstErr)
+	assert.NoError(t, againErr)
+	assert.NoError(t, changedErr)
+	assert.Regexp(t, `^sha256-`, first)
+	assert.Equal(t, first, again)
+	assert.NotEqual(t, first, changed)
+}
+
+func TestShouldResolveRevisionOfGitCheckout(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	// given
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "test"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatal(err, string(output))
+		}
+	}
+
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	head, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	revision, err := resolveRevision(dir)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, string(head[:40]), revision)
+	assert.Regexp(t, gitRevisionRegexp, revision)
+}
+
+func TestShouldCollectGarbageExceptPinnedRevisions(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+
+	src := "github.com/input-output-hk/cicero#cue"
+	mock.ExpectQuery("SELECT DISTINCT source, source_revision FROM action").
+		WillReturnRows(mock.NewRows([]string{"source", "source_revision"}).AddRow(src, "sha256-pinned/with+slash="))
+
+	logger := zerolog.Nop()
+	service, err := NewEvaluationService(mock, nil, nil, 0, 0, time.Hour, 0, 0, EvaluationSandbox{}, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchUrl, _, err := parseSource(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourcesDir := t.TempDir()
+	srcDir := filepath.Join(sourcesDir, sourceDirName(fetchUrl))
+	otherSrcDir := filepath.Join(sourcesDir, sourceDirName(&url.URL{Path: "other"}))
+
+	old := time.Now().Add(-2 * time.Hour)
+	for path, modTime := range map[string]time.Time{
+		filepath.Join(srcDir, revisionDirName("sha256-pinned/with+slash=")): old,
+		filepath.Join(srcDir, "unused"):                                     old,
+		filepath.Join(srcDir, "recent"):                                     time.Now(),
+		filepath.Join(otherSrcDir, "unused"):                                old,
+	} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// when
+	err = service.(*evaluationService).collectGarbage(sourcesDir)
+
+	// then
+	assert.NoError(t, err)
+	assert.DirExists(t, filepath.Join(srcDir, "sha256-pinned_with-slash="))
+	assert.DirExists(t, filepath.Join(srcDir, "recent"))
+	assert.NoDirExists(t, filepath.Join(srcDir, "unused"))
+	assert.NoDirExists(t, otherSrcDir)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldTimeOutHangingFetch(t *testing.T) {
+	// given
+	t.Setenv("CICERO_CACHE_DIR", t.TempDir())
+
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer hanging.Close()
+
+	logger := zerolog.Nop()
+	service, err := NewEvaluationService(nil, nil, nil, 0, 0, 0, 0, 100*time.Millisecond, EvaluationSandbox{}, &logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	start := time.Now()
+	_, err = service.ResolveSource(hanging.URL + "/source.tar.gz")
+
+	// then
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Second))
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Evaluators that advertise `"worker": true` in their capabilities
+// can be started as `cicero-evaluator-<name> worker`.
+// Workers read newline-delimited protocol version 2 requests on stdin
+// and write one newline-delimited response per request on stdout.
+// They must answer a request with command "ping" with any result
+// and exit when stdin is closed.
+// Note that a bubblewrap sandbox only exposes the sources directory to workers
+// so local sources outside of it cannot be evaluated.
+type evaluatorPool struct {
+	command             string
+	processes           evaluationProcesses // its timeout applies per request
+	healthCheckInterval time.Duration       // idle workers are pinged before reuse after this long
+	logger              zerolog.Logger
+
+	// Holds one slot per worker. A nil slot has no running worker yet.
+	slots chan *evaluatorWorker
+}
+
+func newEvaluatorPool(command string, processes evaluationProcesses, size int, logger zerolog.Logger) *evaluatorPool {
+	pool := &evaluatorPool{
+		command:             command,
+		processes:           processes,
+		healthCheckInterval: time.Minute,
+		logger:              logger,
+		slots:               make(chan *evaluatorWorker, size),
+	}
+	for i := 0; i < size; i++ {
+		pool.slots <- nil
+	}
+	return pool
+}
+
+func (self *evaluatorPool) evaluate(req evaluationRequest) ([]byte, error) {
+	req.Protocol = 2
+
+	reqJson, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not marshal evaluation request")
+	}
+
+	worker := <-self.slots
+	defer func() { self.slots <- worker }()
+
+	if worker != nil && time.Since(worker.lastUsed) > self.healthCheckInterval {
+		if err := self.healthCheck(worker); err != nil {
+			self.logger.Warn().Err(err).Int("pid", worker.cmd.Process.Pid).Msg("Evaluator worker failed health check, restarting")
+			worker.kill()
+			worker = nil
+		}
+	}
+
+	if worker == nil {
+		if worker, err = self.start(); err != nil {
+			return nil, errors.WithMessage(err, "Could not start evaluator worker")
+		}
+	}
+
+	self.logger.Debug().
+		Int("pid", worker.cmd.Process.Pid).
+		RawJSON("request", reqJson).
+		Msg("Sending request to evaluator worker")
+
+	output, err := worker.roundtrip(reqJson, self.processes.timeout)
+	if err != nil {
+		worker.kill()
+		stderr := worker.stderr.take()
+		worker = nil
+
+		if errors.Is(err, errEvaluatorWorkerTimeout) {
+			return nil, EvaluationError{err: errors.WithMessagef(err, "Evaluation did not finish within %s\nStderr: %s", self.processes.timeout, stderr)}
+		}
+		return nil, errors.WithMessagef(err, "Evaluator worker crashed\nStderr: %s", stderr)
+	}
+
+	return decodeEvaluationResponse(output, worker.stderr.take(), nil, self.logger)
+}
+
+func (self *evaluatorPool) healthCheck(worker *evaluatorWorker) error {
+	output, err := worker.roundtrip([]byte(`{"protocol":2,"command":"ping"}`), self.processes.timeout)
+	stderr := worker.stderr.take()
+	if err != nil {
+		return err
+	}
+	_, err = decodeEvaluationResponse(output, stderr, nil, self.logger)
+	return err
+}
+
+func (self *evaluatorPool) start() (*evaluatorWorker, error) {
+	worker := &evaluatorWorker{cmd: self.processes.command(nil, nil, self.command, "worker")}
+
+	var err error
+	if worker.stdin, err = worker.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := worker.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	worker.stdout = bufio.NewReader(stdout)
+	// Not using `cmd.Stderr` because then `cmd.Wait()` would block
+	// until all children of a killed worker have closed it.
+	stderr, err := worker.cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := worker.cmd.Start(); err != nil {
+		return nil, err
+	}
+	worker.stderrDone = make(chan struct{})
+	go func() {
+		defer close(worker.stderrDone)
+		_, _ = io.Copy(&worker.stderr, stderr)
+	}()
+
+	worker.lastUsed = time.Now()
+
+	self.logger.Debug().Int("pid", worker.cmd.Process.Pid).Msg("Started evaluator worker")
+
+	return worker, nil
+}
+
+var errEvaluatorWorkerTimeout = errors.New("Evaluator worker timed out")
+
+type evaluatorWorker struct {
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	stdout     *bufio.Reader
+	stderr     syncBuffer
+	stderrDone chan struct{}
+	lastUsed   time.Time
+}
+
+// Sends a request and reads the response. Not safe for concurrent use.
+func (self *evaluatorWorker) roundtrip(req []byte, timeout time.Duration) ([]byte, error) {
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		if _, err := self.stdin.Write(append(req, '\n')); err != nil {
+			done <- result{err: err}
+			return
+		}
+		line, err := self.stdout.ReadBytes('\n')
+		done <- result{output: line, err: err}
+	}()
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	select {
+	case r := <-done:
+		self.lastUsed = time.Now()
+		return r.output, r.err
+	case <-timeoutChan:
+		return nil, errEvaluatorWorkerTimeout
+	}
+}
+
+func (self *evaluatorWorker) kill() {
+	_ = self.stdin.Close()
+	killProcessGroup(self.cmd)
+	// `cmd.Wait()` closes stderr so read what is left first,
+	// but do not hang on descendants that escaped the process group.
+	select {
+	case <-self.stderrDone:
+	case <-time.After(time.Second):
+	}
+	_ = self.cmd.Wait()
+	<-self.stderrDone
+}
+
+// A buffer that can be written to by one goroutine and taken from by another.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (self *syncBuffer) Write(p []byte) (int, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.buffer.Write(p)
+}
+
+// Returns the buffered bytes and empties the buffer.
+func (self *syncBuffer) take() []byte {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	b := append([]byte(nil), self.buffer.Bytes()...)
+	self.buffer.Reset()
+	return b
+}
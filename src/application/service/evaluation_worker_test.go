@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEvaluatorWorker = `
+while read -r req; do
+	case "$req" in
+		*'"name":"crash"'*) echo 'boom' >&2; exit 1 ;;
+		*'"name":"hang"'*) while :; do :; done ;;
+		*) printf '{"protocol":2,"result":{"pid":%d}}\n' $$ ;;
+	esac
+done
+`
+
+func evaluateWorkerPid(t *testing.T, pool *evaluatorPool, name string) (int, error) {
+	output, err := pool.evaluate(evaluationRequest{Command: "eval", Name: name})
+	if err != nil {
+		return 0, err
+	}
+	var result struct{ Pid int }
+	if err := json.Unmarshal(output, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Pid, nil
+}
+
+func TestShouldReuseEvaluatorWorker(t *testing.T) {
+	t.Parallel()
+
+	// given
+	pool := newEvaluatorPool(writeEvaluator(t, testEvaluatorWorker), evaluationProcesses{timeout: time.Minute}, 1, zerolog.Nop())
+
+	// when
+	pid1, err1 := evaluateWorkerPid(t, pool, "a")
+	pid2, err2 := evaluateWorkerPid(t, pool, "b")
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Equal(t, pid1, pid2)
+}
+
+func TestShouldRestartCrashedEvaluatorWorker(t *testing.T) {
+	t.Parallel()
+
+	// given
+	pool := newEvaluatorPool(writeEvaluator(t, testEvaluatorWorker), evaluationProcesses{timeout: time.Minute}, 1, zerolog.Nop())
+	pid1, _ := evaluateWorkerPid(t, pool, "a")
+
+	// when
+	_, errCrash := evaluateWorkerPid(t, pool, "crash")
+	pid2, err := evaluateWorkerPid(t, pool, "a")
+
+	// then
+	assert.Error(t, errCrash)
+	assert.Contains(t, errCrash.Error(), "boom")
+	assert.NoError(t, err)
+	assert.NotEqual(t, pid1, pid2)
+}
+
+func TestShouldTimeOutEvaluatorWorker(t *testing.T) {
+	t.Parallel()
+
+	// given
+	pool := newEvaluatorPool(writeEvaluator(t, testEvaluatorWorker), evaluationProcesses{timeout: 100 * time.Millisecond}, 1, zerolog.Nop())
+
+	// when
+	_, errHang := evaluateWorkerPid(t, pool, "hang")
+	_, err := evaluateWorkerPid(t, pool, "a")
+
+	// then
+	var evalErr EvaluationError
+	assert.True(t, errors.As(errHang, &evalErr))
+	assert.NoError(t, err)
+}
+
+func TestShouldRestartUnhealthyEvaluatorWorker(t *testing.T) {
+	t.Parallel()
+
+	// given
+	pool := newEvaluatorPool(writeEvaluator(t, testEvaluatorWorker), evaluationProcesses{timeout: time.Minute}, 1, zerolog.Nop())
+	pool.healthCheckInterval = 0
+	pid1, _ := evaluateWorkerPid(t, pool, "a")
+	worker := <-pool.slots
+	_ = worker.cmd.Process.Kill()
+	pool.slots <- worker
+
+	// when
+	pid2, err := evaluateWorkerPid(t, pool, "a")
+
+	// then
+	assert.NoError(t, err)
+	assert.NotEqual(t, pid1, pid2)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 	nomad "github.com/hashicorp/nomad/api"
@@ -17,9 +18,11 @@ import (
 type NomadEventService interface {
 	WithQuerier(config.PgxIface) NomadEventService
 
-	Save(*nomad.Event) error
-	GetLastNomadEvent() (uint64, error)
+	Save(cluster string, jobId uuid.UUID, event *nomad.Event) error
+	GetLastNomadEvent(cluster string) (uint64, error)
+	SaveLastNomadEvent(cluster string, index uint64) error
 	GetEventAllocByNomadJobId(id uuid.UUID) (map[string]domain.AllocWrapper, error)
+	DeleteOlderThan(time.Time) error
 }
 
 type nomadEventService struct {
@@ -44,18 +47,52 @@ func (n *nomadEventService) WithQuerier(querier config.PgxIface) NomadEventServi
 	}
 }
 
-func (n *nomadEventService) Save(event *nomad.Event) error {
-	n.logger.Debug().Msgf("Saving new NomadEvent %d", event.Index)
-	if err := n.nomadEventRepository.Save(event); err != nil {
+func (n *nomadEventService) Save(cluster string, jobId uuid.UUID, event *nomad.Event) error {
+	n.logger.Debug().Msgf("Saving new NomadEvent %d of cluster %q", event.Index, cluster)
+
+	// The allocation's job is already stored with the run.
+	compact := *event
+	compact.Payload = map[string]interface{}{}
+	for k, v := range event.Payload {
+		compact.Payload[k] = v
+	}
+	if alloc, ok := event.Payload["Allocation"].(map[string]interface{}); ok {
+		compactAlloc := map[string]interface{}{}
+		for k, v := range alloc {
+			compactAlloc[k] = v
+		}
+		delete(compactAlloc, "Job")
+		compact.Payload["Allocation"] = compactAlloc
+	}
+
+	if err := n.nomadEventRepository.Save(cluster, jobId, &compact); err != nil {
 		return errors.WithMessagef(err, "Could not insert NomadEvent")
 	}
 	n.logger.Debug().Msgf("Created NomadEvent %d", event.Index)
 	return nil
 }
 
-func (n *nomadEventService) GetLastNomadEvent() (uint64, error) {
-	n.logger.Debug().Msg("Get last Nomad Event")
-	return n.nomadEventRepository.GetLastNomadEvent()
+func (n *nomadEventService) GetLastNomadEvent(cluster string) (uint64, error) {
+	n.logger.Debug().Msgf("Get last Nomad Event of cluster %q", cluster)
+	return n.nomadEventRepository.GetLastNomadEvent(cluster)
+}
+
+func (n *nomadEventService) SaveLastNomadEvent(cluster string, index uint64) error {
+	n.logger.Debug().Msgf("Saving last Nomad Event %d of cluster %q", index, cluster)
+	if err := n.nomadEventRepository.SaveLastNomadEvent(cluster, index); err != nil {
+		return errors.WithMessagef(err, "Could not save last Nomad Event index of cluster %q", cluster)
+	}
+	return nil
+}
+
+func (n *nomadEventService) DeleteOlderThan(t time.Time) error {
+	n.logger.Debug().Time("older-than", t).Msg("Deleting old Nomad Events")
+	if deleted, err := n.nomadEventRepository.DeleteOlderThan(t); err != nil {
+		return errors.WithMessagef(err, "Could not delete Nomad Events older than %s", t)
+	} else {
+		n.logger.Debug().Int64("deleted", deleted).Msg("Deleted old Nomad Events")
+	}
+	return nil
 }
 
 func (n *nomadEventService) GetEventAllocByNomadJobId(nomadJobId uuid.UUID) (map[string]domain.AllocWrapper, error) {
@@ -85,11 +122,12 @@ func (n *nomadEventService) GetEventAllocByNomadJobId(nomadJobId uuid.UUID) (map
 		logs := map[string]*domain.LokiOutput{}
 
 		for taskName := range alloc.TaskResources {
-			taskLogs, err := n.runService.RunLogs(alloc.ID, alloc.TaskGroup, taskName, run.CreatedAt, run.FinishedAt)
-			if err != nil {
-				return nil, err
+			// the allocation is still worth showing without logs
+			if taskLogs, err := n.runService.RunLogs(&run, alloc.ID, alloc.TaskGroup, taskName); err != nil {
+				n.logger.Warn().Err(err).Str("alloc", alloc.ID).Str("task", taskName).Msg("Failed to get task logs")
+			} else {
+				logs[taskName] = taskLogs
 			}
-			logs[taskName] = taskLogs
 		}
 
 		allocs[alloc.Name] = domain.AllocWrapper{Alloc: alloc, Logs: logs}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pashagolub/pgxmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSaveNomadEventWithoutAllocationJob(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+
+	jobId := uuid.New()
+	event := nomad.Event{
+		Topic: nomad.TopicAllocation,
+		Type:  "AllocationUpdated",
+		Key:   "alloc",
+		Index: 42,
+		Payload: map[string]interface{}{
+			"Allocation": map[string]interface{}{
+				"ID":    "alloc",
+				"JobID": jobId.String(),
+				"Job":   map[string]interface{}{"ID": jobId.String()},
+			},
+		},
+	}
+
+	mock.ExpectExec("INSERT INTO nomad_event").
+		WithArgs("ci", jobId, event.Topic, event.Type, event.Key, event.FilterKeys, event.Index, map[string]interface{}{
+			"Allocation": map[string]interface{}{
+				"ID":    "alloc",
+				"JobID": jobId.String(),
+			},
+		}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	logger := zerolog.Nop()
+	service := NewNomadEventService(mock, nil, &logger)
+
+	// when
+	err = service.Save("ci", jobId, &event)
+
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Contains(t, event.Payload["Allocation"], "Job", "the event itself must not be changed")
+}
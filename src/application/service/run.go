@@ -2,18 +2,13 @@ package service
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"strconv"
+	"sort"
 	"time"
 
+	"github.com/georgysavva/scany/pgxscan"
 	"github.com/google/uuid"
-	"github.com/grafana/loki/pkg/loghttp"
-	nomad "github.com/hashicorp/nomad/api"
 	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
-	prometheus "github.com/prometheus/client_golang/api"
 	"github.com/rs/zerolog"
 
 	"github.com/input-output-hk/cicero/src/application"
@@ -29,45 +24,72 @@ type RunService interface {
 	GetByNomadJobId(uuid.UUID) (domain.Run, error)
 	GetInputFactIdsByNomadJobId(uuid.UUID) (repository.RunInputFactIds, error)
 	GetOutputByNomadJobId(uuid.UUID) (domain.RunOutput, error)
+	GetJobByNomadJobId(uuid.UUID) (domain.RunJob, error)
 	GetByActionId(uuid.UUID, *repository.Page) ([]*domain.Run, error)
 	GetLatestByActionId(uuid.UUID) (domain.Run, error)
 	GetAll(*repository.Page) ([]*domain.Run, error)
 	GetByInputFactIds([]*uuid.UUID, bool, *repository.Page) ([]*domain.Run, error)
+	GetRunning() ([]*domain.Run, error)
 	Save(*domain.Run, map[string]interface{}, *domain.RunOutput) error
+	SaveJob(*domain.RunJob) error
 	Update(*domain.Run) error
-	End(*domain.Run) error
+	// Starts a saved run unless its action's concurrency limit is reached,
+	// in which case the action's concurrency policy decides.
+	// Must be called in a transaction as the runs of the action are locked until its end.
+	Schedule(*domain.Run, *domain.Action) error
+	// Submits the saved job of a queued run to Nomad.
+	Start(*domain.Run) error
+	// Starts queued runs that may start now, like retries after their backoff.
+	StartDue() error
+	// Returns the next attempt of a failed run, without saving it, if its action's retry policy asks for it.
+	// Returns nil if the run is not retried, also if the policy is invalid.
+	NextAttempt(run *domain.Run, exitCodes []int, lost bool) (*domain.Run, error)
+	// Saves the next attempt of a run with the same inputs and job and schedules it.
+	// Must be called after the run ended so that it does not take up a slot of the action's concurrency limit.
+	Retry(run, attempt *domain.Run) error
+	// Also updates the output if not nil to record what was published.
+	// Starts queued runs of the action if this frees up a slot.
+	End(*domain.Run, *domain.RunOutput) error
 	Cancel(*domain.Run) error
-	JobLogs(id uuid.UUID, start time.Time, end *time.Time) (*domain.LokiOutput, error)
-	RunLogs(allocId, taskGroup, taskName string, start time.Time, end *time.Time) (*domain.LokiOutput, error)
+	// Ends the run right away as there may never be an event for it
+	// and stops its Nomad job.
+	TimeOut(*domain.Run, *domain.RunOutput) error
+	// Returns a page of the log lines of the run's job that match the query.
+	Logs(*domain.Run, domain.LogQuery) (*domain.LogPage, error)
+	// Calls the given function with every log line of the run's job that matches the query,
+	// starting at the query's cursor regardless of its limit.
+	AllLogs(*domain.Run, domain.LogQuery, func(domain.LogLine) error) error
+	RunLogs(run *domain.Run, allocId, taskGroup, taskName string) (*domain.LokiOutput, error)
+	// Calls the given function with every log line of the run's job since the given time,
+	// optionally only of the given task, as they come in until the context is done.
+	TailLogs(ctx context.Context, run *domain.Run, taskName string, since time.Time, fn func(domain.LogLine) error) error
 }
 
 type runService struct {
 	logger              zerolog.Logger
 	runRepository       repository.RunRepository
 	runOutputRepository repository.RunOutputRepository
-	prometheus          prometheus.Client
-	nomadClient         application.NomadClient
+	runJobRepository    repository.RunJobRepository
+	actionRepository    repository.ActionRepository
+	logProvider         application.LogProvider
+	nomadClusters       application.NomadClusters
+	jobConfig           RunJobConfig
 	db                  config.PgxIface
 }
 
-func NewRunService(db config.PgxIface, prometheusAddr string, nomadClient application.NomadClient, logger *zerolog.Logger) RunService {
+func NewRunService(db config.PgxIface, logProvider application.LogProvider, nomadClusters application.NomadClusters, jobConfig RunJobConfig, logger *zerolog.Logger) RunService {
 	impl := runService{
 		logger:              logger.With().Str("component", "RunService").Logger(),
 		runRepository:       persistence.NewRunRepository(db),
 		runOutputRepository: persistence.NewRunOutputRepository(db),
-		nomadClient:         nomadClient,
+		runJobRepository:    persistence.NewRunJobRepository(db),
+		actionRepository:    persistence.NewActionRepository(db),
+		nomadClusters:       nomadClusters,
+		logProvider:         logProvider,
+		jobConfig:           jobConfig,
 		db:                  db,
 	}
 
-	if prom, err := prometheus.NewClient(prometheus.Config{
-		Address: prometheusAddr,
-	}); err != nil {
-		impl.logger.Fatal().Err(err).Msg("Failed to create new prometheus client")
-		return nil
-	} else {
-		impl.prometheus = prom
-	}
-
 	return &impl
 }
 
@@ -76,8 +98,11 @@ func (self *runService) WithQuerier(querier config.PgxIface) RunService {
 		logger:              self.logger,
 		runRepository:       self.runRepository.WithQuerier(querier),
 		runOutputRepository: self.runOutputRepository.WithQuerier(querier),
-		prometheus:          self.prometheus,
-		nomadClient:         self.nomadClient,
+		runJobRepository:    self.runJobRepository.WithQuerier(querier),
+		actionRepository:    self.actionRepository.WithQuerier(querier),
+		logProvider:         self.logProvider,
+		nomadClusters:       self.nomadClusters,
+		jobConfig:           self.jobConfig,
 		db:                  querier,
 	}
 }
@@ -103,6 +128,13 @@ func (self *runService) GetOutputByNomadJobId(id uuid.UUID) (output domain.RunOu
 	return
 }
 
+func (self *runService) GetJobByNomadJobId(id uuid.UUID) (runJob domain.RunJob, err error) {
+	self.logger.Debug().Str("nomad-job-id", id.String()).Msg("Getting Run Job by Nomad Job ID")
+	runJob, err = self.runJobRepository.GetByRunId(id)
+	err = errors.WithMessagef(err, "Could not select existing Run Job by Nomad Job ID %q", id)
+	return
+}
+
 func (self *runService) GetByActionId(id uuid.UUID, page *repository.Page) (runs []*domain.Run, err error) {
 	self.logger.Debug().Str("id", id.String()).Int("offset", page.Offset).Int("limit", page.Limit).Msgf("Getting Run by Action ID")
 	runs, err = self.runRepository.GetByActionId(id, page)
@@ -131,6 +163,13 @@ func (self *runService) GetByInputFactIds(factIds []*uuid.UUID, recursive bool,
 	return
 }
 
+func (self *runService) GetRunning() (runs []*domain.Run, err error) {
+	self.logger.Debug().Msg("Getting running Runs")
+	runs, err = self.runRepository.GetRunning()
+	err = errors.WithMessage(err, "Could not select running Runs")
+	return
+}
+
 func (self *runService) Save(run *domain.Run, inputs map[string]interface{}, output *domain.RunOutput) error {
 	self.logger.Debug().Msg("Saving new Run")
 	if err := self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
@@ -148,6 +187,15 @@ func (self *runService) Save(run *domain.Run, inputs map[string]interface{}, out
 	return nil
 }
 
+func (self *runService) SaveJob(runJob *domain.RunJob) error {
+	self.logger.Debug().Str("id", runJob.RunId.String()).Msg("Saving Run Job")
+	if err := self.runJobRepository.Save(runJob); err != nil {
+		return errors.WithMessagef(err, "Could not insert Run Job for Run with ID %q", runJob.RunId)
+	}
+	self.logger.Debug().Str("id", runJob.RunId.String()).Msg("Saved Run Job")
+	return nil
+}
+
 func (self *runService) Update(run *domain.Run) error {
 	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Updating Run")
 	if err := self.runRepository.Update(run); err != nil {
@@ -157,129 +205,398 @@ func (self *runService) Update(run *domain.Run) error {
 	return nil
 }
 
-func (self *runService) End(run *domain.Run) error {
-	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Ending Run")
-	if err := self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
-		if err := self.runRepository.WithQuerier(tx).Update(run); err != nil {
-			return errors.WithMessagef(err, "Could not update Run with ID %q", run.NomadJobID)
+func (self *runService) Schedule(run *domain.Run, action *domain.Action) error {
+	logger := self.logger.With().
+		Str("id", run.NomadJobID.String()).
+		Str("action", action.Name).
+		Logger()
+
+	concurrency, err := action.Concurrency()
+	if err != nil {
+		return errors.WithMessagef(err, "Could not get concurrency of Action with ID %q", action.ID)
+	} else if concurrency == nil {
+		return self.Start(run)
+	}
+
+	if err := self.runRepository.LockByActionName(action.Name); err != nil {
+		return errors.WithMessagef(err, "Could not lock Runs of Action %q", action.Name)
+	}
+
+	running, err := self.runRepository.GetRunningByActionName(action.Name)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select running Runs of Action %q", action.Name)
+	}
+
+	queued, err := self.runRepository.GetQueuedByActionName(action.Name)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select queued Runs of Action %q", action.Name)
+	}
+
+	switch concurrency.Policy {
+	case domain.ActionConcurrencyPolicySkip:
+		// The run itself is queued so it does not count.
+		if len(running)+len(queued)-1 < concurrency.Limit {
+			return self.Start(run)
 		}
-		if err := self.runOutputRepository.WithQuerier(tx).Delete(run.NomadJobID); err != nil {
-			return errors.WithMessagef(err, "Could not update Run Output with ID %q", run.NomadJobID)
+
+		logger.Debug().Int("limit", concurrency.Limit).Msg("Skipping Run")
+
+		now := time.Now().UTC()
+		reason := domain.RunEndReasonSkipped
+		run.FinishedAt = &now
+		run.EndReason = &reason
+		return self.endUnstarted(run)
+	case domain.ActionConcurrencyPolicyCancelOldest:
+		// Runs that are being canceled already still take up a slot until they end.
+		candidates := []*domain.Run{}
+		for _, r := range running {
+			if r.EndReason == nil {
+				candidates = append(candidates, r)
+			}
 		}
+		candidates = append(candidates, queued...)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].CreatedAt.Before(candidates[j].CreatedAt)
+		})
+
+		for i := 0; i < len(candidates)-concurrency.Limit; i++ {
+			logger.Debug().Str("canceled-id", candidates[i].NomadJobID.String()).Msg("Canceling oldest Run to make room")
+			if err := self.Cancel(candidates[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return self.startQueued(action.Name)
+}
+
+// Starts as many queued runs of the action as its concurrency limit allows.
+// Must be called in a transaction so that the lock is held until the runs are started.
+func (self *runService) startQueued(actionName string) error {
+	if err := self.runRepository.LockByActionName(actionName); err != nil {
+		return errors.WithMessagef(err, "Could not lock Runs of Action %q", actionName)
+	}
+
+	queued, err := self.runRepository.GetQueuedByActionName(actionName)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select queued Runs of Action %q", actionName)
+	} else if len(queued) == 0 {
 		return nil
-	}); err != nil {
-		return err
 	}
-	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Ended Run")
+
+	free := len(queued)
+
+	// the latest version decides
+	if action, err := self.actionRepository.GetLatestByName(actionName); err != nil {
+		return errors.WithMessagef(err, "Could not select latest Action for name %q", actionName)
+	} else if concurrency, err := action.Concurrency(); err != nil {
+		return errors.WithMessagef(err, "Could not get concurrency of Action with ID %q", action.ID)
+	} else if concurrency != nil {
+		running, err := self.runRepository.GetRunningByActionName(actionName)
+		if err != nil {
+			return errors.WithMessagef(err, "Could not select running Runs of Action %q", actionName)
+		}
+		free = concurrency.Limit - len(running)
+	}
+
+	for i := 0; i < free && i < len(queued); i++ {
+		if err := self.Start(queued[i]); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (self *runService) Cancel(run *domain.Run) error {
-	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Stopping Run")
-	// Nomad does not know whether the job simply ran to finish
-	// or was stopped manually. Delete output to avoid publishing it.
-	if err := self.runOutputRepository.Delete(run.NomadJobID); err != nil {
-		return err
-	} else if _, _, err := self.nomadClient.JobsDeregister(run.NomadJobID.String(), false, &nomad.WriteOptions{}); err != nil {
-		return errors.WithMessagef(err, "Failed to deregister job %q", run.NomadJobID)
+func (self *runService) StartDue() error {
+	names, err := self.runRepository.GetQueuedActionNames()
+	if err != nil {
+		return errors.WithMessage(err, "Could not select names of Actions with queued Runs")
 	}
-	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Stopped Run")
+
+	for _, name := range names {
+		if err := self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
+			return self.WithQuerier(tx).(*runService).startQueued(name)
+		}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (self *runService) JobLogs(nomadJobID uuid.UUID, start time.Time, end *time.Time) (*domain.LokiOutput, error) {
-	return self.LokiQueryRange(
-		fmt.Sprintf(`{nomad_job_id=%q}`, nomadJobID.String()),
-		start, end)
+func (self *runService) NextAttempt(run *domain.Run, exitCodes []int, lost bool) (*domain.Run, error) {
+	action, err := self.actionRepository.GetById(run.ActionId)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "Could not select Action for Run with ID %q", run.NomadJobID)
+	}
+
+	if retry, err := action.Retry(); err != nil {
+		// must not keep the run from ending
+		self.logger.Err(err).
+			Str("id", run.NomadJobID.String()).
+			Str("action-id", action.ID.String()).
+			Msg("Not retrying Run as the retry policy of its Action is invalid")
+		return nil, nil
+	} else if retry == nil || !retry.ShouldRetry(run.Attempt, exitCodes, lost) {
+		return nil, nil
+	} else {
+		attempt := domain.Run{
+			ActionId:       run.ActionId,
+			RetryOf:        run.RetryOf,
+			Attempt:        run.Attempt + 1,
+			NomadCluster:   run.NomadCluster,
+			NomadNamespace: run.NomadNamespace,
+			NomadRegion:    run.NomadRegion,
+		}
+		if attempt.RetryOf == nil {
+			attempt.RetryOf = &run.NomadJobID
+		}
+		if backoff := retry.BackoffBefore(attempt.Attempt); backoff > 0 {
+			startAfter := time.Now().UTC().Add(backoff)
+			attempt.StartAfter = &startAfter
+		}
+
+		return &attempt, nil
+	}
 }
 
-func (self *runService) RunLogs(allocID, taskGroup, taskName string, start time.Time, end *time.Time) (*domain.LokiOutput, error) {
-	return self.LokiQueryRange(
-		fmt.Sprintf(`{nomad_alloc_id=%q,nomad_task_group=%q,nomad_task_name=%q}`, allocID, taskGroup, taskName),
-		start, end)
+func (self *runService) Retry(run, attempt *domain.Run) error {
+	action, err := self.actionRepository.GetById(attempt.ActionId)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select Action for Run with ID %q", run.NomadJobID)
+	}
+
+	return self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
+		txSelf := self.WithQuerier(tx).(*runService)
+		return txSelf.saveAttempt(run, attempt, &action)
+	})
 }
 
-func (self *runService) LokiQueryRange(query string, start time.Time, end *time.Time) (*domain.LokiOutput, error) {
-	linesToFetch := 10000
-	// TODO: figure out the correct value for our infra, 5000 is the default
-	// configuration in loki
-	var limit int64 = 5000
-	output := &domain.LokiOutput{
-		Stdout: []domain.LokiLine{},
-		Stderr: []domain.LokiLine{},
+func (self *runService) saveAttempt(run, attempt *domain.Run, action *domain.Action) error {
+	inputFactIds, err := self.runRepository.GetInputFactIdsByNomadJobId(run.NomadJobID)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select input fact IDs of Run with ID %q", run.NomadJobID)
+	}
+	inputs := map[string]interface{}{}
+	for name, factIds := range inputFactIds {
+		facts := make([]*domain.Fact, len(factIds))
+		for i, factId := range factIds {
+			facts[i] = &domain.Fact{ID: factId}
+		}
+		inputs[name] = facts
 	}
 
-	if end == nil {
-		now := time.Now().UTC()
-		end = &now
+	output, err := self.runOutputRepository.GetByRunId(run.NomadJobID)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select Run Output with ID %q", run.NomadJobID)
+	}
+	attemptOutput := domain.RunOutput{
+		Success: output.Success,
+		Failure: output.Failure,
 	}
 
-	endLater := end.Add(1 * time.Minute)
-	end = &endLater
+	runJob, err := self.runJobRepository.GetByRunId(run.NomadJobID)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select Run Job for Run with ID %q", run.NomadJobID)
+	} else if runJob.Job == nil {
+		return errors.Errorf("Cannot retry Run with ID %q because it has no job", run.NomadJobID)
+	}
 
-	for {
-		req, err := http.NewRequest(
-			"GET",
-			self.prometheus.URL("/loki/api/v1/query_range", nil).String(),
-			http.NoBody,
-		)
-		if err != nil {
-			return output, err
-		}
+	if err := self.Save(attempt, inputs, &attemptOutput); err != nil {
+		return err
+	}
 
-		q := req.URL.Query()
-		q.Set("query", query)
-		q.Set("limit", strconv.FormatInt(limit, 10))
-		q.Set("start", strconv.FormatInt(start.UnixNano(), 10))
-		q.Set("end", strconv.FormatInt(end.UnixNano(), 10))
-		q.Set("direction", "FORWARD")
-		req.URL.RawQuery = q.Encode()
+	job := *runJob.Job
+	jobId := attempt.NomadJobID.String()
+	job.ID = &jobId
+	runJob.RunId = attempt.NomadJobID
+	runJob.Job = &job
+	if err := self.SaveJob(&runJob); err != nil {
+		return err
+	}
 
-		done, body, err := self.prometheus.Do(context.Background(), req)
-		if err != nil {
-			return output, errors.WithMessage(err, "Failed to talk with loki")
+	self.logger.Debug().
+		Str("id", attempt.NomadJobID.String()).
+		Str("retry-of", attempt.RetryOf.String()).
+		Int("attempt", attempt.Attempt).
+		Msg("Created retry attempt of Run")
+
+	// started later by StartDue
+	if attempt.StartAfter != nil {
+		return nil
+	}
+
+	return self.Schedule(attempt, action)
+}
+
+func (self *runService) Start(run *domain.Run) error {
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Starting Run")
+
+	runJob, err := self.runJobRepository.GetByRunId(run.NomadJobID)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select Run Job for Run with ID %q", run.NomadJobID)
+	}
+
+	executor, err := self.nomadClusters.Get(run.NomadCluster)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not start Run with ID %q", run.NomadJobID)
+	}
+
+	action, err := self.actionRepository.GetById(run.ActionId)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select Action for Run with ID %q", run.NomadJobID)
+	}
+	inputFactIds, err := self.runRepository.GetInputFactIdsByNomadJobId(run.NomadJobID)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select input fact IDs of Run with ID %q", run.NomadJobID)
+	}
+	if err := self.jobConfig.apply(runJob.Job, run, &action, inputFactIds); err != nil {
+		return errors.WithMessagef(err, "Could not add meta to job of Run with ID %q", run.NomadJobID)
+	}
+	if err := self.runJobRepository.UpdateJob(&runJob); err != nil {
+		return errors.WithMessagef(err, "Could not update Run Job for Run with ID %q", run.NomadJobID)
+	}
+
+	now := time.Now().UTC()
+	run.StartedAt = &now
+	if err := self.Update(run); err != nil {
+		return err
+	}
+
+	if response, _, err := executor.JobsRegister(runJob.Job, run.NomadWriteOptions()); err != nil {
+		return errors.WithMessage(err, "Failed to run Action")
+	} else if len(response.Warnings) > 0 {
+		self.logger.Warn().
+			Str("nomad-job", run.NomadJobID.String()).
+			Str("nomad-evaluation", response.EvalID).
+			Str("warnings", response.Warnings).
+			Msg("Warnings occured registering Nomad job")
+	}
+
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Started Run")
+	return nil
+}
+
+func (self *runService) End(run *domain.Run, output *domain.RunOutput) error {
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Ending Run")
+	if err := self.db.BeginFunc(context.Background(), func(tx pgx.Tx) error {
+		txSelf := self.WithQuerier(tx).(*runService)
+
+		if err := txSelf.runRepository.Update(run); err != nil {
+			return errors.WithMessagef(err, "Could not update Run with ID %q", run.NomadJobID)
+		}
+		if output != nil {
+			if err := txSelf.runOutputRepository.Update(run.NomadJobID, output); err != nil {
+				return errors.WithMessagef(err, "Could not update Run Output with ID %q", run.NomadJobID)
+			}
 		}
 
-		if done.StatusCode/100 != 2 {
-			return output, fmt.Errorf("Error response %d from Loki: %s", done.StatusCode, string(body))
+		// Only runs that were started took up a slot.
+		if run.StartedAt != nil {
+			if action, err := txSelf.actionRepository.GetById(run.ActionId); err != nil {
+				return errors.WithMessagef(err, "Could not select Action for Run with ID %q", run.NomadJobID)
+			} else if err := txSelf.startQueued(action.Name); err != nil {
+				return err
+			}
 		}
 
-		response := loghttp.QueryResponse{}
+		return nil
+	}); err != nil {
+		return err
+	}
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Ended Run")
+	return nil
+}
 
-		err = json.Unmarshal(body, &response)
-		if err != nil {
-			return output, err
-		}
+// Ends a run that never got a Nomad job without publishing its output.
+func (self *runService) endUnstarted(run *domain.Run) error {
+	output, err := self.runOutputRepository.GetByRunId(run.NomadJobID)
+	if err != nil {
+		return errors.WithMessagef(err, "Could not select Run Output with ID %q", run.NomadJobID)
+	}
+	output.Publish(domain.RunOutputPublishedNone, nil)
+	return self.End(run, &output)
+}
+
+func (self *runService) Cancel(run *domain.Run) error {
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Stopping Run")
+
+	reason := domain.RunEndReasonCanceled
+	run.EndReason = &reason
 
-		streams, ok := response.Data.Result.(loghttp.Streams)
-		if !ok {
-			return output, fmt.Errorf("Unexpected loki result type: %s", response.Data.Result.Type())
+	if run.Queued() {
+		now := time.Now().UTC()
+		run.FinishedAt = &now
+		if err := self.endUnstarted(run); err != nil {
+			return err
 		}
+		self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Stopped queued Run")
+		return nil
+	}
+
+	if err := self.Update(run); err != nil {
+		return err
+	}
 
-		if len(streams) == 0 {
-			return output, nil
+	// Nomad does not know whether the job simply ran to finish
+	// or was stopped manually. Mark output as published to avoid publishing it.
+	if output, err := self.runOutputRepository.GetByRunId(run.NomadJobID); err != nil && !pgxscan.NotFound(err) {
+		return errors.WithMessagef(err, "Could not select Run Output with ID %q", run.NomadJobID)
+	} else if err == nil && output.Published == nil {
+		output.Publish(domain.RunOutputPublishedNone, nil)
+		if err := self.runOutputRepository.Update(run.NomadJobID, &output); err != nil {
+			return errors.WithMessagef(err, "Could not update Run Output with ID %q", run.NomadJobID)
 		}
+	}
+	if err := self.deregister(run); err != nil {
+		return err
+	}
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Stopped Run")
+	return nil
+}
 
-		for _, stream := range streams {
-			source, ok := stream.Labels.Map()["source"]
+func (self *runService) TimeOut(run *domain.Run, output *domain.RunOutput) error {
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Timing out Run")
 
-			for _, entry := range stream.Entries {
-				if ok && source == "stderr" {
-					output.Stderr = append(output.Stderr, domain.LokiLine{Time: entry.Timestamp, Text: entry.Line})
-				} else {
-					output.Stdout = append(output.Stdout, domain.LokiLine{Time: entry.Timestamp, Text: entry.Line})
-				}
+	now := time.Now().UTC()
+	reason := domain.RunEndReasonTimedOut
+	run.FinishedAt = &now
+	run.EndReason = &reason
 
-				if (len(output.Stdout) + len(output.Stderr)) >= linesToFetch {
-					return output, nil
-				}
-			}
+	if err := self.End(run, output); err != nil {
+		return err
+	}
 
-			if int64(len(stream.Entries)) >= limit {
-				start = stream.Entries[len(stream.Entries)-1].Timestamp
-			} else if int64(len(stream.Entries)) < limit {
-				return output, nil
-			}
-		}
+	if err := self.deregister(run); err != nil {
+		return err
+	}
+
+	self.logger.Debug().Str("id", run.NomadJobID.String()).Msg("Timed out Run")
+	return nil
+}
+
+func (self *runService) deregister(run *domain.Run) error {
+	if executor, err := self.nomadClusters.Get(run.NomadCluster); err != nil {
+		return errors.WithMessagef(err, "Failed to deregister job %q", run.NomadJobID)
+	} else if _, _, err := executor.JobsDeregister(run.NomadJobID.String(), false, run.NomadWriteOptions()); err != nil {
+		return errors.WithMessagef(err, "Failed to deregister job %q", run.NomadJobID)
 	}
+	return nil
+}
+
+func (self *runService) Logs(run *domain.Run, query domain.LogQuery) (*domain.LogPage, error) {
+	return self.logProvider.Logs(run, query)
+}
+
+func (self *runService) AllLogs(run *domain.Run, query domain.LogQuery, fn func(domain.LogLine) error) error {
+	return self.logProvider.AllLogs(run, query, fn)
+}
+
+func (self *runService) RunLogs(run *domain.Run, allocId, taskGroup, taskName string) (*domain.LokiOutput, error) {
+	return self.logProvider.TaskLogs(run, allocId, taskGroup, taskName)
+}
+
+func (self *runService) TailLogs(ctx context.Context, run *domain.Run, taskName string, since time.Time, fn func(domain.LogLine) error) error {
+	return self.logProvider.TailLogs(ctx, run, taskName, since, fn)
 }
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pkg/errors"
+
+	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+)
+
+// What Cicero tells the jobs of runs about themselves and itself.
+type RunJobConfig struct {
+	// Where users reach Cicero's web UI.
+	WebUrl string
+	// Where jobs reach Cicero's API, defaults to WebUrl.
+	ApiUrl string
+	// Additional environment variables for every task.
+	Env map[string]string
+}
+
+// Environment variables that Cicero sets itself and that cannot be given as additional ones.
+var runJobBuiltinEnv = []string{
+	"CICERO_ACTION_NAME",
+	"CICERO_ACTION_ID",
+	"CICERO_RUN_ID",
+	"CICERO_WEB_URL",
+	"CICERO_API_URL",
+	"CICERO_RUN_API_URL",
+}
+
+// Returns an error if an additional environment variable is one that Cicero sets itself.
+func (self RunJobConfig) Validate() error {
+	for _, name := range runJobBuiltinEnv {
+		if _, exists := self.Env[name]; exists {
+			return errors.Errorf("Environment variable %q is set by Cicero itself", name)
+		}
+	}
+	return nil
+}
+
+func (self RunJobConfig) apiUrl() string {
+	if self.ApiUrl != "" {
+		return self.ApiUrl
+	}
+	return self.WebUrl
+}
+
+// Adds meta to the job and environment variables to all its tasks
+// so that they can identify themselves without templating.
+// Values that identify the run always replace those the job has,
+// which may be left over from an earlier attempt.
+// Other values that the job already sets are kept.
+func (self RunJobConfig) apply(job *nomad.Job, run *domain.Run, action *domain.Action, inputFactIds repository.RunInputFactIds) error {
+	inputs, err := json.Marshal(inputFactIds)
+	if err != nil {
+		return err
+	}
+
+	meta := map[string]string{}
+	if self.WebUrl != "" {
+		meta["cicero_url"] = self.WebUrl
+	}
+
+	runMeta := map[string]string{
+		"cicero_action_name": action.Name,
+		"cicero_action_id":   action.ID.String(),
+		"cicero_run_id":      run.NomadJobID.String(),
+		"cicero_inputs":      string(inputs),
+	}
+
+	if job.Meta == nil {
+		job.Meta = map[string]string{}
+	}
+	applyRunJobValues(job.Meta, meta, runMeta)
+
+	env := map[string]string{}
+	for k, v := range self.Env {
+		env[k] = v
+	}
+	if self.WebUrl != "" {
+		env["CICERO_WEB_URL"] = self.WebUrl
+	}
+	if apiUrl := self.apiUrl(); apiUrl != "" {
+		env["CICERO_API_URL"] = apiUrl
+	}
+
+	runEnv := map[string]string{
+		"CICERO_ACTION_NAME": action.Name,
+		"CICERO_ACTION_ID":   action.ID.String(),
+		"CICERO_RUN_ID":      run.NomadJobID.String(),
+	}
+	if apiUrl := self.apiUrl(); apiUrl != "" {
+		runEnv["CICERO_RUN_API_URL"] = strings.TrimSuffix(apiUrl, "/") + "/api/run/" + run.NomadJobID.String()
+	}
+
+	for _, group := range job.TaskGroups {
+		for _, task := range group.Tasks {
+			if task.Env == nil {
+				task.Env = map[string]string{}
+			}
+			applyRunJobValues(task.Env, env, runEnv)
+		}
+	}
+
+	return nil
+}
+
+// Adds the defaults unless already set and then sets the run's values.
+func applyRunJobValues(target, defaults, run map[string]string) {
+	for k, v := range defaults {
+		if _, exists := target[k]; !exists {
+			target[k] = v
+		}
+	}
+	for k, v := range run {
+		target[k] = v
+	}
+}
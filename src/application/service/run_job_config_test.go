@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+)
+
+func TestShouldAddMetaAndEnvToRunJob(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := RunJobConfig{
+		WebUrl: "https://cicero.example",
+		ApiUrl: "http://cicero.internal:8080/",
+		Env:    map[string]string{"CICERO_ENVIRONMENT": "test"},
+	}
+	action := domain.Action{ID: uuid.New(), Name: "build"}
+	run := domain.Run{NomadJobID: uuid.New(), ActionId: action.ID}
+	factId := uuid.New()
+
+	groupName := "build"
+	job := &nomad.Job{
+		Meta: map[string]string{"cicero_url": "kept"},
+		TaskGroups: []*nomad.TaskGroup{{
+			Name: &groupName,
+			Tasks: []*nomad.Task{
+				{Name: "build"},
+				{Name: "upload", Env: map[string]string{"CICERO_API_URL": "kept"}},
+			},
+		}},
+	}
+
+	// when
+	err := config.apply(job, &run, &action, repository.RunInputFactIds{"push": {factId}})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"cicero_action_name": "build",
+		"cicero_action_id":   action.ID.String(),
+		"cicero_run_id":      run.NomadJobID.String(),
+		"cicero_inputs":      `{"push":["` + factId.String() + `"]}`,
+		"cicero_url":         "kept",
+	}, job.Meta)
+
+	build := job.TaskGroups[0].Tasks[0].Env
+	assert.Equal(t, "https://cicero.example", build["CICERO_WEB_URL"])
+	assert.Equal(t, "http://cicero.internal:8080/", build["CICERO_API_URL"])
+	assert.Equal(t, "http://cicero.internal:8080/api/run/"+run.NomadJobID.String(), build["CICERO_RUN_API_URL"])
+	assert.Equal(t, run.NomadJobID.String(), build["CICERO_RUN_ID"])
+	assert.Equal(t, "test", build["CICERO_ENVIRONMENT"])
+
+	assert.Equal(t, "kept", job.TaskGroups[0].Tasks[1].Env["CICERO_API_URL"])
+}
+
+func TestShouldReplaceRunValuesOfEarlierAttempt(t *testing.T) {
+	t.Parallel()
+
+	// given
+	config := RunJobConfig{
+		WebUrl: "https://cicero.example",
+		Env:    map[string]string{"CICERO_ENVIRONMENT": "test"},
+	}
+	action := domain.Action{ID: uuid.New(), Name: "build"}
+	run := domain.Run{NomadJobID: uuid.New(), ActionId: action.ID}
+
+	earlier := domain.Run{NomadJobID: uuid.New(), ActionId: action.ID}
+	job := &nomad.Job{TaskGroups: []*nomad.TaskGroup{{Tasks: []*nomad.Task{{Name: "build"}}}}}
+	if err := config.apply(job, &earlier, &action, repository.RunInputFactIds{}); err != nil {
+		t.Fatal(err)
+	}
+	job.TaskGroups[0].Tasks[0].Env["CICERO_ENVIRONMENT"] = "kept"
+
+	// when
+	err := config.apply(job, &run, &action, repository.RunInputFactIds{})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, run.NomadJobID.String(), job.Meta["cicero_run_id"])
+
+	env := job.TaskGroups[0].Tasks[0].Env
+	assert.Equal(t, run.NomadJobID.String(), env["CICERO_RUN_ID"])
+	assert.Equal(t, "https://cicero.example/api/run/"+run.NomadJobID.String(), env["CICERO_RUN_API_URL"])
+	assert.Equal(t, "kept", env["CICERO_ENVIRONMENT"])
+}
+
+func TestShouldRejectBuiltinJobEnv(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, RunJobConfig{Env: map[string]string{"CICERO_ENVIRONMENT": "test"}}.Validate())
+	assert.Error(t, RunJobConfig{Env: map[string]string{"CICERO_RUN_ID": "fake"}}.Validate())
+	assert.Error(t, RunJobConfig{Env: map[string]string{"CICERO_API_URL": "http://elsewhere"}}.Validate())
+}
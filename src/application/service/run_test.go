@@ -0,0 +1,481 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pashagolub/pgxmock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/application"
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+)
+
+// Runs shared by the repositories of concurrent transactions.
+type fakeRunStore struct {
+	mutex sync.Mutex
+	runs  []*domain.Run
+
+	// like the advisory lock of the database
+	actionLock sync.Mutex
+}
+
+// One per transaction. Calling methods that are not overridden panics.
+type fakeRunRepository struct {
+	repository.RunRepository
+
+	store  *fakeRunStore
+	locked bool
+
+	inputFactIds repository.RunInputFactIds
+	saved        []*domain.Run
+	savedInputs  []map[string]interface{}
+}
+
+func (self *fakeRunRepository) WithQuerier(config.PgxIface) repository.RunRepository {
+	return self
+}
+
+func (self *fakeRunRepository) LockByActionName(string) error {
+	if !self.locked {
+		self.store.actionLock.Lock()
+		self.locked = true
+	}
+	return nil
+}
+
+// Releases the lock like the end of the transaction.
+func (self *fakeRunRepository) commit() {
+	if self.locked {
+		self.store.actionLock.Unlock()
+		self.locked = false
+	}
+}
+
+func (self *fakeRunRepository) selectRuns(filter func(*domain.Run) bool) ([]*domain.Run, error) {
+	if !self.locked {
+		return nil, errors.New("Runs were counted without holding the lock")
+	}
+
+	self.store.mutex.Lock()
+	runs := []*domain.Run{}
+	for _, run := range self.store.runs {
+		if filter(run) {
+			runs = append(runs, run)
+		}
+	}
+	self.store.mutex.Unlock()
+
+	// give concurrent transactions a chance to interfere
+	time.Sleep(10 * time.Millisecond)
+
+	return runs, nil
+}
+
+func (self *fakeRunRepository) GetRunningByActionName(string) ([]*domain.Run, error) {
+	return self.selectRuns(func(run *domain.Run) bool {
+		return run.StartedAt != nil && run.FinishedAt == nil
+	})
+}
+
+func (self *fakeRunRepository) GetQueuedByActionName(string) ([]*domain.Run, error) {
+	return self.selectRuns(func(run *domain.Run) bool {
+		return run.StartedAt == nil && run.FinishedAt == nil
+	})
+}
+
+func (self *fakeRunRepository) GetInputFactIdsByNomadJobId(uuid.UUID) (repository.RunInputFactIds, error) {
+	if self.inputFactIds != nil {
+		return self.inputFactIds, nil
+	}
+	return repository.RunInputFactIds{}, nil
+}
+
+func (self *fakeRunRepository) Save(run *domain.Run, inputs map[string]interface{}) error {
+	if run.NomadJobID == uuid.Nil {
+		run.NomadJobID = uuid.New()
+	}
+	self.saved = append(self.saved, run)
+	self.savedInputs = append(self.savedInputs, inputs)
+
+	if self.store != nil {
+		self.store.mutex.Lock()
+		self.store.runs = append(self.store.runs, run)
+		self.store.mutex.Unlock()
+	}
+	return nil
+}
+
+func (self *fakeRunRepository) Update(*domain.Run) error {
+	return nil
+}
+
+type fakeRunJobRepository struct {
+	repository.RunJobRepository
+
+	job     *nomad.Job
+	saved   []domain.RunJob
+	mutex   sync.Mutex
+	updated []domain.RunJob
+}
+
+func (self *fakeRunJobRepository) WithQuerier(config.PgxIface) repository.RunJobRepository {
+	return self
+}
+
+func (self *fakeRunJobRepository) GetByRunId(id uuid.UUID) (domain.RunJob, error) {
+	if self.job != nil {
+		return domain.RunJob{RunId: id, Job: self.job}, nil
+	}
+	return domain.RunJob{RunId: id, Job: &nomad.Job{}}, nil
+}
+
+func (self *fakeRunJobRepository) Save(runJob *domain.RunJob) error {
+	self.saved = append(self.saved, *runJob)
+	return nil
+}
+
+func (self *fakeRunJobRepository) UpdateJob(runJob *domain.RunJob) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.updated = append(self.updated, *runJob)
+	return nil
+}
+
+type fakeRunOutputRepository struct {
+	repository.RunOutputRepository
+
+	output domain.RunOutput
+	saved  []domain.RunOutput
+}
+
+func (self *fakeRunOutputRepository) WithQuerier(config.PgxIface) repository.RunOutputRepository {
+	return self
+}
+
+func (self *fakeRunOutputRepository) GetByRunId(uuid.UUID) (domain.RunOutput, error) {
+	return self.output, nil
+}
+
+func (self *fakeRunOutputRepository) Save(_ uuid.UUID, output *domain.RunOutput) error {
+	self.saved = append(self.saved, *output)
+	return nil
+}
+
+type fakeActionRepository struct {
+	repository.ActionRepository
+
+	action domain.Action
+}
+
+func (self fakeActionRepository) WithQuerier(config.PgxIface) repository.ActionRepository {
+	return self
+}
+
+func (self fakeActionRepository) GetById(uuid.UUID) (domain.Action, error) {
+	return self.action, nil
+}
+
+func (self fakeActionRepository) GetLatestByName(string) (domain.Action, error) {
+	return self.action, nil
+}
+
+type fakeRunExecutor struct {
+	application.Executor
+
+	mutex      sync.Mutex
+	registered []string
+}
+
+func (self *fakeRunExecutor) JobsRegister(job *nomad.Job, _ *nomad.WriteOptions) (*nomad.JobRegisterResponse, *nomad.WriteMeta, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.registered = append(self.registered, job.Meta["cicero_run_id"])
+	return &nomad.JobRegisterResponse{}, nil, nil
+}
+
+func TestShouldNotExceedConcurrencyLimitWithConcurrentSchedules(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := domain.Action{ID: uuid.New(), Name: "test"}
+	action.Meta = map[string]interface{}{"concurrency": map[string]interface{}{"limit": 1}}
+
+	store := &fakeRunStore{}
+	for i := 0; i < 2; i++ {
+		store.runs = append(store.runs, &domain.Run{
+			NomadJobID: uuid.New(),
+			ActionId:   action.ID,
+			CreatedAt:  time.Now().Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	executor := &fakeRunExecutor{}
+
+	// when
+	var wg sync.WaitGroup
+	errs := make([]error, len(store.runs))
+	for i, run := range store.runs {
+		wg.Add(1)
+		go func(i int, run *domain.Run) {
+			defer wg.Done()
+
+			runRepository := &fakeRunRepository{store: store}
+			defer runRepository.commit()
+
+			runService := &runService{
+				logger:           zerolog.Nop(),
+				runRepository:    runRepository,
+				runJobRepository: &fakeRunJobRepository{},
+				actionRepository: fakeActionRepository{action: action},
+				nomadClusters:    application.NomadClusters{{Executor: executor}},
+			}
+			errs[i] = runService.Schedule(run, &action)
+		}(i, run)
+	}
+	wg.Wait()
+
+	// then
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{store.runs[0].NomadJobID.String()}, executor.registered)
+	assert.NotNil(t, store.runs[0].StartedAt)
+	assert.Nil(t, store.runs[1].StartedAt)
+}
+
+func TestShouldStoreJobWithMetaWhenStartingRun(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := domain.Action{ID: uuid.New(), Name: "test"}
+	run := &domain.Run{NomadJobID: uuid.New(), ActionId: action.ID}
+
+	runJobRepository := &fakeRunJobRepository{job: &nomad.Job{Meta: map[string]string{"cicero_run_id": uuid.NewString()}}}
+	executor := &fakeRunExecutor{}
+
+	runService := &runService{
+		logger:           zerolog.Nop(),
+		runRepository:    &fakeRunRepository{store: &fakeRunStore{}},
+		runJobRepository: runJobRepository,
+		actionRepository: fakeActionRepository{action: action},
+		nomadClusters:    application.NomadClusters{{Executor: executor}},
+	}
+
+	// when
+	err := runService.Start(run)
+
+	// then
+	assert.NoError(t, err)
+	assert.NotNil(t, run.StartedAt)
+	if assert.Len(t, runJobRepository.updated, 1) {
+		assert.Equal(t, run.NomadJobID, runJobRepository.updated[0].RunId)
+		assert.Equal(t, run.NomadJobID.String(), runJobRepository.updated[0].Job.Meta["cicero_run_id"])
+	}
+	assert.Equal(t, []string{run.NomadJobID.String()}, executor.registered)
+}
+
+func TestShouldRetryRunWithCopiedAttempt(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := domain.Action{ID: uuid.New(), Name: "test"}
+	action.Meta = map[string]interface{}{"retry": map[string]interface{}{"max_attempts": 3, "backoff": "1m"}}
+
+	retryOf := uuid.New()
+	namespace, region := "builds", "eu"
+	run := &domain.Run{
+		NomadJobID:     uuid.New(),
+		ActionId:       action.ID,
+		RetryOf:        &retryOf,
+		Attempt:        2,
+		NomadCluster:   "ci",
+		NomadNamespace: &namespace,
+		NomadRegion:    &region,
+	}
+
+	inputFactId := uuid.New()
+	runRepository := &fakeRunRepository{inputFactIds: repository.RunInputFactIds{"input": {inputFactId}}}
+	success := interface{}(map[string]interface{}{"ok": true})
+	runOutputRepository := &fakeRunOutputRepository{output: domain.RunOutput{Success: &success}}
+	jobId := run.NomadJobID.String()
+	runJobRepository := &fakeRunJobRepository{job: &nomad.Job{ID: &jobId}}
+
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectBegin()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectCommit()
+
+	runService := &runService{
+		logger:              zerolog.Nop(),
+		runRepository:       runRepository,
+		runOutputRepository: runOutputRepository,
+		runJobRepository:    runJobRepository,
+		actionRepository:    fakeActionRepository{action: action},
+		db:                  mock,
+	}
+
+	// when
+	before := time.Now().UTC()
+	attempt, err := runService.NextAttempt(run, []int{1}, false)
+	if err != nil || attempt == nil {
+		t.Fatal("expected an attempt", err)
+	}
+	err = runService.Retry(run, attempt)
+
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, action.ID, attempt.ActionId)
+	assert.Equal(t, &retryOf, attempt.RetryOf)
+	assert.Equal(t, 3, attempt.Attempt)
+	assert.Equal(t, run.NomadCluster, attempt.NomadCluster)
+	assert.Equal(t, run.NomadNamespace, attempt.NomadNamespace)
+	assert.Equal(t, run.NomadRegion, attempt.NomadRegion)
+	if assert.NotNil(t, attempt.StartAfter) {
+		assert.WithinDuration(t, before.Add(2*time.Minute), *attempt.StartAfter, time.Minute)
+	}
+
+	if assert.Len(t, runRepository.saved, 1) {
+		assert.Same(t, attempt, runRepository.saved[0])
+		assert.Equal(t, map[string]interface{}{"input": []*domain.Fact{{ID: inputFactId}}}, runRepository.savedInputs[0])
+	}
+	if assert.Len(t, runOutputRepository.saved, 1) {
+		assert.Equal(t, &success, runOutputRepository.saved[0].Success)
+		assert.Nil(t, runOutputRepository.saved[0].Published)
+	}
+	if assert.Len(t, runJobRepository.saved, 1) {
+		assert.Equal(t, attempt.NomadJobID, runJobRepository.saved[0].RunId)
+		assert.Equal(t, attempt.NomadJobID.String(), *runJobRepository.saved[0].Job.ID)
+	}
+	assert.Equal(t, run.NomadJobID.String(), *runJobRepository.job.ID, "the job of the retried run should not change")
+}
+
+func TestShouldNotRetryRunAfterMaxAttempts(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := domain.Action{ID: uuid.New(), Name: "test"}
+	action.Meta = map[string]interface{}{"retry": map[string]interface{}{"max_attempts": 2}}
+	run := &domain.Run{NomadJobID: uuid.New(), ActionId: action.ID, Attempt: 2}
+
+	runService := &runService{
+		logger:           zerolog.Nop(),
+		actionRepository: fakeActionRepository{action: action},
+	}
+
+	// when
+	attempt, err := runService.NextAttempt(run, []int{1}, false)
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, attempt)
+}
+
+func TestShouldNotRetryRunWithInvalidRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := domain.Action{ID: uuid.New(), Name: "test"}
+	action.Meta = map[string]interface{}{"retry": map[string]interface{}{"max_attempts": 3, "backoff": "x"}}
+	run := &domain.Run{NomadJobID: uuid.New(), ActionId: action.ID, Attempt: 1}
+
+	runService := &runService{
+		logger:           zerolog.Nop(),
+		actionRepository: fakeActionRepository{action: action},
+	}
+
+	// when
+	attempt, err := runService.NextAttempt(run, []int{1}, false)
+
+	// then
+	assert.NoError(t, err, "an invalid policy must not keep the run from ending")
+	assert.Nil(t, attempt)
+}
+
+func TestShouldStartRetryOfEndedRunWithinConcurrencyLimit(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []domain.ActionConcurrencyPolicy{
+		domain.ActionConcurrencyPolicyQueue,
+		domain.ActionConcurrencyPolicySkip,
+		domain.ActionConcurrencyPolicyCancelOldest,
+	} {
+		policy := policy
+		t.Run(string(policy), func(t *testing.T) {
+			t.Parallel()
+
+			// given
+			action := domain.Action{ID: uuid.New(), Name: "test"}
+			action.Meta = map[string]interface{}{
+				"concurrency": map[string]interface{}{"limit": 1, "policy": policy},
+				"retry":       map[string]interface{}{"max_attempts": 2},
+			}
+
+			// already ended by the caller of Retry
+			startedAt := time.Now().Add(-time.Minute)
+			finishedAt := time.Now()
+			run := &domain.Run{
+				NomadJobID: uuid.New(),
+				ActionId:   action.ID,
+				Attempt:    1,
+				CreatedAt:  startedAt,
+				StartedAt:  &startedAt,
+				FinishedAt: &finishedAt,
+			}
+			store := &fakeRunStore{runs: []*domain.Run{run}}
+
+			runRepository := &fakeRunRepository{store: store}
+			defer runRepository.commit()
+
+			mock, err := pgxmock.NewConn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			mock.ExpectBegin()
+			mock.ExpectBegin()
+			mock.ExpectCommit()
+			mock.ExpectCommit()
+
+			executor := &fakeRunExecutor{}
+			runService := &runService{
+				logger:              zerolog.Nop(),
+				runRepository:       runRepository,
+				runOutputRepository: &fakeRunOutputRepository{},
+				runJobRepository:    &fakeRunJobRepository{},
+				actionRepository:    fakeActionRepository{action: action},
+				nomadClusters:       application.NomadClusters{{Executor: executor}},
+				db:                  mock,
+			}
+
+			// when
+			attempt, err := runService.NextAttempt(run, []int{1}, false)
+			if err != nil || attempt == nil {
+				t.Fatal("expected an attempt", err)
+			}
+			err = runService.Retry(run, attempt)
+
+			// then
+			assert.NoError(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			assert.Equal(t, []string{attempt.NomadJobID.String()}, executor.registered)
+			assert.NotNil(t, attempt.StartedAt)
+			assert.Nil(t, attempt.EndReason, "the attempt should not be skipped")
+			assert.Nil(t, run.EndReason, "the retried run should not be canceled")
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+type TransformerKind string
+
+const (
+	TransformerKindExec      TransformerKind = "exec"
+	TransformerKindCue       TransformerKind = "cue"
+	TransformerKindJsonPatch TransformerKind = "jsonpatch"
+)
+
+// Describes a transformer given on the command line.
+type TransformerInfo struct {
+	Path string          `json:"path"`
+	Kind TransformerKind `json:"kind"`
+	// The contents of the file, empty for executables.
+	Source string `json:"source,omitempty"`
+}
+
+// The result of a transformer applied to a run definition.
+type TransformStep struct {
+	Transformer TransformerInfo     `json:"transformer"`
+	Before      json.RawMessage     `json:"before"`
+	After       json.RawMessage     `json:"after"`
+	Changes     []domain.JsonChange `json:"changes"`
+}
+
+// What a transformer knows about the run it transforms.
+type transformContext struct {
+	name   string
+	id     uuid.UUID
+	inputs json.RawMessage
+}
+
+func (self transformContext) env() []string {
+	return []string{
+		"CICERO_ACTION_NAME=" + self.name,
+		"CICERO_ACTION_ID=" + self.id.String(),
+		"CICERO_ACTION_INPUTS=" + string(self.inputs),
+	}
+}
+
+// Modifies the JSON output of evaluators for runs.
+type transformer interface {
+	info() TransformerInfo
+	transform(processes evaluationProcesses, def []byte, ctx transformContext) ([]byte, error)
+}
+
+// Parses transformers by file extension:
+// `.cue` files are unified with the run definition,
+// `.json` files are applied as JSON patches (RFC 6902),
+// and anything else is run as an executable that reads
+// the run definition on stdin and writes the result to stdout.
+func parseTransformers(paths []string, logger zerolog.Logger) ([]transformer, error) {
+	transformers := make([]transformer, len(paths))
+	for i, path := range paths {
+		var err error
+		switch filepath.Ext(path) {
+		case ".cue":
+			transformers[i], err = parseCueTransformer(path)
+		case ".json":
+			transformers[i], err = parseJsonPatchTransformer(path)
+		default:
+			transformers[i], err = parseExecTransformer(path, logger)
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "Invalid transformer %q", path)
+		}
+	}
+	return transformers, nil
+}
+
+type execTransformer struct {
+	path   string
+	logger zerolog.Logger
+}
+
+func parseExecTransformer(path string, logger zerolog.Logger) (execTransformer, error) {
+	_, err := exec.LookPath(path)
+	return execTransformer{path: path, logger: logger}, err
+}
+
+func (self execTransformer) info() TransformerInfo {
+	return TransformerInfo{Path: self.path, Kind: TransformerKindExec}
+}
+
+func (self execTransformer) transform(processes evaluationProcesses, def []byte, ctx transformContext) ([]byte, error) {
+	extraEnv := ctx.env()
+
+	cmd := processes.command(extraEnv, nil, self.path)
+	cmd.Stdin = bytes.NewReader(def)
+
+	self.logger.Debug().
+		Strs("command", cmd.Args).
+		Strs("environment", extraEnv).
+		Str("transformer", self.path).
+		Msg("Running transformer")
+
+	if output, err := processes.output(cmd); err != nil {
+		message := "Failed to transform"
+
+		var errExit *exec.ExitError
+		if errors.As(err, &errExit) {
+			message += fmt.Sprintf("\nStdout: %s\nStderr: %s", output, errExit.Stderr)
+			err = EvaluationError{err: errors.WithMessage(err, message)}
+		}
+
+		return nil, err
+	} else {
+		return output, nil
+	}
+}
+
+// Unified with the run definition. Can refer to the definitions
+// `#name`, `#id`, `#inputs` like CUE actions, and `#env`
+// that holds the environment variables passed to transformers.
+type cueTransformer struct {
+	path   string
+	source string
+}
+
+func parseCueTransformer(path string) (cueTransformer, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return cueTransformer{}, err
+	}
+
+	self := cueTransformer{path: path, source: string(source)}
+	if value := self.compile(); value.Err() != nil {
+		return self, cueEvaluationError(filepath.Dir(path), value.Err())
+	}
+
+	return self, nil
+}
+
+func (self cueTransformer) compile() cue.Value {
+	return cuecontext.New().CompileString(self.source, cue.Filename(self.path))
+}
+
+func (self cueTransformer) info() TransformerInfo {
+	return TransformerInfo{Path: self.path, Kind: TransformerKindCue, Source: self.source}
+}
+
+func (self cueTransformer) transform(processes evaluationProcesses, def []byte, ctx transformContext) ([]byte, error) {
+	value := self.compile()
+	dir := filepath.Dir(self.path)
+
+	env := map[string]string{}
+	for _, kv := range processes.environ() {
+		kv := strings.SplitN(kv, "=", 2)
+		env[kv[0]] = kv[1]
+	}
+
+	value = value.
+		FillPath(cue.MakePath(cue.Def("#name")), ctx.name).
+		FillPath(cue.MakePath(cue.Def("#id")), ctx.id.String()).
+		FillPath(cue.MakePath(cue.Def("#env")), env)
+	if ctx.inputs != nil {
+		value = value.FillPath(cue.MakePath(cue.Def("#inputs")), value.Context().CompileBytes(ctx.inputs))
+	}
+
+	defValue := value.Context().CompileBytes(def)
+	if defValue.Err() != nil {
+		return nil, errors.WithMessage(defValue.Err(), "Could not compile run definition")
+	}
+
+	value = value.Unify(defValue)
+	if err := value.Validate(cue.Concrete(true)); err != nil {
+		return nil, cueEvaluationError(dir, err)
+	}
+
+	if output, err := value.MarshalJSON(); err != nil {
+		return nil, cueEvaluationError(dir, err)
+	} else {
+		return output, nil
+	}
+}
+
+type jsonPatchTransformer struct {
+	path   string
+	source string
+	patch  jsonPatch
+}
+
+func parseJsonPatchTransformer(path string) (jsonPatchTransformer, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return jsonPatchTransformer{}, err
+	}
+
+	patch, err := parseJsonPatch(source)
+	return jsonPatchTransformer{path: path, source: string(source), patch: patch}, err
+}
+
+func (self jsonPatchTransformer) info() TransformerInfo {
+	return TransformerInfo{Path: self.path, Kind: TransformerKindJsonPatch, Source: self.source}
+}
+
+func (self jsonPatchTransformer) transform(_ evaluationProcesses, def []byte, _ transformContext) ([]byte, error) {
+	if output, err := self.patch.apply(def); err != nil {
+		return nil, EvaluationError{err: errors.WithMessage(err, "Failed to apply JSON patch")}
+	} else {
+		return output, nil
+	}
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// An operation of a JSON patch as per RFC 6902.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type jsonPatch []jsonPatchOperation
+
+func parseJsonPatch(data []byte) (jsonPatch, error) {
+	var patch jsonPatch
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+
+	for i, op := range patch {
+		if _, err := parseJsonPointer(op.Path); err != nil {
+			return nil, errors.WithMessagef(err, "Invalid path in operation %d", i)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("Operation %d (%s) has no value", i, op.Op)
+			}
+		case "move", "copy":
+			if _, err := parseJsonPointer(op.From); err != nil {
+				return nil, errors.WithMessagef(err, "Invalid from in operation %d", i)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("Operation %d has unknown op %q", i, op.Op)
+		}
+	}
+
+	return patch, nil
+}
+
+// Applies the patch to a JSON document.
+// Either all operations are applied or none.
+func (patch jsonPatch) apply(doc []byte) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal(doc, &value); err != nil {
+		return nil, err
+	}
+
+	for i, op := range patch {
+		var err error
+		if value, err = op.apply(value); err != nil {
+			return nil, errors.WithMessagef(err, "Operation %d (%s %s) failed", i, op.Op, op.Path)
+		}
+	}
+
+	return json.Marshal(value)
+}
+
+func (op jsonPatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := parseJsonPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if op.Value != nil {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return jsonPointerAdd(doc, path, value)
+	case "remove":
+		doc, _, err := jsonPointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		if doc, _, err := jsonPointerRemove(doc, path); err != nil {
+			return nil, err
+		} else {
+			return jsonPointerAdd(doc, path, value)
+		}
+	case "move", "copy":
+		from, err := parseJsonPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, fmt.Errorf("Cannot move %q into itself", op.From)
+			}
+			if doc, value, err = jsonPointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else if value, err = jsonPointerGet(doc, from); err != nil {
+			return nil, err
+		} else if value, err = jsonDeepCopy(value); err != nil {
+			return nil, err
+		}
+
+		return jsonPointerAdd(doc, path, value)
+	case "test":
+		if actual, err := jsonPointerGet(doc, path); err != nil {
+			return nil, err
+		} else if !reflect.DeepEqual(actual, value) {
+			if actualJson, err := json.Marshal(actual); err != nil {
+				return nil, errors.WithMessage(err, "Test failed and could not marshal actual value")
+			} else {
+				return nil, fmt.Errorf("Test failed, value is %s", actualJson)
+			}
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("Unknown op %q", op.Op)
+	}
+}
+
+func parseJsonPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %q does not start with a slash", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch typed := doc.(type) {
+		case map[string]interface{}:
+			if value, exists := typed[token]; !exists {
+				return nil, fmt.Errorf("Key %q does not exist", token)
+			} else {
+				doc = value
+			}
+		case []interface{}:
+			if i, err := jsonArrayIndex(token, len(typed)-1); err != nil {
+				return nil, err
+			} else {
+				doc = typed[i]
+			}
+		default:
+			return nil, fmt.Errorf("Cannot index %T with %q", doc, token)
+		}
+	}
+	return doc, nil
+}
+
+// Calls `fn` with the container at the parent of the path
+// and the path's last token and replaces that container with its result.
+func jsonPointerUpdate(doc interface{}, path []string, fn func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := jsonPointerGet(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	if child, err = jsonPointerUpdate(child, path[1:], fn); err != nil {
+		return nil, err
+	}
+
+	switch typed := doc.(type) {
+	case map[string]interface{}:
+		typed[path[0]] = child
+	case []interface{}:
+		i, _ := jsonArrayIndex(path[0], len(typed)-1)
+		typed[i] = child
+	}
+	return doc, nil
+}
+
+func jsonPointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return jsonPointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch typed := container.(type) {
+		case map[string]interface{}:
+			typed[token] = value
+			return typed, nil
+		case []interface{}:
+			i := len(typed)
+			if token != "-" {
+				var err error
+				if i, err = jsonArrayIndex(token, len(typed)); err != nil {
+					return nil, err
+				}
+			}
+			typed = append(typed, nil)
+			copy(typed[i+1:], typed[i:])
+			typed[i] = value
+			return typed, nil
+		default:
+			return nil, fmt.Errorf("Cannot add %q to %T", token, container)
+		}
+	})
+}
+
+// Returns the document without the value at the path and that value.
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("Cannot remove the whole document")
+	}
+
+	var removed interface{}
+	doc, err := jsonPointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch typed := container.(type) {
+		case map[string]interface{}:
+			value, exists := typed[token]
+			if !exists {
+				return nil, fmt.Errorf("Key %q does not exist", token)
+			}
+			removed = value
+			delete(typed, token)
+			return typed, nil
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(typed)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = typed[i]
+			return append(typed[:i], typed[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("Cannot remove %q from %T", token, container)
+		}
+	})
+	return doc, removed, err
+}
+
+func jsonArrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("Invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("Invalid array index %q", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("Array index %d out of bounds", i)
+	}
+	return i, nil
+}
+
+func jsonDeepCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
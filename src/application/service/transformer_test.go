@@ -0,0 +1,114 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldApplyJsonPatch(t *testing.T) {
+	t.Parallel()
+
+	// given
+	patch, err := parseJsonPatch([]byte(`[
+		{"op": "add", "path": "/job/a~1b/datacenters/-", "value": "dc1"},
+		{"op": "replace", "path": "/output/success", "value": {"ok": true}},
+		{"op": "copy", "from": "/job/a~1b/datacenters/0", "path": "/job/a~1b/datacenters/0"},
+		{"op": "move", "from": "/output/failure", "path": "/output/error"},
+		{"op": "remove", "path": "/job/a~1b/type"},
+		{"op": "test", "path": "/job/a~1b/datacenters", "value": ["dc0", "dc0", "dc1"]}
+	]`))
+	assert.NoError(t, err)
+
+	// when
+	output, err := patch.apply([]byte(`{
+		"output": {"success": null, "failure": 1},
+		"job": {"a/b": {"datacenters": ["dc0"], "type": "batch"}}
+	}`))
+
+	// then
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"output": {"success": {"ok": true}, "error": 1},
+		"job": {"a/b": {"datacenters": ["dc0", "dc0", "dc1"]}}
+	}`, string(output))
+}
+
+func TestShouldFailJsonPatchTest(t *testing.T) {
+	t.Parallel()
+
+	// given
+	patch, err := parseJsonPatch([]byte(`[{"op": "test", "path": "/a", "value": 2}]`))
+	assert.NoError(t, err)
+
+	// when
+	_, err = patch.apply([]byte(`{"a": 1}`))
+
+	// then
+	assert.Error(t, err)
+}
+
+func TestShouldRejectInvalidJsonPatch(t *testing.T) {
+	t.Parallel()
+
+	for _, patch := range []string{
+		`{"op": "add"}`,
+		`[{"op": "frobnicate", "path": "/a"}]`,
+		`[{"op": "add", "path": "a", "value": 1}]`,
+		`[{"op": "replace", "path": "/a"}]`,
+	} {
+		_, err := parseJsonPatch([]byte(patch))
+		assert.Error(t, err, patch)
+	}
+}
+
+func TestShouldUnifyCueTransformer(t *testing.T) {
+	t.Parallel()
+
+	// given
+	path := filepath.Join(t.TempDir(), "transformer.cue")
+	if err := os.WriteFile(path, []byte(`
+		#name: string
+		job: [string]: {
+			datacenters: ["dc1"]
+			meta: action: #name
+		}
+	`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	transformer, err := parseCueTransformer(path)
+	assert.NoError(t, err)
+
+	// when
+	output, err := transformer.transform(evaluationProcesses{}, []byte(`{"output": {}, "job": {"foo": {"type": "batch"}}}`), transformContext{
+		name: "test",
+		id:   uuid.New(),
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"output": {},
+		"job": {"foo": {"type": "batch", "datacenters": ["dc1"], "meta": {"action": "test"}}}
+	}`, string(output))
+}
+
+func TestShouldRejectInvalidCueTransformer(t *testing.T) {
+	t.Parallel()
+
+	// given
+	path := filepath.Join(t.TempDir(), "transformer.cue")
+	if err := os.WriteFile(path, []byte(`job: {`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	_, err := parseTransformers([]string{path}, zerolog.Nop())
+
+	// then
+	assert.Error(t, err)
+}
@@ -1,10 +1,81 @@
 package config
 
-import nomad "github.com/hashicorp/nomad/api"
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 
-func NewNomadClient() (client *nomad.Client, err error) {
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pkg/errors"
+)
+
+// Creates a client for the Nomad cluster at the given address.
+// Everything else, as well as the address if empty, is read from the `NOMAD_*` environment variables.
+func NewNomadClient(address string) (client *nomad.Client, err error) {
 	config := nomad.DefaultConfig()
+	if address != "" {
+		config.Address = address
+	}
 	//TODO: log configuration
 	client, err = nomad.NewClient(config)
 	return
 }
+
+// Creates a client for the named Nomad cluster at the given address.
+// Like NewNomadClient but `CICERO_NOMAD_<NAME>_*` environment variables
+// take precedence over their `NOMAD_*` counterparts so that each cluster
+// can have its own token, namespace, region and TLS settings.
+func NewNomadClusterClient(name, address string) (*nomad.Client, error) {
+	config := nomad.DefaultConfig()
+	config.Address = address
+
+	if err := configureNomadCluster(config, NomadClusterEnvPrefix(name)); err != nil {
+		return nil, err
+	}
+
+	return nomad.NewClient(config)
+}
+
+var nomadClusterEnvInvalid = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// Returns the prefix of the environment variables for the named cluster,
+// for example `CICERO_NOMAD_CI_EU_` for the cluster `ci-eu`.
+func NomadClusterEnvPrefix(name string) string {
+	return "CICERO_NOMAD_" + nomadClusterEnvInvalid.ReplaceAllString(strings.ToUpper(name), "_") + "_"
+}
+
+func configureNomadCluster(config *nomad.Config, prefix string) error {
+	if v := os.Getenv(prefix + "TOKEN"); v != "" {
+		config.SecretID = v
+	}
+	if v := os.Getenv(prefix + "NAMESPACE"); v != "" {
+		config.Namespace = v
+	}
+	if v := os.Getenv(prefix + "REGION"); v != "" {
+		config.Region = v
+	}
+	if v := os.Getenv(prefix + "CACERT"); v != "" {
+		config.TLSConfig.CACert = v
+	}
+	if v := os.Getenv(prefix + "CAPATH"); v != "" {
+		config.TLSConfig.CAPath = v
+	}
+	if v := os.Getenv(prefix + "CLIENT_CERT"); v != "" {
+		config.TLSConfig.ClientCert = v
+	}
+	if v := os.Getenv(prefix + "CLIENT_KEY"); v != "" {
+		config.TLSConfig.ClientKey = v
+	}
+	if v := os.Getenv(prefix + "TLS_SERVER_NAME"); v != "" {
+		config.TLSConfig.TLSServerName = v
+	}
+	if v := os.Getenv(prefix + "SKIP_VERIFY"); v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.WithMessagef(err, "Invalid %sSKIP_VERIFY", prefix)
+		}
+		config.TLSConfig.Insecure = insecure
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldPrefixNomadClusterEnv(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "CICERO_NOMAD_CI_", NomadClusterEnvPrefix("ci"))
+	assert.Equal(t, "CICERO_NOMAD_CI_EU_1_", NomadClusterEnvPrefix("ci-eu.1"))
+}
+
+func TestShouldConfigureNomadClusterByEnv(t *testing.T) {
+	// given
+	t.Setenv("NOMAD_TOKEN", "shared")
+	t.Setenv("NOMAD_NAMESPACE", "shared")
+	t.Setenv("CICERO_NOMAD_DEPLOY_TOKEN", "deploy")
+	t.Setenv("CICERO_NOMAD_DEPLOY_CACERT", "/etc/deploy-ca.pem")
+	t.Setenv("CICERO_NOMAD_DEPLOY_SKIP_VERIFY", "true")
+
+	ci := nomad.DefaultConfig()
+	deploy := nomad.DefaultConfig()
+
+	// when
+	errCi := configureNomadCluster(ci, NomadClusterEnvPrefix("ci"))
+	errDeploy := configureNomadCluster(deploy, NomadClusterEnvPrefix("deploy"))
+
+	// then
+	assert.NoError(t, errCi)
+	assert.Equal(t, "shared", ci.SecretID)
+	assert.Equal(t, "shared", ci.Namespace)
+	assert.Empty(t, ci.TLSConfig.CACert)
+	assert.False(t, ci.TLSConfig.Insecure)
+
+	assert.NoError(t, errDeploy)
+	assert.Equal(t, "deploy", deploy.SecretID)
+	assert.Equal(t, "shared", deploy.Namespace)
+	assert.Equal(t, "/etc/deploy-ca.pem", deploy.TLSConfig.CACert)
+	assert.True(t, deploy.TLSConfig.Insecure)
+}
+
+func TestShouldRejectInvalidNomadClusterSkipVerify(t *testing.T) {
+	// given
+	t.Setenv("CICERO_NOMAD_CI_SKIP_VERIFY", "maybe")
+
+	// when
+	_, err := NewNomadClusterClient("ci", "https://nomad.ci.example:4646")
+
+	// then
+	assert.Error(t, err)
+}
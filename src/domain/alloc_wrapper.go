@@ -11,6 +11,37 @@ type LokiLine struct {
 	Text string
 }
 
+// A line of a task's log as it is streamed.
+type LogLine struct {
+	LokiLine
+	// Either stdout or stderr.
+	Source  string
+	AllocId string
+	Task    string
+}
+
+// Which log lines of a run to get.
+type LogQuery struct {
+	// Only lines of this allocation, if given.
+	AllocId string
+	// Only lines of this task, if given.
+	Task string
+	// Only lines that contain this text, if given.
+	Filter string
+	// Whether Filter is a regular expression.
+	Regex bool
+	// Where the previous page ended, empty for the first page.
+	Cursor string
+	// The max number of lines.
+	Limit int
+}
+
+type LogPage struct {
+	Lines []LogLine `json:"lines"`
+	// Where the next page starts, empty if there are no more lines.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
 type LokiOutput struct {
 	Stderr []LokiLine
 	Stdout []LokiLine
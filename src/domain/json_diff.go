@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A difference between two JSON values.
+// `Before` is nil if the value was added, `After` is nil if it was removed.
+type JsonChange struct {
+	Path   string       `json:"path"` // JSON pointer
+	Before *interface{} `json:"before,omitempty"`
+	After  *interface{} `json:"after,omitempty"`
+}
+
+// Returns the structural differences between two JSON values
+// as produced by `json.Unmarshal()` into an `interface{}`.
+// Objects are compared by key, arrays by index.
+func DiffJson(before, after interface{}) []JsonChange {
+	return diffJson("", &before, &after, nil)
+}
+
+// Like `DiffJson()` but for any values that can be marshaled to JSON.
+func DiffJsonOf(before, after interface{}) ([]JsonChange, error) {
+	b, err := jsonRoundTrip(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := jsonRoundTrip(after)
+	if err != nil {
+		return nil, err
+	}
+	return DiffJson(b, a), nil
+}
+
+func jsonRoundTrip(value interface{}) (result interface{}, err error) {
+	var data []byte
+	if data, err = json.Marshal(value); err == nil {
+		err = json.Unmarshal(data, &result)
+	}
+	return
+}
+
+func diffJson(path string, before, after *interface{}, changes []JsonChange) []JsonChange {
+	if before == nil || after == nil {
+		return append(changes, JsonChange{Path: path, Before: before, After: after})
+	}
+
+	switch b := (*before).(type) {
+	case map[string]interface{}:
+		if a, ok := (*after).(map[string]interface{}); ok {
+			keys := make([]string, 0, len(b)+len(a))
+			for k := range b {
+				keys = append(keys, k)
+			}
+			for k := range a {
+				if _, exists := b[k]; !exists {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				changes = diffJson(path+"/"+escapeJsonPointer(k), jsonMapEntry(b, k), jsonMapEntry(a, k), changes)
+			}
+			return changes
+		}
+	case []interface{}:
+		if a, ok := (*after).([]interface{}); ok {
+			for i := 0; i < len(b) || i < len(a); i++ {
+				changes = diffJson(fmt.Sprintf("%s/%d", path, i), jsonArrayElem(b, i), jsonArrayElem(a, i), changes)
+			}
+			return changes
+		}
+	}
+
+	if !reflect.DeepEqual(*before, *after) {
+		changes = append(changes, JsonChange{Path: path, Before: before, After: after})
+	}
+
+	return changes
+}
+
+func jsonMapEntry(m map[string]interface{}, k string) *interface{} {
+	if v, exists := m[k]; exists {
+		return &v
+	}
+	return nil
+}
+
+func jsonArrayElem(a []interface{}, i int) *interface{} {
+	if i < len(a) {
+		return &a[i]
+	}
+	return nil
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapeJsonPointer(token string) string {
+	return jsonPointerEscaper.Replace(token)
+}
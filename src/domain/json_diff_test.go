@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldDiffJson(t *testing.T) {
+	t.Parallel()
+
+	// given
+	var before, after interface{}
+	if err := json.Unmarshal([]byte(`{"a": 1, "b": [1, 2], "c/d": {"e": true}, "f": "same"}`), &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"a": 2, "b": [1], "c/d": {"e": true, "g": null}, "f": "same"}`), &after); err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	changes := DiffJson(before, after)
+
+	// then
+	var one, two, null interface{} = 1.0, 2.0, nil
+	assert.Equal(t, []JsonChange{
+		{Path: "/a", Before: &one, After: &two},
+		{Path: "/b/1", Before: &two},
+		{Path: "/c~1d/g", After: &null},
+	}, changes)
+}
+
+func TestShouldDiffActionVersionsWithNormalizedMatch(t *testing.T) {
+	t.Parallel()
+
+	// given
+	from := Action{Source: "a", ActionDefinition: ActionDefinition{
+		Inputs: map[string]InputDefinition{"x": {Match: "foo:   string"}},
+	}}
+	to := Action{Source: "b", ActionDefinition: ActionDefinition{
+		Inputs: map[string]InputDefinition{"x": {Match: "foo: string"}},
+	}}
+
+	// when
+	changes, err := DiffJsonOf(from.Version(), to.Version())
+
+	// then
+	assert.NoError(t, err)
+	var a, b interface{} = "a", "b"
+	assert.Equal(t, []JsonChange{{Path: "/source", Before: &a, After: &b}}, changes)
+}
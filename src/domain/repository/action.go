@@ -17,6 +17,15 @@ type ActionRepository interface {
 	GetAll() ([]*domain.Action, error)
 	GetCurrent() ([]*domain.Action, error)
 	GetCurrentActive() ([]*domain.Action, error)
+	// Returns the revisions that any version of any action is pinned to by source.
+	GetSourceRevisions() (map[string][]string, error)
 	Save(*domain.Action) error
 	Update(*domain.Action) error
+	// Archives all versions of the action with the given name.
+	Archive(name string) error
+	Unarchive(name string) error
+	GetDeletionByName(string) (domain.ActionDeletion, error)
+	// Deletes all versions of the action with the given name
+	// together with their runs and the facts those produced.
+	DeleteByName(string) error
 }
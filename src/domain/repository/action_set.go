@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+type ActionSetRepository interface {
+	WithQuerier(config.PgxIface) ActionSetRepository
+
+	GetById(uuid.UUID) (domain.ActionSet, error)
+	GetAll() ([]*domain.ActionSet, error)
+	GetActive() ([]*domain.ActionSet, error)
+	Save(*domain.ActionSet) error
+	Update(*domain.ActionSet) error
+}
+
+type ActionSetSyncRepository interface {
+	WithQuerier(config.PgxIface) ActionSetSyncRepository
+
+	GetByActionSetId(uuid.UUID, *Page) ([]*domain.ActionSetSync, error)
+	Save(*domain.ActionSetSync) error
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"io"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
@@ -18,5 +19,7 @@ type FactRepository interface {
 	GetBinaryById(pgx.Tx, uuid.UUID) (io.ReadSeekCloser, error)
 	GetLatestByFields([][]string) (domain.Fact, error)
 	GetByFields([][]string) ([]*domain.Fact, error)
+	// Returns the facts created after the given time, latest first.
+	GetByFieldsCreatedAfter([][]string, time.Time) ([]*domain.Fact, error)
 	Save(*domain.Fact, io.Reader) error
 }
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	nomad "github.com/hashicorp/nomad/api"
 	"github.com/input-output-hk/cicero/src/config"
@@ -9,7 +11,10 @@ import (
 type NomadEventRepository interface {
 	WithQuerier(config.PgxIface) NomadEventRepository
 
-	Save(*nomad.Event) error
-	GetLastNomadEvent() (uint64, error)
+	Save(cluster string, jobId uuid.UUID, event *nomad.Event) error
+	// Returns the index up to which the cluster's event stream was processed.
+	GetLastNomadEvent(cluster string) (uint64, error)
+	SaveLastNomadEvent(cluster string, index uint64) error
 	GetEventAllocByNomadJobId(uuid.UUID) ([]map[string]interface{}, error)
+	DeleteOlderThan(time.Time) (int64, error)
 }
@@ -16,6 +16,18 @@ type RunRepository interface {
 	GetInputFactIdsByNomadJobId(uuid.UUID) (RunInputFactIds, error)
 	GetAll(*Page) ([]*domain.Run, error)
 	GetByInputFactIds([]*uuid.UUID, bool, *Page) ([]*domain.Run, error)
+	// Returns all started but unfinished runs, oldest first.
+	GetRunning() ([]*domain.Run, error)
+	// Serializes counting and starting the runs of an action
+	// until the end of the transaction this is called in.
+	LockByActionName(string) error
+	// Returns the started but unfinished runs of all versions of an action, oldest first.
+	GetRunningByActionName(string) ([]*domain.Run, error)
+	// Returns the queued runs of all versions of an action that may start, oldest first.
+	// Runs of archived actions stay queued until the action is unarchived.
+	GetQueuedByActionName(string) ([]*domain.Run, error)
+	// Returns the names of unarchived actions with queued runs that may start.
+	GetQueuedActionNames() ([]string, error)
 	Save(*domain.Run, map[string]interface{}) error
 	Update(*domain.Run) error
 }
@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+type RunJobRepository interface {
+	WithQuerier(config.PgxIface) RunJobRepository
+
+	GetByRunId(uuid.UUID) (domain.RunJob, error)
+	Save(*domain.RunJob) error
+	// Replaces the job, for example after adding meta to it.
+	UpdateJob(*domain.RunJob) error
+}
@@ -128,9 +128,34 @@ type ActionDefinition struct {
 	Inputs map[string]InputDefinition `json:"inputs"`
 }
 
+type RunOutputPublished string
+
+const (
+	RunOutputPublishedSuccess RunOutputPublished = "success"
+	RunOutputPublishedFailure RunOutputPublished = "failure"
+	// The run ended without taking a branch, for example because it was canceled.
+	RunOutputPublishedNone RunOutputPublished = "none"
+)
+
+// Evaluators' output is decoded into this so the fields
+// that record what was published are not part of its JSON.
 type RunOutput struct {
 	Failure *interface{} `json:"failure"`
 	Success *interface{} `json:"success"`
+	// Which branch was taken. Nil as long as the run did not end.
+	Published *RunOutputPublished `json:"-"`
+	// The ID of the published fact. Nil if the branch had no fact.
+	FactId *uuid.UUID `json:"-"`
+}
+
+// Records the branch that was taken and the fact it published, if any.
+func (self *RunOutput) Publish(branch RunOutputPublished, fact *Fact) {
+	self.Published = &branch
+	if fact == nil {
+		self.FactId = nil
+	} else {
+		self.FactId = &fact.ID
+	}
 }
 
 type RunDefinition struct {
@@ -142,6 +167,17 @@ func (s *RunDefinition) IsDecision() bool {
 	return s.Job == nil
 }
 
+// How a run definition came to be.
+type RunEvaluation struct {
+	// The evaluator that succeeded.
+	Evaluator      string `json:"evaluator"`
+	SourceRevision string `json:"source_revision"`
+	// The output of the evaluator.
+	Evaluated json.RawMessage `json:"evaluated"`
+	// The output after all transformers were applied.
+	Transformed json.RawMessage `json:"transformed"`
+}
+
 type Fact struct {
 	ID         uuid.UUID   `json:"id"`
 	RunId      *uuid.UUID  `json:"run_id,omitempty"`
@@ -162,17 +198,385 @@ func (f *Fact) FromReader(reader io.Reader) (io.Reader, error) {
 }
 
 type Action struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Source    string    `json:"source"`
-	CreatedAt time.Time `json:"created_at"`
-	Active    bool      `json:"active"`
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Source string    `json:"source"`
+	// The revision of the source this action was created from.
+	// Nil for actions that were created before sources were pinned.
+	SourceRevision *string   `json:"source_revision"`
+	CreatedAt      time.Time `json:"created_at"`
+	Active         bool      `json:"active"`
+	// Set on all versions of archived actions.
+	// Archived actions are not current and never invoked.
+	ArchivedAt *time.Time `json:"archived_at"`
 	ActionDefinition
 }
 
+// What deleting all versions of an action would remove.
+type ActionDeletion struct {
+	Name    string `json:"name"`
+	Actions int    `json:"actions"`
+	Runs    int    `json:"runs"`
+	Facts   int    `json:"facts"`
+	// Runs that did not finish yet. Their Nomad jobs are stopped.
+	UnfinishedRuns []uuid.UUID `json:"unfinished_runs"`
+	// Runs of other actions that took facts produced by this action as inputs.
+	// The action cannot be deleted as long as there are any.
+	DependentRuns []uuid.UUID `json:"dependent_runs"`
+}
+
+func (self ActionDeletion) Possible() bool {
+	return len(self.DependentRuns) == 0
+}
+
+// The differences between two versions of an action.
+type ActionDiff struct {
+	From uuid.UUID `json:"from"`
+	To   uuid.UUID `json:"to"`
+	// Changes of source, revision, meta and inputs as stored.
+	Changes []JsonChange `json:"changes"`
+	// Changes of the definitions as evaluated from the sources now.
+	DefinitionChanges []JsonChange `json:"definition_changes"`
+	// Why the definitions could not be evaluated.
+	DefinitionError *string `json:"definition_error,omitempty"`
+}
+
+// Returns the parts of the action that make up a version.
+// Inputs' match expressions are normalized by marshaling.
+func (self *Action) Version() interface{} {
+	return struct {
+		Source         string                     `json:"source"`
+		SourceRevision *string                    `json:"source_revision"`
+		Meta           map[string]interface{}     `json:"meta"`
+		Inputs         map[string]InputDefinition `json:"inputs"`
+	}{self.Source, self.SourceRevision, self.Meta, self.Inputs}
+}
+
+type ActionConcurrencyPolicy string
+
+const (
+	// Runs wait until a slot frees up.
+	ActionConcurrencyPolicyQueue ActionConcurrencyPolicy = "queue"
+	// The oldest runs are canceled to make room, the new run waits for them to end.
+	ActionConcurrencyPolicyCancelOldest ActionConcurrencyPolicy = "cancel-oldest"
+	// Runs are not started at all.
+	ActionConcurrencyPolicySkip ActionConcurrencyPolicy = "skip"
+)
+
+// Limits how many runs of an action may run at the same time.
+// Set in the action's meta as `concurrency`, for example
+// `{"limit": 1, "policy": "queue"}`.
+type ActionConcurrency struct {
+	Limit  int                     `json:"limit"`
+	Policy ActionConcurrencyPolicy `json:"policy"`
+}
+
+// Returns nil if the action's runs are not limited.
+func (self *Action) Concurrency() (*ActionConcurrency, error) {
+	value, exists := self.Meta["concurrency"]
+	if !exists {
+		return nil, nil
+	}
+
+	concurrency := ActionConcurrency{Policy: ActionConcurrencyPolicyQueue}
+	if data, err := json.Marshal(value); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &concurrency); err != nil {
+		return nil, errors.WithMessage(err, "Invalid concurrency in meta")
+	}
+
+	if concurrency.Limit < 1 {
+		return nil, errors.Errorf("Invalid concurrency limit %d in meta, must be at least 1", concurrency.Limit)
+	}
+
+	switch concurrency.Policy {
+	case ActionConcurrencyPolicyQueue, ActionConcurrencyPolicyCancelOldest, ActionConcurrencyPolicySkip:
+	default:
+		return nil, errors.Errorf("Invalid concurrency policy %q in meta", concurrency.Policy)
+	}
+
+	return &concurrency, nil
+}
+
+// Limits how long runs of an action may take.
+// Set in the action's meta as `timeout`, for example
+// `{"after": "1h", "publish_failure": true}`.
+type ActionTimeout struct {
+	After time.Duration
+	// Whether to publish the failure output as a fact when a run times out.
+	PublishFailure bool
+}
+
+// Returns nil if the action's runs have no timeout of their own.
+func (self *Action) Timeout() (*ActionTimeout, error) {
+	value, exists := self.Meta["timeout"]
+	if !exists {
+		return nil, nil
+	}
+
+	timeout := struct {
+		After          string `json:"after"`
+		PublishFailure bool   `json:"publish_failure"`
+	}{}
+	if data, err := json.Marshal(value); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &timeout); err != nil {
+		return nil, errors.WithMessage(err, "Invalid timeout in meta")
+	}
+
+	after, err := time.ParseDuration(timeout.After)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid timeout in meta")
+	} else if after <= 0 {
+		return nil, errors.Errorf("Invalid timeout %q in meta, must be positive", timeout.After)
+	}
+
+	return &ActionTimeout{After: after, PublishFailure: timeout.PublishFailure}, nil
+}
+
+// When to retry failed runs of an action.
+// Set in the action's meta as `retry`, for example
+// `{"max_attempts": 3, "backoff": "1m", "exit_codes": [1], "on_lost": true}`.
+type ActionRetry struct {
+	// Including the first attempt.
+	MaxAttempts int
+	// How long to wait before the first retry, doubled for each further one.
+	Backoff time.Duration
+	// Retry only if a task failed with one of these exit codes.
+	ExitCodes []int
+	// Retry if an allocation was lost, for example because its node went down.
+	OnLost bool
+}
+
+// Returns nil if failed runs of the action are not retried.
+func (self *Action) Retry() (*ActionRetry, error) {
+	value, exists := self.Meta["retry"]
+	if !exists {
+		return nil, nil
+	}
+
+	retry := struct {
+		MaxAttempts int    `json:"max_attempts"`
+		Backoff     string `json:"backoff"`
+		ExitCodes   []int  `json:"exit_codes"`
+		OnLost      bool   `json:"on_lost"`
+	}{Backoff: "0s"}
+	if data, err := json.Marshal(value); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &retry); err != nil {
+		return nil, errors.WithMessage(err, "Invalid retry in meta")
+	}
+
+	if retry.MaxAttempts < 1 {
+		return nil, errors.Errorf("Invalid retry max_attempts %d in meta, must be at least 1", retry.MaxAttempts)
+	}
+
+	backoff, err := time.ParseDuration(retry.Backoff)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid retry backoff in meta")
+	} else if backoff < 0 {
+		return nil, errors.Errorf("Invalid retry backoff %q in meta, must not be negative", retry.Backoff)
+	}
+
+	return &ActionRetry{
+		MaxAttempts: retry.MaxAttempts,
+		Backoff:     backoff,
+		ExitCodes:   retry.ExitCodes,
+		OnLost:      retry.OnLost,
+	}, nil
+}
+
+// Whether to retry after the given attempt failed
+// with the given exit codes or because an allocation was lost.
+// Any failure is retried if neither exit codes nor lost allocations are asked for.
+func (self *ActionRetry) ShouldRetry(attempt int, exitCodes []int, lost bool) bool {
+	if attempt >= self.MaxAttempts {
+		return false
+	}
+
+	if len(self.ExitCodes) == 0 && !self.OnLost {
+		return true
+	}
+
+	if lost && self.OnLost {
+		return true
+	}
+
+	for _, exitCode := range exitCodes {
+		for _, retryExitCode := range self.ExitCodes {
+			if exitCode == retryExitCode {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// How long to wait before starting the given attempt.
+func (self *ActionRetry) BackoffBefore(attempt int) time.Duration {
+	backoff := self.Backoff
+	for i := 2; i < attempt; i++ {
+		backoff *= 2
+	}
+	return backoff
+}
+
+// Where runs of an action are scheduled.
+// Set in the action's meta as `nomad`, for example
+// `{"cluster": "ci", "namespace": "builds", "region": "eu"}`.
+// The namespace and region default to those of the job.
+type ActionNomad struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Region    string `json:"region"`
+}
+
+// Returns nil if the action's runs are scheduled on the default cluster.
+func (self *Action) Nomad() (*ActionNomad, error) {
+	value, exists := self.Meta["nomad"]
+	if !exists {
+		return nil, nil
+	}
+
+	target := ActionNomad{}
+	if data, err := json.Marshal(value); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &target); err != nil {
+		return nil, errors.WithMessage(err, "Invalid nomad in meta")
+	}
+
+	return &target, nil
+}
+
+// Returns an error if any of the meta that Cicero reads is invalid,
+// so that actions are rejected early instead of failing when they run.
+func (self *Action) ValidateMeta() error {
+	if _, err := self.Concurrency(); err != nil {
+		return err
+	}
+	if _, err := self.Timeout(); err != nil {
+		return err
+	}
+	if _, err := self.Retry(); err != nil {
+		return err
+	}
+	if _, err := self.Nomad(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// A source whose actions are kept in sync.
+type ActionSet struct {
+	ID     uuid.UUID `json:"id"`
+	Source string    `json:"source"`
+	// A CUE expression. If given, the set is synced when a new fact matches,
+	// for example a push event, instead of periodically.
+	Match     *string    `json:"match"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	SyncedAt  *time.Time `json:"synced_at"`
+	// The revision of the source at the last sync.
+	SourceRevision *string `json:"source_revision"`
+}
+
+type ActionSetChangeKind string
+
+const (
+	ActionSetChangeCreated     ActionSetChangeKind = "created"
+	ActionSetChangeUpdated     ActionSetChangeKind = "updated"
+	ActionSetChangeUnchanged   ActionSetChangeKind = "unchanged"
+	ActionSetChangeDeactivated ActionSetChangeKind = "deactivated"
+	ActionSetChangeFailed      ActionSetChangeKind = "failed"
+	// Archived actions are left alone until unarchived.
+	ActionSetChangeArchived ActionSetChangeKind = "archived"
+)
+
+// What a sync did to an action.
+type ActionSetChange struct {
+	Name string              `json:"name"`
+	Kind ActionSetChangeKind `json:"kind"`
+	// The current version of the action after the sync.
+	ActionId *uuid.UUID `json:"action_id,omitempty"`
+	Error    *string    `json:"error,omitempty"`
+}
+
+// The report of syncing an action set.
+type ActionSetSync struct {
+	ID             uuid.UUID `json:"id"`
+	ActionSetId    uuid.UUID `json:"action_set_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	SourceRevision *string   `json:"source_revision"`
+	// The fact that triggered the sync, if any.
+	FactId  *uuid.UUID        `json:"fact_id"`
+	Changes []ActionSetChange `json:"changes"`
+	// Why the source could not be synced at all.
+	Error *string `json:"error"`
+}
+
 type Run struct {
-	NomadJobID uuid.UUID  `json:"nomad_job_id"`
-	ActionId   uuid.UUID  `json:"action_id"`
-	CreatedAt  time.Time  `json:"created_at"`
+	NomadJobID uuid.UUID `json:"nomad_job_id"`
+	ActionId   uuid.UUID `json:"action_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Nil while the run is queued or if it was skipped.
+	StartedAt  *time.Time `json:"started_at"`
 	FinishedAt *time.Time `json:"finished_at"`
+	// Why the run ended if it did not end by itself.
+	EndReason *RunEndReason `json:"end_reason"`
+	// The first attempt if this run retries a failed one.
+	RetryOf *uuid.UUID `json:"retry_of"`
+	Attempt int        `json:"attempt"`
+	// A queued run is not started before.
+	StartAfter *time.Time `json:"start_after"`
+	// The name of the Nomad cluster the job runs on.
+	NomadCluster   string  `json:"nomad_cluster"`
+	NomadNamespace *string `json:"nomad_namespace"`
+	NomadRegion    *string `json:"nomad_region"`
+}
+
+func (self *Run) Queued() bool {
+	return self.StartedAt == nil && self.FinishedAt == nil
+}
+
+func (self *Run) NomadWriteOptions() *nomad.WriteOptions {
+	opts := &nomad.WriteOptions{}
+	if self.NomadNamespace != nil {
+		opts.Namespace = *self.NomadNamespace
+	}
+	if self.NomadRegion != nil {
+		opts.Region = *self.NomadRegion
+	}
+	return opts
+}
+
+func (self *Run) NomadQueryOptions() *nomad.QueryOptions {
+	opts := &nomad.QueryOptions{}
+	if self.NomadNamespace != nil {
+		opts.Namespace = *self.NomadNamespace
+	}
+	if self.NomadRegion != nil {
+		opts.Region = *self.NomadRegion
+	}
+	return opts
+}
+
+type RunEndReason string
+
+const (
+	RunEndReasonCanceled RunEndReason = "canceled"
+	// The action already had as many runs as it may run at the same time.
+	RunEndReasonSkipped RunEndReason = "skipped"
+	// The run took longer than allowed.
+	RunEndReasonTimedOut RunEndReason = "timed_out"
+	// Nomad does not know the run's job anymore.
+	RunEndReasonLost RunEndReason = "lost"
+)
+
+// The evaluation of a run and the job that was submitted for it.
+type RunJob struct {
+	RunId uuid.UUID `json:"run_id"`
+	RunEvaluation
+	// Nil for decisions.
+	Job *nomad.Job `json:"job"`
 }
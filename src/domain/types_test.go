@@ -0,0 +1,229 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldParseActionConcurrencyFromMeta(t *testing.T) {
+	t.Parallel()
+
+	for meta, expected := range map[string]*ActionConcurrency{
+		`{}`:                            nil,
+		`{"concurrency": {"limit": 1}}`: {Limit: 1, Policy: ActionConcurrencyPolicyQueue},
+		`{"concurrency": {"limit": 2, "policy": "cancel-oldest"}}`: {Limit: 2, Policy: ActionConcurrencyPolicyCancelOldest},
+	} {
+		// given
+		action := Action{}
+		if err := json.Unmarshal([]byte(meta), &action.Meta); err != nil {
+			t.Fatal(err)
+		}
+
+		// when
+		concurrency, err := action.Concurrency()
+
+		// then
+		assert.NoError(t, err, meta)
+		assert.Equal(t, expected, concurrency, meta)
+	}
+
+	for _, meta := range []string{
+		`{"concurrency": {"limit": 0}}`,
+		`{"concurrency": {"limit": 1, "policy": "wait"}}`,
+		`{"concurrency": true}`,
+	} {
+		action := Action{}
+		if err := json.Unmarshal([]byte(meta), &action.Meta); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := action.Concurrency()
+
+		assert.Error(t, err, meta)
+	}
+}
+
+func TestShouldParseActionTimeoutFromMeta(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := Action{}
+	if err := json.Unmarshal([]byte(`{"timeout": {"after": "1h30m", "publish_failure": true}}`), &action.Meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	timeout, err := action.Timeout()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, &ActionTimeout{After: 90 * time.Minute, PublishFailure: true}, timeout)
+}
+
+func TestShouldParseActionNomadFromMeta(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := Action{}
+	if err := json.Unmarshal([]byte(`{"nomad": {"cluster": "ci", "namespace": "builds"}}`), &action.Meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// when
+	target, err := action.Nomad()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, &ActionNomad{Cluster: "ci", Namespace: "builds"}, target)
+}
+
+func TestShouldRetryFailedRuns(t *testing.T) {
+	t.Parallel()
+
+	// given
+	anyFailure := ActionRetry{MaxAttempts: 3, Backoff: time.Minute}
+	exitCodes := ActionRetry{MaxAttempts: 3, ExitCodes: []int{2}}
+	lost := ActionRetry{MaxAttempts: 3, OnLost: true}
+
+	// then
+	assert.True(t, anyFailure.ShouldRetry(1, []int{1}, false))
+	assert.True(t, anyFailure.ShouldRetry(2, nil, false))
+	assert.False(t, anyFailure.ShouldRetry(3, nil, false))
+	assert.Equal(t, time.Minute, anyFailure.BackoffBefore(2))
+	assert.Equal(t, 2*time.Minute, anyFailure.BackoffBefore(3))
+
+	assert.True(t, exitCodes.ShouldRetry(1, []int{1, 2}, false))
+	assert.False(t, exitCodes.ShouldRetry(1, []int{1}, true))
+
+	assert.True(t, lost.ShouldRetry(1, nil, true))
+	assert.False(t, lost.ShouldRetry(1, []int{1}, false))
+}
+
+func TestShouldDoubleRetryBackoff(t *testing.T) {
+	t.Parallel()
+
+	// given
+	retry := ActionRetry{MaxAttempts: 5, Backoff: 30 * time.Second}
+	noBackoff := ActionRetry{MaxAttempts: 5}
+
+	// then
+	assert.Equal(t, 30*time.Second, retry.BackoffBefore(2))
+	assert.Equal(t, time.Minute, retry.BackoffBefore(3))
+	assert.Equal(t, 2*time.Minute, retry.BackoffBefore(4))
+	assert.Equal(t, 4*time.Minute, retry.BackoffBefore(5))
+	assert.Zero(t, noBackoff.BackoffBefore(3))
+}
+
+func TestShouldParseActionRetry(t *testing.T) {
+	t.Parallel()
+
+	// given
+	action := Action{}
+	action.Meta = map[string]interface{}{"retry": map[string]interface{}{
+		"max_attempts": 3,
+		"backoff":      "1m",
+		"exit_codes":   []int{2, 3},
+		"on_lost":      true,
+	}}
+
+	// when
+	retry, err := action.Retry()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, &ActionRetry{MaxAttempts: 3, Backoff: time.Minute, ExitCodes: []int{2, 3}, OnLost: true}, retry)
+
+	// when
+	action.Meta = map[string]interface{}{}
+	retry, err = action.Retry()
+
+	// then
+	assert.NoError(t, err)
+	assert.Nil(t, retry)
+
+	for _, invalid := range []map[string]interface{}{
+		{"max_attempts": 0},
+		{"max_attempts": 2, "backoff": "soon"},
+		{"max_attempts": 2, "backoff": "-1m"},
+	} {
+		// when
+		action.Meta = map[string]interface{}{"retry": invalid}
+		_, err = action.Retry()
+
+		// then
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestShouldValidateActionMeta(t *testing.T) {
+	t.Parallel()
+
+	// given
+	valid := Action{}
+	valid.Meta = map[string]interface{}{
+		"concurrency": map[string]interface{}{"limit": 1},
+		"timeout":     map[string]interface{}{"after": "1h"},
+		"retry":       map[string]interface{}{"max_attempts": 2},
+		"nomad":       map[string]interface{}{"cluster": "ci"},
+	}
+
+	// then
+	assert.NoError(t, valid.ValidateMeta())
+	assert.NoError(t, (&Action{}).ValidateMeta())
+
+	for name, value := range map[string]interface{}{
+		"concurrency": map[string]interface{}{"limit": 0},
+		"timeout":     map[string]interface{}{"after": "x"},
+		"retry":       map[string]interface{}{"max_attempts": 0},
+		"nomad":       "ci",
+	} {
+		invalid := Action{}
+		invalid.Meta = map[string]interface{}{name: value}
+		assert.Error(t, invalid.ValidateMeta(), name)
+	}
+}
+
+func TestShouldNotDecodePublishedRunOutputFromJson(t *testing.T) {
+	t.Parallel()
+
+	// given
+	data := []byte(`{"success": {"ok": true}, "published": "failure", "fact_id": "` + uuid.NewString() + `"}`)
+
+	// when
+	var output RunOutput
+	err := json.Unmarshal(data, &output)
+
+	// then
+	assert.NoError(t, err)
+	assert.NotNil(t, output.Success)
+	assert.Nil(t, output.Published)
+	assert.Nil(t, output.FactId)
+}
+
+func TestShouldPublishRunOutputBranchWithoutFact(t *testing.T) {
+	t.Parallel()
+
+	// given
+	output := RunOutput{}
+
+	// when
+	output.Publish(RunOutputPublishedSuccess, nil)
+
+	// then
+	if assert.NotNil(t, output.Published) {
+		assert.Equal(t, RunOutputPublishedSuccess, *output.Published)
+	}
+	assert.Nil(t, output.FactId)
+
+	// when
+	fact := &Fact{ID: uuid.New()}
+	output.Publish(RunOutputPublishedFailure, fact)
+
+	// then
+	assert.Equal(t, RunOutputPublishedFailure, *output.Published)
+	assert.Equal(t, &fact.ID, output.FactId)
+}
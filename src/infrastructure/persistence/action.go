@@ -74,20 +74,39 @@ func (a *actionRepository) GetAll() (actions []*domain.Action, err error) {
 	return
 }
 
+func (a *actionRepository) GetSourceRevisions() (map[string][]string, error) {
+	var rows []struct {
+		Source         string
+		SourceRevision string
+	}
+	if err := pgxscan.Select(
+		context.Background(), a.DB, &rows,
+		`SELECT DISTINCT source, source_revision FROM action WHERE source_revision IS NOT NULL`,
+	); err != nil {
+		return nil, err
+	}
+
+	revisions := map[string][]string{}
+	for _, row := range rows {
+		revisions[row.Source] = append(revisions[row.Source], row.SourceRevision)
+	}
+	return revisions, nil
+}
+
 func (a *actionRepository) Save(action *domain.Action) error {
 	if inputs, err := json.Marshal(action.Inputs); err != nil {
 		return err
 	} else {
 		var sql string
 		if action.ID == (uuid.UUID{}) {
-			sql = `INSERT INTO action (    name, source, inputs) VALUES (    $2, $3, $4) RETURNING id, created_at`
+			sql = `INSERT INTO action (    name, source, source_revision, meta, inputs) VALUES (    $2, $3, $4, $5, $6) RETURNING id, created_at`
 		} else {
-			sql = `INSERT INTO action (id, name, source, inputs) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+			sql = `INSERT INTO action (id, name, source, source_revision, meta, inputs) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
 		}
 		return a.DB.QueryRow(
 			context.Background(),
 			sql,
-			action.ID, action.Name, action.Source, inputs,
+			action.ID, action.Name, action.Source, action.SourceRevision, action.Meta, inputs,
 		).Scan(&action.ID, &action.CreatedAt)
 	}
 }
@@ -104,7 +123,7 @@ func (a *actionRepository) Update(action *domain.Action) (err error) {
 func (a *actionRepository) GetCurrent() (actions []*domain.Action, err error) {
 	err = pgxscan.Select(
 		context.Background(), a.DB, &actions,
-		`SELECT DISTINCT ON (name) * FROM action ORDER BY name, created_at DESC`,
+		`SELECT DISTINCT ON (name) * FROM action WHERE archived_at IS NULL ORDER BY name, created_at DESC`,
 	)
 	return
 }
@@ -112,7 +131,82 @@ func (a *actionRepository) GetCurrent() (actions []*domain.Action, err error) {
 func (a *actionRepository) GetCurrentActive() (actions []*domain.Action, err error) {
 	err = pgxscan.Select(
 		context.Background(), a.DB, &actions,
-		`SELECT DISTINCT ON (name) * FROM action WHERE active ORDER BY name, created_at DESC`,
+		`SELECT DISTINCT ON (name) * FROM action WHERE active AND archived_at IS NULL ORDER BY name, created_at DESC`,
 	)
 	return
 }
+
+func (a *actionRepository) Archive(name string) (err error) {
+	_, err = a.DB.Exec(
+		context.Background(),
+		`UPDATE action SET archived_at = STATEMENT_TIMESTAMP() WHERE name = $1 AND archived_at IS NULL`,
+		name,
+	)
+	return
+}
+
+func (a *actionRepository) Unarchive(name string) (err error) {
+	_, err = a.DB.Exec(
+		context.Background(),
+		`UPDATE action SET archived_at = NULL WHERE name = $1`,
+		name,
+	)
+	return
+}
+
+// Selects the IDs of the runs of all versions of the action with name $1.
+const actionRunIdsSql = `SELECT nomad_job_id FROM run WHERE action_id IN (SELECT id FROM action WHERE name = $1)`
+
+// Selects the IDs of the facts produced by the runs of all versions of the action with name $1.
+const actionFactIdsSql = `SELECT id FROM fact WHERE run_id IN (` + actionRunIdsSql + `)`
+
+func (a *actionRepository) GetDeletionByName(name string) (deletion domain.ActionDeletion, err error) {
+	deletion.Name = name
+
+	if err = a.DB.QueryRow(
+		context.Background(),
+		`SELECT
+			(SELECT count(*) FROM action WHERE name = $1),
+			(SELECT count(*) FROM (`+actionRunIdsSql+`) AS runs),
+			(SELECT count(*) FROM (`+actionFactIdsSql+`) AS facts)`,
+		name,
+	).Scan(&deletion.Actions, &deletion.Runs, &deletion.Facts); err != nil {
+		return
+	}
+
+	if err = pgxscan.Select(
+		context.Background(), a.DB, &deletion.UnfinishedRuns,
+		`SELECT nomad_job_id FROM run WHERE nomad_job_id IN (`+actionRunIdsSql+`) AND finished_at IS NULL`,
+		name,
+	); err != nil {
+		return
+	}
+
+	err = pgxscan.Select(
+		context.Background(), a.DB, &deletion.DependentRuns,
+		`SELECT DISTINCT run_id FROM run_inputs WHERE
+			fact_id IN (`+actionFactIdsSql+`) AND
+			run_id NOT IN (`+actionRunIdsSql+`)`,
+		name,
+	)
+
+	return
+}
+
+func (a *actionRepository) DeleteByName(name string) error {
+	for _, sql := range []string{
+		// keep the syncs, just forget which fact triggered them
+		`UPDATE action_set_sync SET fact_id = NULL WHERE fact_id IN (` + actionFactIdsSql + `)`,
+		`DELETE FROM run_inputs WHERE run_id IN (` + actionRunIdsSql + `)`,
+		`DELETE FROM run_output WHERE run_id IN (` + actionRunIdsSql + `)`,
+		`DELETE FROM run_job WHERE run_id IN (` + actionRunIdsSql + `)`,
+		`DELETE FROM fact WHERE id IN (` + actionFactIdsSql + `)`,
+		`DELETE FROM run WHERE nomad_job_id IN (` + actionRunIdsSql + `)`,
+		`DELETE FROM action WHERE name = $1`,
+	} {
+		if _, err := a.DB.Exec(context.Background(), sql, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/google/uuid"
+
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+)
+
+type actionSetRepository struct {
+	DB config.PgxIface
+}
+
+func NewActionSetRepository(db config.PgxIface) repository.ActionSetRepository {
+	return actionSetRepository{db}
+}
+
+func (a actionSetRepository) WithQuerier(querier config.PgxIface) repository.ActionSetRepository {
+	return actionSetRepository{querier}
+}
+
+func (a actionSetRepository) GetById(id uuid.UUID) (set domain.ActionSet, err error) {
+	err = pgxscan.Get(
+		context.Background(), a.DB, &set,
+		`SELECT * FROM action_set WHERE id = $1`,
+		id,
+	)
+	return
+}
+
+func (a actionSetRepository) GetAll() (sets []*domain.ActionSet, err error) {
+	err = pgxscan.Select(
+		context.Background(), a.DB, &sets,
+		`SELECT * FROM action_set ORDER BY source`,
+	)
+	return
+}
+
+func (a actionSetRepository) GetActive() (sets []*domain.ActionSet, err error) {
+	err = pgxscan.Select(
+		context.Background(), a.DB, &sets,
+		`SELECT * FROM action_set WHERE active ORDER BY source`,
+	)
+	return
+}
+
+func (a actionSetRepository) Save(set *domain.ActionSet) error {
+	return a.DB.QueryRow(
+		context.Background(),
+		`INSERT INTO action_set (source, match, active) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		set.Source, set.Match, set.Active,
+	).Scan(&set.ID, &set.CreatedAt)
+}
+
+func (a actionSetRepository) Update(set *domain.ActionSet) (err error) {
+	_, err = a.DB.Exec(
+		context.Background(),
+		`UPDATE action_set SET match = $2, active = $3, synced_at = $4, source_revision = $5 WHERE id = $1`,
+		set.ID, set.Match, set.Active, set.SyncedAt, set.SourceRevision,
+	)
+	return
+}
+
+type actionSetSyncRepository struct {
+	DB config.PgxIface
+}
+
+func NewActionSetSyncRepository(db config.PgxIface) repository.ActionSetSyncRepository {
+	return actionSetSyncRepository{db}
+}
+
+func (a actionSetSyncRepository) WithQuerier(querier config.PgxIface) repository.ActionSetSyncRepository {
+	return actionSetSyncRepository{querier}
+}
+
+func (a actionSetSyncRepository) GetByActionSetId(id uuid.UUID, page *repository.Page) ([]*domain.ActionSetSync, error) {
+	syncs := make([]*domain.ActionSetSync, page.Limit)
+	return syncs, fetchPage(
+		a.DB, page, &syncs,
+		`*`, `action_set_sync WHERE action_set_id = $1`, `created_at DESC`,
+		id,
+	)
+}
+
+func (a actionSetSyncRepository) Save(sync *domain.ActionSetSync) error {
+	return a.DB.QueryRow(
+		context.Background(),
+		`INSERT INTO action_set_sync (action_set_id, source_revision, fact_id, changes, error) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		sync.ActionSetId, sync.SourceRevision, sync.FactId, sync.Changes, sync.Error,
+	).Scan(&sync.ID, &sync.CreatedAt)
+}
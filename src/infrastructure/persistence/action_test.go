@@ -51,6 +51,7 @@ func TestShouldSaveAction(t *testing.T) {
 	t.Parallel()
 	dateTime := time.Now().UTC()
 	actionId := uuid.New()
+	sourceRevision := "0123456789abcdef0123456789abcdef01234567"
 	inputs := domain.InputDefinition{
 		Select:   domain.InputDefinitionSelect(1),
 		Not:      false,
@@ -60,9 +61,10 @@ func TestShouldSaveAction(t *testing.T) {
 	actionInputs := make(map[string]domain.InputDefinition)
 	actionInputs["inputs"] = inputs
 	action := domain.Action{
-		ID:     actionId,
-		Name:   "Name",
-		Source: "Source",
+		ID:             actionId,
+		Name:           "Name",
+		Source:         "Source",
+		SourceRevision: &sourceRevision,
 		ActionDefinition: domain.ActionDefinition{
 			Meta:   map[string]interface{}{},
 			Inputs: actionInputs,
@@ -76,7 +78,7 @@ func TestShouldSaveAction(t *testing.T) {
 	}
 	mock, _ := mocks.BuildTransaction(context.Background(), t)
 	rows := mock.NewRows([]string{"id", "created_at"}).AddRow(actionId, dateTime)
-	mock.ExpectQuery("INSERT INTO action").WithArgs(action.ID, action.Name, action.Source, marshalInputs).WillReturnRows(rows)
+	mock.ExpectQuery("INSERT INTO action").WithArgs(action.ID, action.Name, action.Source, action.SourceRevision, action.Meta, marshalInputs).WillReturnRows(rows)
 	mock.ExpectCommit()
 	repository := NewActionRepository(mock)
 
@@ -88,3 +90,28 @@ func TestShouldSaveAction(t *testing.T) {
 	assert.Equal(t, actionId, action.ID)
 	assert.Equal(t, dateTime, action.CreatedAt)
 }
+
+func TestShouldDeleteActionByNameWithItsHistory(t *testing.T) {
+	t.Parallel()
+	name := "Name"
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+	mock.ExpectExec("UPDATE action_set_sync SET fact_id = NULL (.*)").WithArgs(name).WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	for _, table := range []string{"run_inputs", "run_output", "run_job", "fact", "run", "action"} {
+		mock.ExpectExec("DELETE FROM " + table + " (.*)").WithArgs(name).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	}
+
+	repository := NewActionRepository(mock)
+
+	// when
+	err = repository.DeleteByName(name)
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
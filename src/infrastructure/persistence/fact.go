@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"time"
 
 	"github.com/direnv/direnv/v2/sri"
 	"github.com/georgysavva/scany/pgxscan"
@@ -85,6 +86,24 @@ func (a *factRepository) GetByFields(fields [][]string) (facts []*domain.Fact, e
 	return
 }
 
+func (a *factRepository) GetByFieldsCreatedAfter(fields [][]string, after time.Time) (facts []*domain.Fact, err error) {
+	where := sqlWhereHasPaths(fields)
+	if where == "" {
+		where = ` WHERE `
+	} else {
+		where += ` AND `
+	}
+	args := pathsToQueryArgs(fields)
+	where += `created_at > $` + strconv.Itoa(len(args)+1)
+
+	err = pgxscan.Select(
+		context.Background(), a.DB, &facts,
+		`SELECT id, run_id, value, created_at, binary_hash FROM fact `+where+` ORDER BY created_at DESC`,
+		append(args, after)...,
+	)
+	return
+}
+
 func sqlWhereHasPaths(paths [][]string) (where string) {
 	if len(paths) == 0 {
 		return
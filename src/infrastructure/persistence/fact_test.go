@@ -0,0 +1,40 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldGetFactsByFieldsCreatedAfter(t *testing.T) {
+	t.Parallel()
+	after := time.Now().UTC()
+	factId := uuid.New()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+	rows := mock.NewRows([]string{"id", "created_at"}).AddRow(factId, after.Add(time.Second))
+	mock.ExpectQuery(`SELECT (.+) FROM fact WHERE +jsonb_extract_path\(value , \$1 , \$2 \) IS NOT NULL AND created_at > \$3 ORDER BY created_at DESC`).
+		WithArgs("push", "branch", after).
+		WillReturnRows(rows)
+
+	repository := NewFactRepository(mock)
+
+	// when
+	facts, err := repository.GetByFieldsCreatedAfter([][]string{{"push", "branch"}}, after)
+
+	// then
+	assert.Nil(t, err)
+	if assert.Len(t, facts, 1) {
+		assert.Equal(t, factId, facts[0].ID)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
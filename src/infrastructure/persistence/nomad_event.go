@@ -2,6 +2,7 @@ package persistence
 
 import (
 	"context"
+	"time"
 
 	"github.com/georgysavva/scany/pgxscan"
 	"github.com/google/uuid"
@@ -23,19 +24,30 @@ func (n nomadEventRepository) WithQuerier(querier config.PgxIface) repository.No
 	return nomadEventRepository{querier}
 }
 
-func (n nomadEventRepository) Save(event *nomad.Event) (err error) {
+func (n nomadEventRepository) Save(cluster string, jobId uuid.UUID, event *nomad.Event) (err error) {
 	_, err = n.DB.Exec(
 		context.Background(),
-		`INSERT INTO nomad_event (topic, "type", "key", filter_keys, "index", payload) VALUES ($1, $2, $3, $4, $5, $6)`,
-		event.Topic, event.Type, event.Key, event.FilterKeys, event.Index, event.Payload,
+		`INSERT INTO nomad_event (cluster, job_id, topic, "type", "key", filter_keys, "index", payload) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		cluster, jobId, event.Topic, event.Type, event.Key, event.FilterKeys, event.Index, event.Payload,
 	)
 	return
 }
 
-func (n nomadEventRepository) GetLastNomadEvent() (index uint64, err error) {
+func (n nomadEventRepository) GetLastNomadEvent(cluster string) (index uint64, err error) {
 	err = pgxscan.Get(
 		context.Background(), n.DB, &index,
-		`SELECT COALESCE(MAX("index"), 0) FROM nomad_event`,
+		`SELECT COALESCE(MAX("index"), 0) FROM nomad_event_index WHERE cluster = $1`,
+		cluster,
+	)
+	return
+}
+
+func (n nomadEventRepository) SaveLastNomadEvent(cluster string, index uint64) (err error) {
+	_, err = n.DB.Exec(
+		context.Background(),
+		`INSERT INTO nomad_event_index (cluster, "index") VALUES ($1, $2)
+		ON CONFLICT (cluster) DO UPDATE SET "index" = GREATEST(nomad_event_index."index", EXCLUDED."index")`,
+		cluster, index,
 	)
 	return
 }
@@ -44,10 +56,17 @@ func (n nomadEventRepository) GetEventAllocByNomadJobId(id uuid.UUID) (results [
 	err = pgxscan.Select(context.Background(), n.DB, &results, `
 		SELECT "index", payload->>'Allocation' AS alloc
 		FROM nomad_event
-		WHERE payload#>>'{Allocation,JobID}' = $1
-			AND topic = 'Allocation'
+		WHERE job_id = $1
 			AND type = 'AllocationUpdated'
 		ORDER BY "index" ASC
 	`, id)
 	return
 }
+
+func (n nomadEventRepository) DeleteOlderThan(t time.Time) (int64, error) {
+	tag, err := n.DB.Exec(context.Background(), `DELETE FROM nomad_event WHERE created_at < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,85 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldGetLastNomadEventFromIndex(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\("index"\), 0\) FROM nomad_event_index WHERE cluster = \$1`).
+		WithArgs("ci").
+		WillReturnRows(mock.NewRows([]string{"coalesce"}).AddRow(uint64(42)))
+
+	repository := NewNomadEventRepository(mock)
+
+	// when
+	index, err := repository.GetLastNomadEvent("ci")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), index)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSaveLastNomadEventWithoutGoingBack(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+
+	mock.ExpectExec(`INSERT INTO nomad_event_index (.+) ON CONFLICT \(cluster\) DO UPDATE SET "index" = GREATEST\(`).
+		WithArgs("ci", uint64(43)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	repository := NewNomadEventRepository(mock)
+
+	// when
+	err = repository.SaveLastNomadEvent("ci", 43)
+
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldDeleteAllNomadEventsOlderThan(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+
+	before := time.Now()
+	mock.ExpectExec(`^DELETE FROM nomad_event WHERE created_at < \$1$`).
+		WithArgs(before).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+
+	repository := NewNomadEventRepository(mock)
+
+	// when
+	deleted, err := repository.DeleteOlderThan(before)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
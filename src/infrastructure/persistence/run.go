@@ -135,14 +135,69 @@ func (a *runRepository) GetByInputFactIds(factIds []*uuid.UUID, recursive bool,
 	)
 }
 
+func (a *runRepository) GetRunning() (runs []*domain.Run, err error) {
+	err = pgxscan.Select(
+		context.Background(), a.DB, &runs,
+		`SELECT * FROM run WHERE started_at IS NOT NULL AND finished_at IS NULL ORDER BY created_at`,
+	)
+	return
+}
+
+func (a *runRepository) GetRunningByActionName(name string) (runs []*domain.Run, err error) {
+	err = pgxscan.Select(
+		context.Background(), a.DB, &runs,
+		`SELECT run.* FROM run
+		JOIN action ON action.id = run.action_id
+		WHERE action.name = $1 AND run.started_at IS NOT NULL AND run.finished_at IS NULL
+		ORDER BY run.created_at`,
+		name,
+	)
+	return
+}
+
+func (a *runRepository) LockByActionName(name string) (err error) {
+	_, err = a.DB.Exec(
+		context.Background(),
+		`SELECT pg_advisory_xact_lock(hashtext($1))`,
+		name,
+	)
+	return
+}
+
+func (a *runRepository) GetQueuedByActionName(name string) (runs []*domain.Run, err error) {
+	err = pgxscan.Select(
+		context.Background(), a.DB, &runs,
+		`SELECT run.* FROM run
+		JOIN action ON action.id = run.action_id
+		WHERE action.name = $1 AND action.archived_at IS NULL AND
+			run.started_at IS NULL AND run.finished_at IS NULL AND
+			(run.start_after IS NULL OR run.start_after <= NOW())
+		ORDER BY run.created_at`,
+		name,
+	)
+	return
+}
+
+func (a *runRepository) GetQueuedActionNames() (names []string, err error) {
+	err = pgxscan.Select(
+		context.Background(), a.DB, &names,
+		`SELECT DISTINCT action.name FROM run
+		JOIN action ON action.id = run.action_id
+		WHERE action.archived_at IS NULL AND
+			run.started_at IS NULL AND run.finished_at IS NULL AND
+			(run.start_after IS NULL OR run.start_after <= NOW())`,
+	)
+	return
+}
+
 func (a *runRepository) Save(run *domain.Run, inputs map[string]interface{}) error {
 	ctx := context.Background()
 
 	if err := a.DB.BeginFunc(ctx, func(tx pgx.Tx) error {
 		if err := tx.QueryRow(
 			ctx,
-			`INSERT INTO run (action_id) VALUES ($1) RETURNING nomad_job_id, created_at`,
-			run.ActionId,
+			`INSERT INTO run (action_id, retry_of, attempt, start_after, nomad_cluster, nomad_namespace, nomad_region) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING nomad_job_id, created_at`,
+			run.ActionId, run.RetryOf, run.Attempt, run.StartAfter, run.NomadCluster, run.NomadNamespace, run.NomadRegion,
 		).Scan(&run.NomadJobID, &run.CreatedAt); err != nil {
 			return err
 		}
@@ -191,8 +246,8 @@ func (a *runRepository) Save(run *domain.Run, inputs map[string]interface{}) err
 func (a *runRepository) Update(run *domain.Run) (err error) {
 	_, err = a.DB.Exec(
 		context.Background(),
-		`UPDATE run SET finished_at = $2 WHERE nomad_job_id = $1`,
-		run.NomadJobID, run.FinishedAt,
+		`UPDATE run SET started_at = $2, finished_at = $3, end_reason = $4 WHERE nomad_job_id = $1`,
+		run.NomadJobID, run.StartedAt, run.FinishedAt, run.EndReason,
 	)
 	return
 }
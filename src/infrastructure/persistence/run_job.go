@@ -0,0 +1,51 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/google/uuid"
+
+	"github.com/input-output-hk/cicero/src/config"
+	"github.com/input-output-hk/cicero/src/domain"
+	"github.com/input-output-hk/cicero/src/domain/repository"
+)
+
+type runJobRepository struct {
+	DB config.PgxIface
+}
+
+func NewRunJobRepository(db config.PgxIface) repository.RunJobRepository {
+	return runJobRepository{db}
+}
+
+func (a runJobRepository) WithQuerier(querier config.PgxIface) repository.RunJobRepository {
+	return runJobRepository{querier}
+}
+
+func (a runJobRepository) GetByRunId(id uuid.UUID) (runJob domain.RunJob, err error) {
+	err = pgxscan.Get(
+		context.Background(), a.DB, &runJob,
+		`SELECT run_id, evaluator, source_revision, evaluated, transformed, job FROM run_job WHERE run_id = $1`,
+		id,
+	)
+	return
+}
+
+func (a runJobRepository) Save(runJob *domain.RunJob) (err error) {
+	_, err = a.DB.Exec(
+		context.Background(),
+		`INSERT INTO run_job (run_id, evaluator, source_revision, evaluated, transformed, job) VALUES ($1, $2, $3, $4, $5, $6)`,
+		runJob.RunId, runJob.Evaluator, runJob.SourceRevision, runJob.Evaluated, runJob.Transformed, runJob.Job,
+	)
+	return
+}
+
+func (a runJobRepository) UpdateJob(runJob *domain.RunJob) (err error) {
+	_, err = a.DB.Exec(
+		context.Background(),
+		`UPDATE run_job SET job = $2 WHERE run_id = $1`,
+		runJob.RunId, runJob.Job,
+	)
+	return
+}
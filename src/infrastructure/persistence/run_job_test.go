@@ -0,0 +1,42 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	nomad "github.com/hashicorp/nomad/api"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func TestShouldUpdateRunJob(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+
+	runJob := domain.RunJob{
+		RunId: uuid.New(),
+		Job:   &nomad.Job{Meta: map[string]string{"cicero_run_id": "id"}},
+	}
+
+	mock.ExpectExec(`UPDATE run_job SET job = \$2 WHERE run_id = \$1`).
+		WithArgs(runJob.RunId, runJob.Job).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	repository := NewRunJobRepository(mock)
+
+	// when
+	err = repository.UpdateJob(&runJob)
+
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
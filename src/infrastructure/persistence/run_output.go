@@ -26,7 +26,7 @@ func (a runOutputRepository) WithQuerier(querier config.PgxIface) repository.Run
 func (a runOutputRepository) GetByRunId(id uuid.UUID) (output domain.RunOutput, err error) {
 	err = pgxscan.Get(
 		context.Background(), a.DB, &output,
-		`SELECT success, failure FROM run_output WHERE run_id = $1`,
+		`SELECT success, failure, published, fact_id FROM run_output WHERE run_id = $1`,
 		id,
 	)
 	return
@@ -44,8 +44,8 @@ func (a runOutputRepository) Save(runId uuid.UUID, output *domain.RunOutput) (er
 func (a runOutputRepository) Update(runId uuid.UUID, output *domain.RunOutput) (err error) {
 	_, err = a.DB.Exec(
 		context.Background(),
-		`UPDATE run_output (success, failure) VALUES ($2, $3) WHERE run_id = $1`,
-		runId, output.Success, output.Failure,
+		`UPDATE run_output SET success = $2, failure = $3, published = $4, fact_id = $5 WHERE run_id = $1`,
+		runId, output.Success, output.Failure, output.Published, output.FactId,
 	)
 	return
 }
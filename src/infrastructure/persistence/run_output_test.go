@@ -0,0 +1,56 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/input-output-hk/cicero/src/config/mocks"
+	"github.com/input-output-hk/cicero/src/domain"
+)
+
+func TestShouldUpdateRunOutput(t *testing.T) {
+	t.Parallel()
+	runId := uuid.New()
+	var success interface{} = map[string]interface{}{"ok": true}
+	output := domain.RunOutput{Success: &success}
+	output.Publish(domain.RunOutputPublishedSuccess, &domain.Fact{ID: uuid.New()})
+
+	// given
+	mock, _ := mocks.BuildTransaction(context.Background(), t)
+	mock.ExpectExec("UPDATE run_output SET").WithArgs(runId, output.Success, output.Failure, output.Published, output.FactId).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	repository := NewRunOutputRepository(mock)
+
+	// when
+	err := repository.Update(runId, &output)
+
+	// then
+	assert.Nil(t, err)
+}
+
+func TestShouldUpdateRunOutputPublishedWithoutFact(t *testing.T) {
+	t.Parallel()
+	runId := uuid.New()
+	var failure interface{} = map[string]interface{}{"ok": false}
+	output := domain.RunOutput{Failure: &failure}
+	output.Publish(domain.RunOutputPublishedSuccess, nil)
+
+	// given
+	mock, _ := mocks.BuildTransaction(context.Background(), t)
+	mock.ExpectExec("UPDATE run_output SET").WithArgs(runId, output.Success, output.Failure, output.Published, (*uuid.UUID)(nil)).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+	repository := NewRunOutputRepository(mock)
+
+	// when
+	err := repository.Update(runId, &output)
+
+	// then
+	assert.Nil(t, err)
+	if assert.NotNil(t, output.Published) {
+		assert.Equal(t, domain.RunOutputPublishedSuccess, *output.Published)
+	}
+}
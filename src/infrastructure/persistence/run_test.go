@@ -61,12 +61,13 @@ func TestShouldUpdateRun(t *testing.T) {
 		NomadJobID: uuid.New(),
 		ActionId:   uuid.New(),
 		CreatedAt:  now,
+		StartedAt:  &now,
 		FinishedAt: &now,
 	}
 
 	// given
 	mock, _ := mocks.BuildTransaction(context.Background(), t)
-	mock.ExpectExec("UPDATE run").WithArgs(run.NomadJobID, run.FinishedAt).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE run").WithArgs(run.NomadJobID, run.StartedAt, run.FinishedAt, run.EndReason).WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 	mock.ExpectCommit()
 	repository := NewRunRepository(mock)
 
@@ -76,3 +77,47 @@ func TestShouldUpdateRun(t *testing.T) {
 	// then
 	assert.Nil(t, err)
 }
+
+func TestShouldGetQueuedActionNamesOfUnarchivedActions(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, err := pgxmock.NewConn()
+	if err != nil {
+		t.Fatalf("an error %q was not expected when opening a stub database connection", err)
+	}
+	defer mock.Close(context.Background())
+	mock.ExpectQuery(`SELECT DISTINCT action.name FROM run (.+) WHERE action.archived_at IS NULL AND`).
+		WillReturnRows(mock.NewRows([]string{"name"}).AddRow("test"))
+	mock.ExpectQuery(`SELECT run.\* FROM run (.+) WHERE action.name = \$1 AND action.archived_at IS NULL AND`).
+		WithArgs("test").
+		WillReturnRows(mock.NewRows([]string{"nomad_job_id"}).AddRow(uuid.New()))
+	repository := NewRunRepository(mock)
+
+	// when
+	names, namesErr := repository.GetQueuedActionNames()
+	runs, runsErr := repository.GetQueuedByActionName("test")
+
+	// then
+	assert.Nil(t, namesErr)
+	assert.Nil(t, runsErr)
+	assert.Equal(t, []string{"test"}, names)
+	assert.Len(t, runs, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldLockRunsByActionName(t *testing.T) {
+	t.Parallel()
+
+	// given
+	mock, tx := mocks.BuildTransaction(context.Background(), t)
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`).WithArgs("test").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	repository := NewRunRepository(tx)
+
+	// when
+	err := repository.LockByActionName("test")
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
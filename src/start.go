@@ -2,10 +2,12 @@ package cicero
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"cirello.io/oversight"
-	nomad "github.com/hashicorp/nomad/api"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
@@ -19,13 +21,43 @@ import (
 //go:generate mockery --all --keeptree
 
 type StartCmd struct {
-	Components []string `arg:"positional" help:"any of: nomad, web"`
+	Components []string `arg:"positional" help:"any of: nomad, sync, watchdog, web"`
 
-	PrometheusAddr string   `arg:"--prometheus-addr" default:"http://127.0.0.1:3100"`
-	Evaluators     []string `arg:"--evaluators"`
-	Transformers   []string `arg:"--transform"`
+	Evaluators   []string `arg:"--evaluators"`
+	Transformers []string `arg:"--transform" help:"transformers applied to run definitions in order: *.cue files are unified, *.json files are applied as JSON patches, anything else is executed"`
+
+	EvaluationCacheSize int           `arg:"--evaluation-cache-size" default:"256" help:"max number of cached evaluation results, 0 to disable"`
+	EvaluationCacheTtl  time.Duration `arg:"--evaluation-cache-ttl" default:"1h" help:"how long evaluation results are cached, 0 for forever"`
+	SourceCacheMaxAge   time.Duration `arg:"--source-cache-max-age" default:"168h" help:"how long unused source trees are kept, 0 for forever"`
+	EvaluatorWorkers    int           `arg:"--evaluator-workers" default:"0" help:"max number of long-lived worker processes per evaluator that supports them, 0 to disable"`
+	EvaluationTimeout   time.Duration `arg:"--evaluation-timeout" default:"10m" help:"max duration of fetching a source, an evaluation or transformation, 0 for none"`
+
+	EvaluatorEnv            []string `arg:"--evaluator-env" help:"environment variables passed to evaluators and transformers, a trailing * matches a prefix"`
+	TransformerEnv          []string `arg:"--transformer-env" help:"environment variables additionally passed to transformers, a trailing * matches a prefix"`
+	EvaluatorSandbox        bool     `arg:"--evaluator-sandbox" help:"run evaluators and transformers in a bubblewrap sandbox"`
+	EvaluatorSandboxNetwork bool     `arg:"--evaluator-sandbox-network" help:"allow network access in the sandbox"`
+	EvaluatorMemoryLimit    uint64   `arg:"--evaluator-memory-limit" help:"max bytes of virtual memory per evaluator or transformer process, 0 for none"`
+
+	NomadClusters          []string      `arg:"--nomad-clusters" help:"Nomad clusters as name=address, the first is used for actions that do not name one, each configured by CICERO_NOMAD_<NAME>_* variables before NOMAD_* ones; defaults to a cluster named default at the address from NOMAD_ADDR"`
+	LocalExecutor          bool          `arg:"--local-executor" help:"add a cluster named local that runs jobs as local processes, the only one unless --nomad-clusters are given"`
+	NomadEventRetention    time.Duration `arg:"--nomad-event-retention" default:"0" help:"how long allocation events of runs are kept, 0 for forever"`
+	NomadReconcileInterval time.Duration `arg:"--nomad-reconcile-interval" default:"5m" help:"how often unfinished runs are checked against Nomad in case events were missed, 0 for only at startup"`
+
+	Logs           string `arg:"--logs" default:"loki" help:"where logs of runs come from: loki, nomad (from the allocations' file systems) or file (from --logs-dir)"`
+	LokiAddr       string `arg:"--loki-addr" default:"http://127.0.0.1:3100"`
+	PrometheusAddr string `arg:"--prometheus-addr" help:"deprecated alias of --loki-addr"`
+	LogsDir        string `arg:"--logs-dir" help:"directory with logs as <run id>/<alloc id>/<task>.<stdout|stderr> for --logs file"`
+
+	ActionSetSyncInterval time.Duration `arg:"--action-set-sync-interval" default:"5m" help:"how often action sets without match are synced with their source, 0 for never"`
+
+	RunTimeout               time.Duration `arg:"--run-timeout" default:"0" help:"max duration of runs of actions without a timeout in their meta, 0 for none"`
+	RunTimeoutPublishFailure bool          `arg:"--run-timeout-publish-failure" help:"publish the failure output of runs that exceed --run-timeout"`
 
 	WebListen string `arg:"--web-listen,env:WEB_LISTEN" default:":8080"`
+	WebUrl    string `arg:"--web-url,env:CICERO_WEB_URL" help:"where users reach the web UI, told to jobs as CICERO_WEB_URL"`
+	ApiUrl    string `arg:"--api-url,env:CICERO_API_URL" help:"where jobs reach the API, told to jobs as CICERO_API_URL, defaults to --web-url"`
+
+	JobEnv []string `arg:"--job-env" help:"environment variables as CICERO_*=value added to every task, except those Cicero sets itself"`
 }
 
 func (cmd *StartCmd) Run(logger *zerolog.Logger) error {
@@ -34,14 +66,20 @@ func (cmd *StartCmd) Run(logger *zerolog.Logger) error {
 	// If none are given then start all,
 	// otherwise start only those that are given.
 	var start struct {
-		factCreate bool
-		nomadEvent bool
-		web        bool
+		factCreate    bool
+		nomadEvent    bool
+		actionSetSync bool
+		runWatchdog   bool
+		web           bool
 	}
 	for _, component := range cmd.Components {
 		switch component {
 		case "nomad":
 			start.nomadEvent = true
+		case "sync":
+			start.actionSetSync = true
+		case "watchdog":
+			start.runWatchdog = true
 		case "web":
 			start.web = true
 		default:
@@ -50,15 +88,24 @@ func (cmd *StartCmd) Run(logger *zerolog.Logger) error {
 	}
 	if !(start.factCreate ||
 		start.nomadEvent ||
+		start.actionSetSync ||
+		start.runWatchdog ||
 		start.web) {
 		start.factCreate = true
 		start.nomadEvent = true
+		start.actionSetSync = true
+		start.runWatchdog = true
 		start.web = true
 	}
 
 	// default to all evaluators we ship
 	if len(cmd.Evaluators) == 0 {
-		cmd.Evaluators = []string{"nix"}
+		cmd.Evaluators = []string{"nix", "cue"}
+	}
+
+	// notably excludes secrets like DATABASE_URL
+	if len(cmd.EvaluatorEnv) == 0 {
+		cmd.EvaluatorEnv = []string{"PATH", "HOME", "USER", "TMPDIR", "SSL_CERT_FILE", "NIX_*", "CICERO_EVALUATOR_*"}
 	}
 
 	db := once(func() interface{} {
@@ -70,44 +117,146 @@ func (cmd *StartCmd) Run(logger *zerolog.Logger) error {
 		}
 	})
 
-	nomadClient := once(func() interface{} {
-		if client, err := config.NewNomadClient(); err != nil {
+	jobConfig := service.RunJobConfig{
+		WebUrl: cmd.WebUrl,
+		ApiUrl: cmd.ApiUrl,
+		Env:    map[string]string{},
+	}
+	for _, env := range cmd.JobEnv {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "CICERO_") {
+			logger.Fatal().Msgf("Invalid job environment variable %q, expected CICERO_*=value", env)
+		}
+		jobConfig.Env[parts[0]] = parts[1]
+	}
+	if err := jobConfig.Validate(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid job environment variable")
+	}
+
+	nomadClusters := once(func() interface{} {
+		if clusters, err := cmd.newNomadClusters(logger); err != nil {
 			logger.Fatal().Err(err).Send()
 			return nil
 		} else {
-			return client
+			return clusters
 		}
 	})
-	nomadClientWrapper := once(func() interface{} {
-		return application.NewNomadClient(nomadClient().(*nomad.Client))
+
+	logProvider := once(func() interface{} {
+		if logProvider, err := cmd.newLogProvider(nomadClusters().(application.NomadClusters), logger); err != nil {
+			logger.Fatal().Err(err).Send()
+			return nil
+		} else {
+			return logProvider
+		}
 	})
 
 	runService := once(func() interface{} {
-		return service.NewRunService(db().(config.PgxIface), cmd.PrometheusAddr, nomadClientWrapper().(application.NomadClient), logger)
+		return service.NewRunService(db().(config.PgxIface), logProvider().(application.LogProvider), nomadClusters().(application.NomadClusters), jobConfig, logger)
 	})
 	evaluationService := once(func() interface{} {
-		return service.NewEvaluationService(cmd.Evaluators, cmd.Transformers, logger)
+		if evaluationService, err := service.NewEvaluationService(db().(config.PgxIface), cmd.Evaluators, cmd.Transformers, cmd.EvaluationCacheSize, cmd.EvaluationCacheTtl, cmd.SourceCacheMaxAge, cmd.EvaluatorWorkers, cmd.EvaluationTimeout, service.EvaluationSandbox{
+			Env:            cmd.EvaluatorEnv,
+			TransformerEnv: cmd.TransformerEnv,
+			Bubblewrap:     cmd.EvaluatorSandbox,
+			Network:        cmd.EvaluatorSandboxNetwork,
+			MemoryLimit:    cmd.EvaluatorMemoryLimit,
+		}, logger); err != nil {
+			logger.Fatal().Err(err).Msg("Could not create EvaluationService")
+			return nil
+		} else {
+			return evaluationService
+		}
 	})
 	actionService := once(func() interface{} {
-		return service.NewActionService(db().(config.PgxIface), nomadClientWrapper().(application.NomadClient), runService().(service.RunService), evaluationService().(service.EvaluationService), logger)
+		return service.NewActionService(db().(config.PgxIface), nomadClusters().(application.NomadClusters), runService().(service.RunService), evaluationService().(service.EvaluationService), logger)
 	})
 	factService := once(func() interface{} {
 		return service.NewFactService(db().(config.PgxIface), actionService().(service.ActionService), logger)
 	})
+	actionSetService := once(func() interface{} {
+		return service.NewActionSetService(db().(config.PgxIface), actionService().(service.ActionService), evaluationService().(service.EvaluationService), logger)
+	})
 	nomadEventService := once(func() interface{} {
 		return service.NewNomadEventService(db().(config.PgxIface), runService().(service.RunService), logger)
 	})
 
+	// fail early on invalid transformers
+	evaluationService()
+
 	supervisor := cmd.newSupervisor(logger)
 
 	if start.nomadEvent {
-		child := component.NomadEventConsumer{
-			Logger:            logger.With().Str("component", "NomadEventConsumer").Logger(),
-			RunService:        runService().(service.RunService),
-			NomadEventService: nomadEventService().(service.NomadEventService),
-			FactService:       factService().(service.FactService),
-			NomadClient:       nomadClientWrapper().(application.NomadClient),
-			Db:                db().(config.PgxIface),
+		for _, cluster := range nomadClusters().(application.NomadClusters) {
+			child := component.NomadEventConsumer{
+				Logger:            logger.With().Str("component", "NomadEventConsumer").Str("cluster", cluster.Name).Logger(),
+				Cluster:           cluster.Name,
+				Clusters:          nomadClusters().(application.NomadClusters),
+				RunService:        runService().(service.RunService),
+				NomadEventService: nomadEventService().(service.NomadEventService),
+				FactService:       factService().(service.FactService),
+				Executor:          cluster.Executor,
+				Db:                db().(config.PgxIface),
+			}
+			if err := supervisor.Add(child.Start); err != nil {
+				return err
+			}
+
+			reconciler := component.NomadReconciler{
+				Logger:      logger.With().Str("component", "NomadReconciler").Str("cluster", cluster.Name).Logger(),
+				Cluster:     cluster.Name,
+				Clusters:    nomadClusters().(application.NomadClusters),
+				RunService:  runService().(service.RunService),
+				FactService: factService().(service.FactService),
+				Executor:    cluster.Executor,
+				Db:          db().(config.PgxIface),
+				Interval:    cmd.NomadReconcileInterval,
+			}
+			if err := supervisor.Add(reconciler.Start); err != nil {
+				return err
+			}
+		}
+
+		starter := component.RunStarter{
+			Logger:     logger.With().Str("component", "RunStarter").Logger(),
+			RunService: runService().(service.RunService),
+		}
+		if err := supervisor.Add(starter.Start); err != nil {
+			return err
+		}
+
+		if cmd.NomadEventRetention > 0 {
+			pruner := component.NomadEventPruner{
+				Logger:            logger.With().Str("component", "NomadEventPruner").Logger(),
+				NomadEventService: nomadEventService().(service.NomadEventService),
+				Retention:         cmd.NomadEventRetention,
+			}
+			if err := supervisor.Add(pruner.Start); err != nil {
+				return err
+			}
+		}
+	}
+
+	if start.actionSetSync {
+		child := component.ActionSetSyncer{
+			Logger:           logger.With().Str("component", "ActionSetSyncer").Logger(),
+			ActionSetService: actionSetService().(service.ActionSetService),
+			Interval:         cmd.ActionSetSyncInterval,
+		}
+		if err := supervisor.Add(child.Start); err != nil {
+			return err
+		}
+	}
+
+	if start.runWatchdog {
+		child := component.RunWatchdog{
+			Logger:         logger.With().Str("component", "RunWatchdog").Logger(),
+			RunService:     runService().(service.RunService),
+			ActionService:  actionService().(service.ActionService),
+			FactService:    factService().(service.FactService),
+			Db:             db().(config.PgxIface),
+			Timeout:        cmd.RunTimeout,
+			PublishFailure: cmd.RunTimeoutPublishFailure,
 		}
 		if err := supervisor.Add(child.Start); err != nil {
 			return err
@@ -123,6 +272,7 @@ func (cmd *StartCmd) Run(logger *zerolog.Logger) error {
 			FactService:       factService().(service.FactService),
 			NomadEventService: nomadEventService().(service.NomadEventService),
 			EvaluationService: evaluationService().(service.EvaluationService),
+			ActionSetService:  actionSetService().(service.ActionSetService),
 			Db:                db().(config.PgxIface),
 		}
 		if err := supervisor.Add(child.Start); err != nil {
@@ -141,6 +291,84 @@ func (cmd *StartCmd) Run(logger *zerolog.Logger) error {
 	return nil
 }
 
+func (cmd *StartCmd) newNomadClusters(logger *zerolog.Logger) (application.NomadClusters, error) {
+	clusters := application.NomadClusters{}
+
+	for _, cluster := range cmd.NomadClusters {
+		parts := strings.SplitN(cluster, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("Invalid Nomad cluster %q, expected name=address", cluster)
+		}
+		name, address := parts[0], parts[1]
+
+		if _, err := clusters.Get(name); err == nil {
+			return nil, errors.Errorf("Duplicate Nomad cluster %q", name)
+		}
+
+		client, err := config.NewNomadClusterClient(name, address)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "Could not create client for Nomad cluster %q", name)
+		}
+
+		clusters = append(clusters, application.NomadCluster{
+			Name:     name,
+			Executor: application.NewNomadExecutor(client),
+		})
+	}
+
+	// added last so that it is not the default if other clusters are given
+	if cmd.LocalExecutor {
+		if _, err := clusters.Get(application.LocalNomadCluster); err == nil {
+			return nil, errors.Errorf("Duplicate Nomad cluster %q", application.LocalNomadCluster)
+		}
+
+		executor, err := application.NewLocalExecutor(filepath.Join(os.TempDir(), "cicero-local-executor"), logger)
+		if err != nil {
+			return nil, err
+		}
+
+		clusters = append(clusters, application.NomadCluster{
+			Name:     application.LocalNomadCluster,
+			Executor: executor,
+		})
+	}
+
+	if len(clusters) == 0 {
+		client, err := config.NewNomadClient("")
+		if err != nil {
+			return nil, err
+		}
+
+		clusters = append(clusters, application.NomadCluster{
+			Name:     application.DefaultNomadCluster,
+			Executor: application.NewNomadExecutor(client),
+		})
+	}
+
+	return clusters, nil
+}
+
+func (cmd *StartCmd) newLogProvider(nomadClusters application.NomadClusters, logger *zerolog.Logger) (application.LogProvider, error) {
+	switch cmd.Logs {
+	case "loki":
+		addr := cmd.LokiAddr
+		if cmd.PrometheusAddr != "" {
+			logger.Warn().Msg("--prometheus-addr is deprecated, use --loki-addr instead")
+			addr = cmd.PrometheusAddr
+		}
+		return application.NewLokiLogProvider(addr)
+	case "nomad":
+		return application.NewNomadLogProvider(nomadClusters), nil
+	case "file":
+		if cmd.LogsDir == "" {
+			return nil, errors.New("--logs file requires --logs-dir")
+		}
+		return application.NewFileLogProvider(cmd.LogsDir), nil
+	default:
+		return nil, errors.Errorf("Unknown log provider %q, expected loki, nomad or file", cmd.Logs)
+	}
+}
+
 func (cmd *StartCmd) newSupervisor(logger *zerolog.Logger) *oversight.Tree {
 	return oversight.New(
 		oversight.WithLogger(&config.SupervisorLogger{Logger: logger}),